@@ -0,0 +1,57 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// healthProbes serves the liveness and readiness probes of the controller. Readiness does not
+// depend on leadership: a replica waiting for the lease is ready to take over, which lets a rolling
+// update start the new replica before stopping the old one.
+type healthProbes struct {
+	discovery discovery.DiscoveryInterface
+}
+
+func newHealthProbes(cfg *rest.Config) (*healthProbes, error) {
+	d, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &healthProbes{discovery: d}, nil
+}
+
+// serve serves /healthz, which succeeds while the process runs, and /readyz, which succeeds while
+// the API server is reachable.
+func (p *healthProbes) serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if _, err := p.discovery.ServerVersion(); err != nil {
+			http.Error(w, fmt.Sprintf("API server unreachable: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	return http.ListenAndServe(addr, mux)
+}
@@ -17,7 +17,10 @@ limitations under the License.
 package main
 
 import (
+	"flag"
 	"log"
+	"os"
+	"path/filepath"
 
 	"github.com/whynowy/knative-source-kinesis/pkg/apis"
 	controller "github.com/whynowy/knative-source-kinesis/pkg/reconciler"
@@ -29,7 +32,28 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/runtime/signals"
 )
 
+var (
+	leaderElect = flag.Bool("leader-elect", false,
+		"Elect a leader among the controller replicas, only the leader reconciles the sources. The manifests enable it.")
+	leaderElectionNamespace = flag.String("leader-election-namespace", "",
+		"Namespace of the leader election lock, the namespace of the controller when empty.")
+	leaderElectionID = flag.String("leader-election-id", "kinesis-controller-leader",
+		"Name of the ConfigMap holding the leader election lock.")
+	metricsAddr = flag.String("metrics-addr", ":9090",
+		"Address the Prometheus metrics are served on, they are not served when empty.")
+	healthAddr = flag.String("health-addr", ":8081",
+		"Address the /healthz and /readyz probes are served on, they are not served when empty.")
+	namespace = flag.String("namespace", "",
+		"Namespace the controller is restricted to, all namespaces when empty.")
+	webhookAddr = flag.String("webhook-addr", "",
+		"Address the validating admission webhook is served on, it is not served when empty.")
+	webhookCertDir = flag.String("webhook-cert-dir", "/etc/kinesis-webhook/certs",
+		"Directory of the tls.crt and tls.key certificate of the webhook, it is not served when missing.")
+)
+
 func main() {
+	flag.Parse()
+
 	logCfg := zap.NewProductionConfig()
 	logCfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	logger, err := logCfg.Build()
@@ -45,11 +69,39 @@ func main() {
 	}
 
 	// Create a new Cmd to provide shared dependencies and start components
-	mgr, err := manager.New(cfg, manager.Options{})
+	mgr, err := manager.New(cfg, manager.Options{
+		LeaderElection:          *leaderElect,
+		LeaderElectionNamespace: *leaderElectionNamespace,
+		LeaderElectionID:        *leaderElectionID,
+		MetricsBindAddress:      *metricsAddr,
+		Namespace:               *namespace,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if *healthAddr != "" {
+		probes, err := newHealthProbes(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			log.Fatal(probes.serve(*healthAddr))
+		}()
+	}
+
+	stopCh := signals.SetupSignalHandler()
+
+	if *webhookAddr != "" {
+		if _, err := os.Stat(filepath.Join(*webhookCertDir, "tls.crt")); err != nil {
+			log.Printf("Not serving the webhook: %v", err)
+		} else {
+			go func() {
+				log.Fatal(controller.ServeWebhook(cfg, logger.Sugar(), *webhookAddr, *webhookCertDir, stopCh))
+			}()
+		}
+	}
+
 	log.Printf("Registering Components.")
 
 	// Setup Scheme for all resources
@@ -58,12 +110,12 @@ func main() {
 	}
 
 	// Setup pubsub Controller
-	if err := controller.Add(mgr, logger.Sugar()); err != nil {
+	if err := controller.Add(mgr, logger.Sugar(), *namespace); err != nil {
 		log.Fatal(err)
 	}
 
 	log.Printf("Starting Kinesis controller.")
 
 	// Start the Cmd
-	log.Fatal(mgr.Start(signals.SetupSignalHandler()))
+	log.Fatal(mgr.Start(stopCh))
 }
@@ -17,14 +17,25 @@ limitations under the License.
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	kinesis "github.com/whynowy/knative-source-kinesis/pkg/adapter"
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	"github.com/whynowy/knative-source-kinesis/pkg/client/clientset/versioned"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/runtime/signals"
 
 	"golang.org/x/net/context"
@@ -48,6 +59,70 @@ const (
 
 	// Environment variable for Consumer Name
 	envConsumerName = "CONSUMER_NAME"
+
+	// Environment variables identifying the KinesisSource, the progress of the shards is reported
+	// to it when they are defined
+	envSourceNamespace = "SOURCE_NAMESPACE"
+	envSourceName      = "SOURCE_NAME"
+
+	// Environment variables tuning the KCL, they are optional
+	envKCLMaxRecords         = "KCL_MAX_RECORDS"
+	envKCLMaxLeasesForWorker = "KCL_MAX_LEASES_FOR_WORKER"
+	envKCLShardSyncInterval  = "KCL_SHARD_SYNC_INTERVAL"
+	envKCLFailoverTime       = "KCL_FAILOVER_TIME"
+
+	// Environment variable containing the metrics backend of the KCL, it is optional
+	envMetricsBackend = "METRICS_BACKEND"
+
+	// Environment variables containing the retry policy of the deliveries, they are optional
+	envRetryAttempts   = "RETRY_ATTEMPTS"
+	envRetryBackoff    = "RETRY_BACKOFF"
+	envRetryMaxBackoff = "RETRY_MAX_BACKOFF"
+
+	// Environment variable containing the payload format of the records, it is optional
+	envPayloadFormat = "PAYLOAD_FORMAT"
+
+	// Environment variable set to "true" to convert the items of DynamoDB changes to plain JSON
+	envDynamoDBPlainJSON = "DYNAMODB_PLAIN_JSON"
+
+	// Environment variables containing the content type and the compression of the data of the
+	// records, they are optional
+	envDataContentType = "DATA_CONTENT_TYPE"
+	envCompression     = "COMPRESSION"
+
+	// Environment variables defining the schemas the data of the records is decoded with, they
+	// are optional
+	envSchemaType        = "SCHEMA_TYPE"
+	envSchemaDir         = "SCHEMA_DIR"
+	envSchemaURL         = "SCHEMA_URL"
+	envSchemaMessageType = "SCHEMA_MESSAGE_TYPE"
+
+	// Environment variable containing the URI the undecodable records are sent to, it is optional
+	envDeadLetterSinkURI = "DEAD_LETTER_SINK_URI"
+
+	// Environment variable containing the replay as JSON, it is optional
+	envReplay = "REPLAY"
+
+	// Environment variable containing the filter of the records as JSON, it is optional
+	envFilter = "FILTER"
+
+	// Environment variable containing the overrides of the attributes of the events as JSON, it
+	// is optional
+	envCEOverrides = "CE_OVERRIDES"
+
+	// Environment variable containing the transform of the data of the records as JSON, it is
+	// optional
+	envTransform = "TRANSFORM"
+
+	// Environment variable set to "true" to delete the AWS resources of the consumer instead of
+	// consuming the stream
+	envCleanup = "CLEANUP"
+
+	// component is the source of the events recorded by the adapter
+	component = "kinesis-receive-adapter"
+
+	// eventFlushTimeout is how long the events recorded before a fatal error are given to be sent
+	eventFlushTimeout = 2 * time.Second
 )
 
 func getRequiredEnv(envKey string) string {
@@ -66,6 +141,34 @@ func getOptionalEnv(envKey string) string {
 	return val
 }
 
+// getOptionalPositiveInt returns the value of an optional environment variable holding a
+// positive integer, or else the given default.
+func getOptionalPositiveInt(envKey string, defaultValue int) int {
+	val := getOptionalEnv(envKey)
+	if val == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil || i <= 0 {
+		log.Fatalf("invalid environment variable '%s': %q is not a positive integer", envKey, val)
+	}
+	return i
+}
+
+// getOptionalDuration returns the value of an optional environment variable holding a duration,
+// or else the given default.
+func getOptionalDuration(envKey string, defaultValue time.Duration) time.Duration {
+	val := getOptionalEnv(envKey)
+	if val == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		log.Fatalf("invalid environment variable '%s': %q is not a duration", envKey, val)
+	}
+	return d
+}
+
 func main() {
 	flag.Parse()
 
@@ -84,11 +187,96 @@ func main() {
 		Region:        getRequiredEnv(envRegion),
 		SinkURI:       getRequiredEnv(envSinkURI),
 		ConsumerName:  getRequiredEnv(envConsumerName),
+		KCL: kinesis.KCLOptions{
+			MaxRecords:         getOptionalPositiveInt(envKCLMaxRecords, kinesis.DefaultKCLOptions.MaxRecords),
+			MaxLeasesForWorker: getOptionalPositiveInt(envKCLMaxLeasesForWorker, kinesis.DefaultKCLOptions.MaxLeasesForWorker),
+			ShardSyncInterval:  getOptionalDuration(envKCLShardSyncInterval, kinesis.DefaultKCLOptions.ShardSyncInterval),
+			FailoverTime:       getOptionalDuration(envKCLFailoverTime, kinesis.DefaultKCLOptions.FailoverTime),
+		},
+		MetricsBackend:    getOptionalEnv(envMetricsBackend),
+		PayloadFormat:     getOptionalEnv(envPayloadFormat),
+		DynamoDBPlainJSON: getOptionalEnv(envDynamoDBPlainJSON) == "true",
+		DataContentType:   getOptionalEnv(envDataContentType),
+		Compression:       getOptionalEnv(envCompression),
+		DeadLetterSinkURI: getOptionalEnv(envDeadLetterSinkURI),
+		Retry: kinesis.RetryPolicy{
+			Attempts:   getOptionalPositiveInt(envRetryAttempts, kinesis.DefaultRetryPolicy.Attempts),
+			Backoff:    getOptionalDuration(envRetryBackoff, kinesis.DefaultRetryPolicy.Backoff),
+			MaxBackoff: getOptionalDuration(envRetryMaxBackoff, kinesis.DefaultRetryPolicy.MaxBackoff),
+		},
+	}
+
+	// flushEvents gives the events recorded so far a chance to be sent before exiting.
+	flushEvents := func() {}
+
+	adapter.SourceNamespace = getOptionalEnv(envSourceNamespace)
+	adapter.SourceName = getOptionalEnv(envSourceName)
+	if adapter.SourceNamespace != "" && adapter.SourceName != "" {
+		if cfg, err := rest.InClusterConfig(); err != nil {
+			logger.Warn("Not reporting progress nor events, failed to get the in-cluster config: ", zap.Error(err))
+		} else {
+			adapter.Sources = versioned.NewForConfigOrDie(cfg)
+
+			kube := kubernetes.NewForConfigOrDie(cfg)
+			broadcaster := record.NewBroadcaster()
+			sink := broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kube.CoreV1().Events(adapter.SourceNamespace)})
+			adapter.Recorder = broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component})
+			flushEvents = func() {
+				time.Sleep(eventFlushTimeout)
+				sink.Stop()
+			}
+		}
+	}
+
+	if schemaType := getOptionalEnv(envSchemaType); schemaType != "" {
+		adapter.Schema = &kinesis.Schema{
+			Type:        schemaType,
+			Dir:         getRequiredEnv(envSchemaDir),
+			MessageType: getOptionalEnv(envSchemaMessageType),
+			URL:         getOptionalEnv(envSchemaURL),
+		}
+	}
+
+	if replay := getOptionalEnv(envReplay); replay != "" {
+		adapter.Replay = &kinesis.Replay{}
+		if err := json.Unmarshal([]byte(replay), adapter.Replay); err != nil {
+			logger.Fatal("invalid replay: ", zap.Error(err))
+		}
+	}
+
+	if filter := getOptionalEnv(envFilter); filter != "" {
+		adapter.Filter = &v1alpha1.FilterSpec{}
+		if err := json.Unmarshal([]byte(filter), adapter.Filter); err != nil {
+			logger.Fatal("invalid filter: ", zap.Error(err))
+		}
+	}
+
+	if overrides := getOptionalEnv(envCEOverrides); overrides != "" {
+		adapter.CEOverrides = &v1alpha1.CEOverrides{}
+		if err := json.Unmarshal([]byte(overrides), adapter.CEOverrides); err != nil {
+			logger.Fatal("invalid CloudEvents overrides: ", zap.Error(err))
+		}
+	}
+
+	if transform := getOptionalEnv(envTransform); transform != "" {
+		if err := json.Unmarshal([]byte(transform), &adapter.Transform); err != nil {
+			logger.Fatal("invalid transform: ", zap.Error(err))
+		}
+	}
+
+	if getOptionalEnv(envCleanup) == "true" {
+		logger.Info("Cleaning up Kinesis Receive Adapter.", zap.Any("adapter", adapter))
+		if err := adapter.Cleanup(ctx); err != nil {
+			flushEvents()
+			logger.Fatal("failed to clean up: ", zap.Error(err))
+		}
+		return
 	}
 
 	logger.Info("Starting Kinesis Receive Adapter.", zap.Any("adapter", adapter))
 	stopCh := signals.SetupSignalHandler()
 	if err := adapter.Start(ctx, stopCh); err != nil {
+		flushEvents()
 		logger.Fatal("failed to start adapter: ", zap.Error(err))
 	}
 }
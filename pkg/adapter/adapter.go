@@ -18,12 +18,17 @@ package kinesis
 
 import (
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/kinesis"
 
 	"github.com/knative/eventing-sources/pkg/kncloudevents"
@@ -35,10 +40,14 @@ import (
 	"github.com/knative/pkg/logging"
 	cfg "github.com/vmware/vmware-go-kcl/clientlibrary/config"
 	kc "github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
-	"github.com/vmware/vmware-go-kcl/clientlibrary/metrics"
 	wk "github.com/vmware/vmware-go-kcl/clientlibrary/worker"
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	"github.com/whynowy/knative-source-kinesis/pkg/client/clientset/versioned"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
@@ -53,6 +62,10 @@ const (
 
 	//Extension kinesisSchemaVersion fields to support KinesisEvent
 	extKinesisSchemaVersion = "1.0"
+
+	// drainTimeout bounds how long shutting down waits for the shard consumers to finish,
+	// it stays below the default termination grace period of pods.
+	drainTimeout = 20 * time.Second
 )
 
 // Adapter implements the Kinesis adapter to deliver Kinesis messages from
@@ -80,8 +93,95 @@ type Adapter struct {
 	//Application consumer name
 	ConsumerName string
 
+	// KCL tunes the Kinesis Client Library.
+	KCL KCLOptions
+
+	// MetricsBackend is where the KCL reports its metrics to, CloudWatch when empty.
+	MetricsBackend string
+
+	// Retry defines how the delivery of an event is retried, an event is delivered once when
+	// Attempts is not positive.
+	Retry RetryPolicy
+
+	// PayloadFormat is how the records are turned into events, PayloadFormatKCL when empty.
+	PayloadFormat string
+
+	// DynamoDBPlainJSON converts the items of the PayloadFormatDynamoDBChanges events from the
+	// attribute value format of DynamoDB to plain JSON.
+	DynamoDBPlainJSON bool
+
+	// DataContentType is how the data of the records is delivered with PayloadFormatKCL and
+	// PayloadFormatRecord, base64-encoded in JSON and as is respectively when empty.
+	DataContentType string
+
+	// Compression is how the data of the records is decompressed, it is kept as is when empty.
+	Compression string
+
+	// Schema decodes the data of the records to JSON with PayloadFormatRecord, it is optional.
+	Schema *Schema
+
+	// Filter selects the records delivered, it is optional.
+	Filter *v1alpha1.FilterSpec
+
+	// CEOverrides overrides the attributes of the events, it is optional.
+	CEOverrides *v1alpha1.CEOverrides
+
+	// Transform reshapes the JSON data of the records delivered with PayloadFormatKCL and
+	// PayloadFormatRecord, it is optional.
+	Transform []v1alpha1.TransformStep
+
+	// PayloadFormats registers custom payload formats delivering every record as events, keyed by
+	// the name PayloadFormat selects them with, which cannot be the name of a built-in format. Their
+	// EventMapper ends the chain of EventMappers. They are optional.
+	PayloadFormats map[string]EventMapper
+
+	// Middlewares are custom steps of the chain of EventMappers turning the records into events,
+	// they are given the records once decoded, filtered and transformed, and wrap the EventMapper
+	// of the payload format in order. They are optional.
+	Middlewares []Middleware
+
+	// DeadLetterSinkURI is where the records which cannot be decoded are sent to, they are
+	// skipped when it is empty.
+	DeadLetterSinkURI string
+
+	// Replay rewinds the stream before consuming it, it is optional.
+	Replay *Replay
+
+	// SourceNamespace and SourceName identify the KinesisSource the progress of the shards is
+	// reported to.
+	SourceNamespace string
+	SourceName      string
+
+	// Sources is the client reporting the progress of the shards, the progress is not reported
+	// when it is nil.
+	Sources versioned.Interface
+
+	// Recorder records events against the KinesisSource, no events are recorded when it is nil.
+	Recorder record.EventRecorder
+
+	// progress tracks the progress of the shards.
+	progress *progress
+
+	// sinkFailures counts the consecutive failed deliveries.
+	sinkFailures int32
+
 	// Client sends cloudevents to the target.
 	client client.Client
+
+	// deadLetterClient sends the dead letters to the dead-letter sink.
+	deadLetterClient client.Client
+
+	// decoder decodes the data of the records with the schemas.
+	decoder schemaDecoder
+
+	// filter is the compiled Filter.
+	filter *filter
+
+	// overrides are the compiled CEOverrides.
+	overrides *ceOverrides
+
+	// transform is the compiled Transform.
+	transform transform
 }
 
 // Initialize cloudevent client
@@ -92,6 +192,12 @@ func (a *Adapter) initClient() error {
 			return err
 		}
 	}
+	if a.deadLetterClient == nil && a.DeadLetterSinkURI != "" {
+		var err error
+		if a.deadLetterClient, err = kncloudevents.NewDefaultClient(a.DeadLetterSinkURI); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -100,30 +206,49 @@ func (a *Adapter) Start(ctx context.Context, stopCh <-chan struct{}) error {
 
 	logger := logging.FromContext(ctx)
 
-	if err := a.initClient(); err != nil {
-		logger.Error("Failed to create cloudevent client", zap.Error(err))
+	if err := a.checkPayloadFormat(); err != nil {
 		return err
 	}
 
-	var creds *credentials.Credentials
-	var sess *session.Session
+	if a.Filter != nil {
+		f, err := compileFilter(a.Filter)
+		if err != nil {
+			return err
+		}
+		a.filter = f
+	}
 
-	if len(a.CredsFile) > 0 {
-		sess = session.Must(session.NewSessionWithOptions(session.Options{
-			SharedConfigState: session.SharedConfigDisable,
-			Config:            aws.Config{Region: &a.Region},
-			SharedConfigFiles: []string{a.CredsFile},
-		}))
-		creds = sess.Config.Credentials
-	} else if len(a.KCLIAMRoleARN) > 0 {
+	if a.CEOverrides != nil {
+		o, err := compileCEOverrides(a.CEOverrides)
+		if err != nil {
+			return err
+		}
+		a.overrides = o
+	}
 
-		sess = session.Must(session.NewSession())
+	t, err := compileTransform(a.Transform)
+	if err != nil {
+		return err
+	}
+	a.transform = t
 
-		// Create the credentials from AssumeRoleProvider to assume the role
-		// referenced by the "KCLIAMRoleARN" ARN.
-		creds = stscreds.NewCredentials(sess, a.KCLIAMRoleARN)
-	} else {
-		return fmt.Errorf("Neither AWS_APPLICATION_CREDENTIALS nor KCL_IAM_ROLE_ARN is found in ENV")
+	if a.Schema != nil {
+		decoder, err := a.Schema.load()
+		if err != nil {
+			logger.Error("Failed to load the schemas", zap.Error(err))
+			return err
+		}
+		a.decoder = decoder
+	}
+
+	if err := a.initClient(); err != nil {
+		logger.Error("Failed to create cloudevent client", zap.Error(err))
+		return err
+	}
+
+	sess, creds, err := a.newSession()
+	if err != nil {
+		return err
 	}
 
 	// Kinesis API client
@@ -131,6 +256,7 @@ func (a *Adapter) Start(ctx context.Context, stopCh <-chan struct{}) error {
 	stream, err := kinesisClient.DescribeStream(&kinesis.DescribeStreamInput{StreamName: aws.String(a.StreamName)})
 	if err != nil {
 		logger.Error("Failed to describe stream input", zap.Error(err))
+		a.eventf(corev1.EventTypeWarning, describeStreamFailedReason, "Failed to describe stream %q: %v", a.StreamName, err)
 		return err
 	}
 	a.streamARN = stream.StreamDescription.StreamARN
@@ -138,31 +264,100 @@ func (a *Adapter) Start(ctx context.Context, stopCh <-chan struct{}) error {
 	//using the consumer name as worker id. Future enhancement can associate different workers for the same consumer
 	kclConfig := cfg.NewKinesisClientLibConfigWithCredential(a.ConsumerName, a.StreamName, a.Region, a.ConsumerName, creds).
 		WithInitialPositionInStream(cfg.LATEST).
-		WithMaxRecords(10).
-		WithMaxLeasesForWorker(20).
-		WithShardSyncIntervalMillis(5000).
-		WithFailoverTimeMillis(300000)
-
-	// configure cloudwatch as metrics system
-	metricsConfig := &metrics.MonitoringConfiguration{
-		MonitoringService: "cloudwatch",
-		Region:            a.Region,
-		CloudWatch: metrics.CloudWatchMonitoringService{
-			MetricsBufferTimeMillis: 10000,
-			MetricsMaxQueueSize:     20,
-			Credentials:             creds,
-		}}
+		WithMaxRecords(a.KCL.MaxRecords).
+		WithMaxLeasesForWorker(a.KCL.MaxLeasesForWorker).
+		WithShardSyncIntervalMillis(int(a.KCL.ShardSyncInterval / time.Millisecond)).
+		WithFailoverTimeMillis(int(a.KCL.FailoverTime / time.Millisecond)).
+		WithCallProcessRecordsEvenForEmptyRecordList(true)
+
+	dynamo := dynamodb.New(sess, &aws.Config{Credentials: creds, Region: aws.String(a.Region)})
+	if a.Replay != nil {
+		if err = a.applyReplay(dynamo, kclConfig, logger); err != nil {
+			logger.Error("Failed to apply replay", zap.Error(err))
+			a.eventf(corev1.EventTypeWarning, replayFailedReason, "Failed to apply replay %q: %v", a.Replay.Token, err)
+			return err
+		}
+	}
+
+	metricsConfig, err := a.metricsConfig(creds)
+	if err != nil {
+		return err
+	}
+	stopMetrics, err := a.startMetrics(cloudwatch.New(sess, &aws.Config{Credentials: creds, Region: aws.String(a.Region)}), logger)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
 
 	worker := wk.NewWorker(recordProcessorFactory(a, logger), kclConfig, metricsConfig)
 
+	a.progress = newProgress()
 	if err = worker.Start(); err != nil {
 		return err
 	}
-	<-stopCh
+
+	// The KCL worker shuts itself down on SIGINT and SIGTERM, concurrently with this goroutine.
+	// Take the signals over so that the worker is shut down exactly once, below, and waited for.
+	signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	if a.Sources != nil {
+		go wait.Until(func() {
+			a.reportProgress(a.Sources, dynamo, kclConfig.TableName, logger)
+		}, progressReportInterval, stopCh)
+	}
+	select {
+	case <-stopCh:
+	case <-sigs:
+	}
 	logger.Info("Shutting down.")
+
+	// Shutting the worker down waits for all of its shard consumers to exit, including the ones
+	// which lost their lease, once the batches in flight are delivered and checkpointed. Wait for
+	// that before exiting, so that a suspended or replaced receive adapter resumes exactly from the
+	// stored checkpoints.
+	drain(logger, worker.Shutdown, drainTimeout)
 	return nil
 }
 
+// newSession returns the AWS session and credentials to access the stream with.
+func (a *Adapter) newSession() (*session.Session, *credentials.Credentials, error) {
+	if len(a.CredsFile) > 0 {
+		sess := session.Must(session.NewSessionWithOptions(session.Options{
+			SharedConfigState: session.SharedConfigDisable,
+			Config:            aws.Config{Region: &a.Region},
+			SharedConfigFiles: []string{a.CredsFile},
+		}))
+		return sess, sess.Config.Credentials, nil
+	} else if len(a.KCLIAMRoleARN) > 0 {
+
+		sess := session.Must(session.NewSession())
+
+		// Create the credentials from AssumeRoleProvider to assume the role
+		// referenced by the "KCLIAMRoleARN" ARN.
+		return sess, stscreds.NewCredentials(sess, a.KCLIAMRoleARN), nil
+	}
+	return nil, nil, fmt.Errorf("Neither AWS_APPLICATION_CREDENTIALS nor KCL_IAM_ROLE_ARN is found in ENV")
+}
+
+// drain runs the given shutdown of the worker, and waits for it at most for the given timeout.
+func drain(logger *zap.SugaredLogger, shutdown func(), timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		shutdown()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Info("Shard consumers drained.")
+	case <-time.After(timeout):
+		logger.Warnf("Shard consumers not drained after %v.", timeout)
+	}
+}
+
 // Record processor factory is used to create RecordProcessor
 func recordProcessorFactory(adap *Adapter, logger *zap.SugaredLogger) kc.IRecordProcessorFactory {
 	return &sourceRecordProcessorFactory{adapter: adap, logger: logger}
@@ -184,34 +379,70 @@ func (s *sourceRecordProcessorFactory) CreateProcessor() kc.IRecordProcessor {
 type sourceRecordProcessor struct {
 	adapter *Adapter
 	logger  *zap.SugaredLogger
+	shardID string
+
+	// leaseLost is set once a checkpoint failed because another worker holds the lease.
+	leaseLost bool
 }
 
 func (s *sourceRecordProcessor) Initialize(input *kc.InitializationInput) {
+	s.shardID = input.ShardId
 	s.logger.Infof("Processing SharId: %v at checkpoint: %v", input.ShardId, aws.StringValue(input.ExtendedSequenceNumber.SequenceNumber))
 }
 
 func (s *sourceRecordProcessor) ProcessRecords(input *kc.ProcessRecordsInput) {
 
-	var err error
+	// Empty batches only refresh the lag of the shard, so that an idle shard is not reported as
+	// lagging behind after it caught up.
+	if len(input.Records) == 0 {
+		s.adapter.progress.polled(s.shardID, input.MillisBehindLatest)
+		return
+	}
 
 	logger := s.logger
 	logger.Info("Processing Records...")
 
-	// don't process empty record
-	if len(input.Records) == 0 {
-		return
+	// checkpoint it after processing this batch
+	lastRecordSequenceNumber := input.Records[len(input.Records)-1].SequenceNumber
+
+	// records older than the replay position are checkpointed without being delivered
+	input.Records = s.adapter.replayedRecords(input.Records)
+	if len(input.Records) > 0 {
+		// Aggregated records are expanded before being turned into events: a Kinesis record is
+		// only checkpointed once all of its events are delivered.
+		events := s.adapter.newEvents(s.shardID, newRecordBatch(input), logger)
+		delivered, err := s.adapter.deliver(events, logger)
+		if err != nil {
+			logger.Errorf("Failed to post message: %v", err)
+			s.adapter.sinkFailed(err)
+			// The Kinesis records whose events were all delivered are not delivered again after a
+			// restart.
+			if sequenceNumber := lastDelivered(events, delivered); sequenceNumber != nil {
+				s.checkpoint(input, sequenceNumber)
+			}
+			return
+		}
+		s.adapter.sinkSucceeded()
 	}
 
-	err = s.adapter.postMessage(input, s.logger)
-	if err != nil {
-		logger.Errorf("Failed to post message: %v", err)
+	s.checkpoint(input, lastRecordSequenceNumber)
+}
+
+// checkpoint stores the progress of the shard up to the given sequence number.
+func (s *sourceRecordProcessor) checkpoint(input *kc.ProcessRecordsInput, sequenceNumber *string) {
+	logger := s.logger
+	logger.Infof("Checkpoint progress at: %v,  MillisBehindLatest = %v", sequenceNumber, input.MillisBehindLatest)
+	if err := input.Checkpointer.Checkpoint(sequenceNumber); err != nil {
+		logger.Errorf("Failed to checkpoint: %v", err)
+		// The KCL stops consuming a shard whose lease is taken over without shutting its record
+		// processor down, a failed checkpoint is where the loss shows.
+		if err.Error() == wk.ErrLeaseNotAquired && !s.leaseLost {
+			s.leaseLost = true
+			s.adapter.eventf(corev1.EventTypeWarning, leaseLostReason, "Lost the lease of shard %s.", s.shardID)
+		}
 		return
 	}
-
-	// checkpoint it after processing this batch
-	lastRecordSequenceNumber := input.Records[len(input.Records)-1].SequenceNumber
-	logger.Infof("Checkpoint progress at: %v,  MillisBehindLatest = %v", lastRecordSequenceNumber, input.MillisBehindLatest)
-	input.Checkpointer.Checkpoint(lastRecordSequenceNumber)
+	s.adapter.progress.checkpointed(s.shardID, aws.StringValue(sequenceNumber), input.MillisBehindLatest)
 }
 
 func (s *sourceRecordProcessor) Shutdown(input *kc.ShutdownInput) {
@@ -222,12 +453,55 @@ func (s *sourceRecordProcessor) Shutdown(input *kc.ShutdownInput) {
 	// Failure to do will result in  KCL not making any further progress.
 	if input.ShutdownReason == kc.TERMINATE {
 		input.Checkpointer.Checkpoint(nil)
+		s.adapter.progress.ended(s.shardID)
+		s.adapter.eventf(corev1.EventTypeNormal, shardEndedReason, "Consumed shard %s entirely.", s.shardID)
 	}
 
 }
 
-// postMessage sends an Kinesis event to the SinkURI
-func (a *Adapter) postMessage(m *kc.ProcessRecordsInput, logger *zap.SugaredLogger) error {
+// replayedRecords returns the records which are not skipped by the replay.
+func (a *Adapter) replayedRecords(records []*kinesis.Record) []*kinesis.Record {
+	if a.Replay == nil || a.Replay.Timestamp == nil {
+		return records
+	}
+	kept := records[:0]
+	for _, record := range records {
+		if !a.Replay.skipped(record) {
+			kept = append(kept, record)
+		}
+	}
+	return kept
+}
+
+// recordBatch is the data of the events: the ProcessRecordsInput of the KCL. Once mapped, its
+// records are the ones reaching the end of the chain of EventMappers, with the records aggregated
+// by the Kinesis Producer Library expanded into their user records.
+type recordBatch struct {
+	CacheEntryTime     *time.Time
+	CacheExitTime      *time.Time
+	Records            []*Record
+	Checkpointer       kc.IRecordProcessorCheckpointer
+	MillisBehindLatest int64
+}
+
+func newRecordBatch(input *kc.ProcessRecordsInput) *recordBatch {
+	return &recordBatch{
+		CacheEntryTime:     input.CacheEntryTime,
+		CacheExitTime:      input.CacheExitTime,
+		Records:            kinesisRecords(input.Records),
+		Checkpointer:       input.Checkpointer,
+		MillisBehindLatest: input.MillisBehindLatest,
+	}
+}
+
+// postMessage sends an event to the SinkURI
+func (a *Adapter) postMessage(event cloudevents.Event) error {
+	_, err := a.client.Send(context.TODO(), event)
+	return err
+}
+
+// batchEvent returns the Kinesis event carrying a whole batch of records of a shard.
+func (a *Adapter) batchEvent(shardID string, m *recordBatch, logger *zap.SugaredLogger) cloudevents.Event {
 
 	sequenceNumber := m.Records[0].SequenceNumber
 	recordsCount := len(m.Records)
@@ -237,7 +511,7 @@ func (a *Adapter) postMessage(m *kc.ProcessRecordsInput, logger *zap.SugaredLogg
 	ext := map[string]interface{}{"Ext_KinesisSchemaVersion": extKinesisSchemaVersion, "Ext_EventSource": extEventSource, "Ext_EventName": extEventName, "Ext_EventSourceARN": *a.streamARN, "Ext_Region": a.Region}
 	logger.Infof("time ; %v", m.MillisBehindLatest)
 
-	event := cloudevents.Event{
+	return cloudevents.Event{
 		Context: cloudevents.EventContextV02{
 			ID:         eventID,
 			Type:       eventType,
@@ -245,8 +519,6 @@ func (a *Adapter) postMessage(m *kc.ProcessRecordsInput, logger *zap.SugaredLogg
 			Time:       &types.Timestamp{Time: time.Now().Add(-1 * time.Millisecond * time.Duration(m.MillisBehindLatest))},
 			Extensions: ext,
 		}.AsV02(),
-		Data: m,
+		Data: a.batchData(shardID, m),
 	}
-	_, err := a.client.Send(context.TODO(), event)
-	return err
 }
@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	ks "github.com/aws/aws-sdk-go/service/kinesis"
 	kc "github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
@@ -91,7 +92,7 @@ func TestPostMessage_ServeHTTP(t *testing.T) {
 				Checkpointer:       checkPointer,
 				MillisBehindLatest: 1000,
 			}
-			err = a.postMessage(m, zap.S())
+			err = a.postMessage(a.batchEvent("shard-0", newRecordBatch(m), zap.S()))
 
 			if tc.error && err == nil {
 				t.Errorf("expected error, but got %v", err)
@@ -141,3 +142,20 @@ func sinkAccepted(writer http.ResponseWriter, req *http.Request) {
 func sinkRejected(writer http.ResponseWriter, _ *http.Request) {
 	writer.WriteHeader(http.StatusRequestTimeout)
 }
+
+func TestDrain(t *testing.T) {
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	start := time.Now()
+	drain(zap.S(), func() { <-stuck }, 50*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected drain to wait for the timeout, but it returned after %v", elapsed)
+	}
+
+	start = time.Now()
+	drain(zap.S(), func() {}, 5*time.Second)
+	if elapsed := time.Since(start); elapsed >= 5*time.Second {
+		t.Errorf("expected drain to return once the worker shut down, but it waited %v", elapsed)
+	}
+}
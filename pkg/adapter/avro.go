@@ -0,0 +1,80 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/linkedin/goavro"
+)
+
+// avroDecoder decodes Avro data in the Confluent wire format: a zero byte, the 4-byte big-endian
+// ID of the schema in the schema registry, and the binary encoding of the data.
+type avroDecoder struct {
+	codecs map[uint32]*goavro.Codec
+}
+
+func newAvroDecoder(files map[string][]byte) (*avroDecoder, error) {
+	d := &avroDecoder{codecs: make(map[uint32]*goavro.Codec, len(files))}
+	for name, b := range files {
+		id, err := strconv.ParseUint(name, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Avro schema ID %q", name)
+		}
+		// The standard JSON codec writes the unions as the value of their branch, rather than
+		// wrapped in an object named after it.
+		codec, err := goavro.NewCodecForStandardJSONFull(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("invalid Avro schema %s: %v", name, err)
+		}
+		d.codecs[uint32(id)] = codec
+	}
+	return d, nil
+}
+
+func (d *avroDecoder) decode(b []byte) (json.RawMessage, string, error) {
+	if len(b) < 5 || b[0] != 0 {
+		return nil, "", errors.New("not in the Confluent wire format")
+	}
+	id := binary.BigEndian.Uint32(b[1:5])
+	codec, ok := d.codecs[id]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown Avro schema %d", id)
+	}
+
+	v, rest, err := codec.NativeFromBinary(b[5:])
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid Avro data: %v", err)
+	}
+	if len(rest) > 0 {
+		return nil, "", errors.New("invalid Avro data: trailing bytes")
+	}
+	text, err := codec.TextualFromNative(nil, v)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid Avro data: %v", err)
+	}
+	// The codec writes the fields of the records in no particular order.
+	res, err := sortedJSON(text)
+	if err != nil {
+		return nil, "", err
+	}
+	return res, strconv.FormatUint(uint64(id), 10), nil
+}
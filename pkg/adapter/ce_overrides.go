@@ -0,0 +1,195 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents"
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+)
+
+// ceOverrides is the compiled CEOverrides of the adapter: the parsed templates, nil for the
+// attributes which are not overridden.
+type ceOverrides struct {
+	typ, source, subject *ceTemplate
+	extensions           map[string]*ceTemplate
+}
+
+// ceTemplate is a parsed template, along with the parsed JSONPath expressions of its parts.
+type ceTemplate struct {
+	parts []v1alpha1.TemplatePart
+	paths []*jsonPath
+}
+
+// templateContext is what the placeholders of the templates are replaced with. The record is nil
+// for the events of batches.
+type templateContext struct {
+	stream string
+	shard  string
+	record *Record
+	event  *cloudevents.Event
+
+	// data is the JSON data of the event, decoded on first use.
+	data    interface{}
+	decoded bool
+}
+
+// compileCEOverrides parses the templates of the overrides.
+func compileCEOverrides(spec *v1alpha1.CEOverrides) (*ceOverrides, error) {
+	o := &ceOverrides{extensions: make(map[string]*ceTemplate, len(spec.Extensions))}
+	var err error
+	if o.typ, err = compileTemplate(spec.Type); err != nil {
+		return nil, err
+	}
+	if o.source, err = compileTemplate(spec.Source); err != nil {
+		return nil, err
+	}
+	if o.subject, err = compileTemplate(spec.Subject); err != nil {
+		return nil, err
+	}
+	for name, value := range spec.Extensions {
+		if o.extensions[name], err = compileTemplate(value); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+func compileTemplate(s string) (*ceTemplate, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts, err := v1alpha1.ParseTemplate(s)
+	if err != nil {
+		return nil, err
+	}
+	t := &ceTemplate{parts: parts, paths: make([]*jsonPath, len(parts))}
+	for i, part := range parts {
+		if part.Path == "" {
+			continue
+		}
+		if t.paths[i], err = compileJSONPath(part.Path); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// apply overrides the attributes of an event. An attribute keeps its value when a lookup without
+// fallback fails, or when the source is not a URI reference.
+func (o *ceOverrides) apply(event *cloudevents.Event, stream, shard string, record *Record) {
+	if o == nil {
+		return
+	}
+	ctx := &templateContext{stream: stream, shard: shard, record: record, event: event}
+	if v, ok := o.typ.execute(ctx); ok && v != "" {
+		event.SetType(v)
+	}
+	if v, ok := o.source.execute(ctx); ok && v != "" {
+		// The source is left as is when it is invalid.
+		_ = event.Context.SetSource(v)
+	}
+	if v, ok := o.subject.execute(ctx); ok {
+		event.SetSubject(v)
+	}
+	for name, t := range o.extensions {
+		if v, ok := t.execute(ctx); ok {
+			event.SetExtension(name, v)
+		}
+	}
+}
+
+// overrideEvents is the middleware overriding the attributes of the events of the records.
+func (a *Adapter) overrideEvents(next EventMapper) EventMapper {
+	return EventMapperFunc(func(shard *Shard, record *Record) ([]cloudevents.Event, error) {
+		events, err := next.MapRecord(shard, record)
+		for i := range events {
+			a.overrides.apply(&events[i], shard.StreamName, shard.ID, record)
+		}
+		return events, err
+	})
+}
+
+// execute returns the value of the template, or false if the template is nil or a lookup without
+// fallback fails.
+func (t *ceTemplate) execute(ctx *templateContext) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	var b strings.Builder
+	for i, part := range t.parts {
+		if part.Literal != "" {
+			b.WriteString(part.Literal)
+			continue
+		}
+		v, ok := ctx.lookup(part, t.paths[i])
+		if !ok {
+			if part.Fallback == nil {
+				return "", false
+			}
+			v = *part.Fallback
+		}
+		b.WriteString(v)
+	}
+	return b.String(), true
+}
+
+// lookup returns the value of a placeholder.
+func (ctx *templateContext) lookup(part v1alpha1.TemplatePart, path *jsonPath) (string, bool) {
+	switch part.Variable {
+	case v1alpha1.TemplateVariableStream:
+		return ctx.stream, true
+	case v1alpha1.TemplateVariableShard:
+		return ctx.shard, true
+	case v1alpha1.TemplateVariablePartitionKey:
+		if ctx.record == nil || ctx.record.PartitionKey == nil {
+			return "", false
+		}
+		return aws.StringValue(ctx.record.PartitionKey), true
+	}
+
+	if ctx.record == nil {
+		return "", false
+	}
+	if !ctx.decoded {
+		ctx.decoded = true
+		ctx.data, _ = eventJSON(ctx.event)
+	}
+	if ctx.data == nil {
+		return "", false
+	}
+	results, err := path.findResults(ctx.data)
+	if err != nil || len(results) == 0 || len(results[0]) == 0 {
+		return "", false
+	}
+	return jsonText(results[0][0])
+}
+
+// eventJSON returns the decoded data of an event, or an error if it is not JSON.
+func eventJSON(event *cloudevents.Event) (interface{}, error) {
+	b, ok := event.Data.([]byte)
+	if !ok || !event.DataEncoded {
+		var err error
+		if b, err = json.Marshal(event.Data); err != nil {
+			return nil, err
+		}
+	}
+	return decodeJSON(b)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	ks "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	"go.uber.org/zap"
+)
+
+func TestCEOverrides(t *testing.T) {
+	type attributes struct {
+		Type, Source, Subject, Tenant, Shard string
+	}
+	overrides := &v1alpha1.CEOverrides{
+		Type:       "com.acme.${$.detail.type:-unknown}",
+		Source:     "/streams/${stream}",
+		Subject:    "${partitionKey}/${$.id}",
+		Extensions: map[string]string{"tenant": "${$.tenant}", "shard": "${shard}"},
+	}
+	testCases := map[string]struct {
+		payloadFormat string
+		data          string
+		want          attributes
+	}{
+		"record": {
+			payloadFormat: PayloadFormatRecord,
+			data:          `{"id":42,"tenant":"t1","detail":{"type":"created"}}`,
+			want:          attributes{Type: "com.acme.created", Source: "/streams/orders", Subject: "p/42", Tenant: "t1", Shard: "shard-0"},
+		},
+		"fallback": {
+			payloadFormat: PayloadFormatRecord,
+			data:          `{"id":"a"}`,
+			want:          attributes{Type: "com.acme.unknown", Source: "/streams/orders", Subject: "p/a", Shard: "shard-0"},
+		},
+		"not JSON": {
+			payloadFormat: PayloadFormatRecord,
+			data:          "plain text",
+			want:          attributes{Type: "com.acme.unknown", Source: "/streams/orders", Shard: "shard-0"},
+		},
+		"batch": {
+			data: `{"id":42,"tenant":"t1","detail":{"type":"created"}}`,
+			want: attributes{Type: "com.acme.unknown", Source: "/streams/orders", Shard: "shard-0"},
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			streamARN := "arn:aws:kinesis:us-west-2:4444444:stream/orders"
+			a := &Adapter{
+				StreamName:    "orders",
+				streamARN:     &streamARN,
+				PayloadFormat: tc.payloadFormat,
+				CEOverrides:   overrides,
+			}
+			var err error
+			if a.overrides, err = compileCEOverrides(a.CEOverrides); err != nil {
+				t.Fatalf("failed to compile the overrides: %v", err)
+			}
+
+			events := a.newEvents("shard-0", &recordBatch{Records: []*Record{
+				{Record: ks.Record{Data: []byte(tc.data), SequenceNumber: aws.String("1"), PartitionKey: aws.String("p")}},
+			}}, zap.S())
+			if len(events) != 1 {
+				t.Fatalf("expected 1 event, but got %d", len(events))
+			}
+
+			event := events[0].event
+			got := attributes{Type: event.Type(), Source: event.Source(), Subject: event.Subject()}
+			event.ExtensionAs("tenant", &got.Tenant)
+			event.ExtensionAs("shard", &got.Shard)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected attributes (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
+
+// TestCEOverridesConcurrently overrides the attributes of events from several goroutines, as the
+// record processors of the shards do. Run with -race.
+func TestCEOverridesConcurrently(t *testing.T) {
+	o, err := compileCEOverrides(&v1alpha1.CEOverrides{Type: "com.acme.${$.detail.type}", Subject: "${$.id}"})
+	if err != nil {
+		t.Fatalf("failed to compile the overrides: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := strconv.Itoa(i)
+			for j := 0; j < 100; j++ {
+				event := cloudevents.Event{
+					Context: cloudevents.EventContextV02{
+						ID:     id,
+						Type:   "com.amazon.kinesis.record",
+						Source: *types.ParseURLRef("/orders"),
+					}.AsV02(),
+					Data: map[string]interface{}{"id": id, "detail": map[string]string{"type": "created"}},
+				}
+				o.apply(&event, "orders", "shard-0", &Record{})
+				if event.Type() != "com.acme.created" || event.Subject() != id {
+					errs <- fmt.Sprintf("unexpected attributes %q and %q", event.Type(), event.Subject())
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
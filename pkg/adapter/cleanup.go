@@ -0,0 +1,111 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/knative/pkg/logging"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// Cleanup deletes the AWS resources created for the consumer: the DynamoDB lease table named
+// after it and the stream consumers registered under its name. It is run once the source is
+// deleted, with the receive adapter stopped.
+func (a *Adapter) Cleanup(ctx context.Context) error {
+	logger := logging.FromContext(ctx)
+
+	sess, creds, err := a.newSession()
+	if err != nil {
+		return err
+	}
+	config := &aws.Config{Credentials: creds, Region: aws.String(a.Region)}
+
+	if err := a.deleteLeaseTable(dynamodb.New(sess, config), logger); err != nil {
+		logger.Error("Failed to delete the lease table", zap.Error(err))
+		return err
+	}
+	if err := a.deregisterConsumers(kinesis.New(sess, config), logger); err != nil {
+		logger.Error("Failed to deregister the stream consumers", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// deleteLeaseTable deletes the lease table of the consumer, if it exists.
+func (a *Adapter) deleteLeaseTable(dynamo dynamodbiface.DynamoDBAPI, logger *zap.SugaredLogger) error {
+	table := aws.String(a.ConsumerName)
+	_, err := dynamo.DeleteTable(&dynamodb.DeleteTableInput{TableName: table})
+	if isNotFound(err) {
+		logger.Infof("Lease table %q not found.", a.ConsumerName)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	logger.Infof("Lease table %q deleted.", a.ConsumerName)
+	return dynamo.WaitUntilTableNotExists(&dynamodb.DescribeTableInput{TableName: table})
+}
+
+// deregisterConsumers deregisters the enhanced fan-out consumers registered on the stream under
+// the name of the consumer, if the stream still exists.
+func (a *Adapter) deregisterConsumers(kc kinesisiface.KinesisAPI, logger *zap.SugaredLogger) error {
+	stream, err := kc.DescribeStream(&kinesis.DescribeStreamInput{StreamName: aws.String(a.StreamName)})
+	if isNotFound(err) {
+		logger.Infof("Stream %q not found.", a.StreamName)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	input := &kinesis.ListStreamConsumersInput{StreamARN: stream.StreamDescription.StreamARN}
+	for {
+		out, err := kc.ListStreamConsumers(input)
+		if err != nil {
+			return err
+		}
+		for _, consumer := range out.Consumers {
+			if aws.StringValue(consumer.ConsumerName) != a.ConsumerName {
+				continue
+			}
+			_, err := kc.DeregisterStreamConsumer(&kinesis.DeregisterStreamConsumerInput{ConsumerARN: consumer.ConsumerARN})
+			if err != nil && !isNotFound(err) {
+				return err
+			}
+			logger.Infof("Stream consumer %q deregistered.", aws.StringValue(consumer.ConsumerARN))
+		}
+		if out.NextToken == nil {
+			return nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
+
+// isNotFound reports whether err is a resource not found error of DynamoDB or Kinesis.
+func isNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	return aerr.Code() == dynamodb.ErrCodeResourceNotFoundException || aerr.Code() == kinesis.ErrCodeResourceNotFoundException
+}
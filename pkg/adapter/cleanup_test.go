@@ -0,0 +1,127 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	ks "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+)
+
+func TestDeleteLeaseTable(t *testing.T) {
+	a := &Adapter{ConsumerName: "consumer"}
+
+	dynamo := &fakeDynamoDB{table: "consumer", items: map[string]string{"shardId-0": "100"}}
+	if err := a.deleteLeaseTable(dynamo, zap.NewNop().Sugar()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dynamo.table != "" {
+		t.Errorf("expected the lease table to be deleted")
+	}
+
+	// Deleting a missing table succeeds.
+	if err := a.deleteLeaseTable(dynamo, zap.NewNop().Sugar()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDeregisterConsumers(t *testing.T) {
+	a := &Adapter{StreamName: "kinesis-name", ConsumerName: "consumer"}
+
+	kc := &fakeKinesis{
+		stream: "kinesis-name",
+		pages: [][]string{
+			{"consumer", "other"},
+			{"consumer-2", "consumer"},
+		},
+	}
+	if err := a.deregisterConsumers(kc, zap.NewNop().Sugar()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"arn:consumer/0/0", "arn:consumer/1/1"}
+	if diff := cmp.Diff(want, kc.deregistered); diff != "" {
+		t.Errorf("unexpected deregistered consumers (-want, +got) = %v", diff)
+	}
+
+	// Nothing is deregistered from a missing stream.
+	kc = &fakeKinesis{}
+	if err := a.deregisterConsumers(kc, zap.NewNop().Sugar()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func (f *fakeDynamoDB) DeleteTable(input *dynamodb.DeleteTableInput) (*dynamodb.DeleteTableOutput, error) {
+	if aws.StringValue(input.TableName) != f.table {
+		return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "table not found", nil)
+	}
+	f.table = ""
+	f.items = nil
+	return &dynamodb.DeleteTableOutput{}, nil
+}
+
+func (f *fakeDynamoDB) WaitUntilTableNotExists(input *dynamodb.DescribeTableInput) error {
+	return nil
+}
+
+// fakeKinesis is a stream with consumers listed by pages of names. The ARN of a consumer is
+// made of its name and position.
+type fakeKinesis struct {
+	kinesisiface.KinesisAPI
+
+	stream       string
+	pages        [][]string
+	deregistered []string
+}
+
+func (f *fakeKinesis) DescribeStream(input *ks.DescribeStreamInput) (*ks.DescribeStreamOutput, error) {
+	if aws.StringValue(input.StreamName) != f.stream {
+		return nil, awserr.New(ks.ErrCodeResourceNotFoundException, "stream not found", nil)
+	}
+	return &ks.DescribeStreamOutput{
+		StreamDescription: &ks.StreamDescription{StreamARN: aws.String("arn:" + f.stream)},
+	}, nil
+}
+
+func (f *fakeKinesis) ListStreamConsumers(input *ks.ListStreamConsumersInput) (*ks.ListStreamConsumersOutput, error) {
+	page := 0
+	if input.NextToken != nil {
+		page = int(aws.StringValue(input.NextToken)[0] - '0')
+	}
+	out := &ks.ListStreamConsumersOutput{}
+	for i, name := range f.pages[page] {
+		out.Consumers = append(out.Consumers, &ks.Consumer{
+			ConsumerName: aws.String(name),
+			ConsumerARN:  aws.String(fmt.Sprintf("arn:%s/%d/%d", name, page, i)),
+		})
+	}
+	if page+1 < len(f.pages) {
+		out.NextToken = aws.String(fmt.Sprintf("%d", page+1))
+	}
+	return out, nil
+}
+
+func (f *fakeKinesis) DeregisterStreamConsumer(input *ks.DeregisterStreamConsumerInput) (*ks.DeregisterStreamConsumerOutput, error) {
+	f.deregistered = append(f.deregistered, aws.StringValue(input.ConsumerARN))
+	return &ks.DeregisterStreamConsumerOutput{}, nil
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cloudevents/sdk-go/pkg/cloudevents"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents/types"
+)
+
+const (
+	cloudWatchLogsEventType = "aws.cloudwatch.logs.event"
+
+	// Extensions holding the log group and log stream of the log events.
+	extLogGroup  = "loggroup"
+	extLogStream = "logstream"
+
+	// controlMessageType is the message type of the records CloudWatch Logs writes to check that
+	// the stream is reachable, they hold no log events.
+	controlMessageType = "CONTROL_MESSAGE"
+)
+
+// logsData is the gzipped payload of the records written by CloudWatch Logs subscription filters.
+type logsData struct {
+	MessageType         string     `json:"messageType"`
+	Owner               string     `json:"owner"`
+	LogGroup            string     `json:"logGroup"`
+	LogStream           string     `json:"logStream"`
+	SubscriptionFilters []string   `json:"subscriptionFilters"`
+	LogEvents           []logEvent `json:"logEvents"`
+}
+
+type logEvent struct {
+	ID        string `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+// cloudWatchLogsEvents returns the events of the log events of a record, none for control
+// messages.
+func (a *Adapter) cloudWatchLogsEvents(record *Record) ([]cloudevents.Event, error) {
+	data, err := decodeLogsData(record.Data)
+	if err != nil {
+		return nil, err
+	}
+	if data.MessageType == controlMessageType {
+		return nil, nil
+	}
+	events := make([]cloudevents.Event, 0, len(data.LogEvents))
+	for _, e := range data.LogEvents {
+		events = append(events, a.logEventEvent(data, e))
+	}
+	return events, nil
+}
+
+// decodeLogsData decodes the payload of a record, which is only gzipped when it was not
+// decompressed already.
+func decodeLogsData(b []byte) (*logsData, error) {
+	if sniffCompression(b) == CompressionGzip {
+		var err error
+		if b, err = decompress(CompressionGzip, b); err != nil {
+			return nil, fmt.Errorf("not a CloudWatch Logs payload: %v", err)
+		}
+	}
+	data := &logsData{}
+	if err := json.Unmarshal(b, data); err != nil {
+		return nil, fmt.Errorf("not a CloudWatch Logs payload: %v", err)
+	}
+	return data, nil
+}
+
+// logEventEvent returns the event of a log event. Its data is the message, kept as is when it is
+// JSON, and as a JSON string otherwise.
+func (a *Adapter) logEventEvent(data *logsData, e logEvent) cloudevents.Event {
+	var message interface{} = e.Message
+	if json.Valid([]byte(e.Message)) {
+		message = json.RawMessage(e.Message)
+	}
+	return cloudevents.Event{
+		Context: cloudevents.EventContextV02{
+			ID:     e.ID,
+			Type:   cloudWatchLogsEventType,
+			Source: *types.ParseURLRef(fmt.Sprintf("/%s", *a.streamARN)),
+			Time:   &types.Timestamp{Time: time.Unix(0, e.Timestamp*int64(time.Millisecond)).UTC()},
+			Extensions: map[string]interface{}{
+				extLogGroup:  data.LogGroup,
+				extLogStream: data.LogStream,
+			},
+		}.AsV02(),
+		Data: message,
+	}
+}
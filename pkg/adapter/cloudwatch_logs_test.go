@@ -0,0 +1,132 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	ks "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/google/go-cmp/cmp"
+	kc "github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+	"go.uber.org/zap"
+)
+
+func TestProcessCloudWatchLogs(t *testing.T) {
+	type delivery struct {
+		ID, Time, LogGroup, LogStream, Body string
+	}
+	all := []delivery{
+		{ID: "e1", Time: "2019-05-01T10:00:00Z", LogGroup: `"group-a"`, LogStream: `"stream-a"`, Body: `{"level":"info"}`},
+		{ID: "e2", Time: "2019-05-01T10:00:01.5Z", LogGroup: `"group-a"`, LogStream: `"stream-a"`, Body: `"plain text"`},
+		{ID: "e3", Time: "2019-05-01T10:00:02Z", LogGroup: `"group-b"`, LogStream: `"stream-b"`, Body: `"other"`},
+	}
+	testCases := map[string]struct {
+		failAt         int
+		wantDeliveries []delivery
+		wantCheckpoint *string
+	}{
+		"delivered": {
+			wantDeliveries: all,
+			wantCheckpoint: aws.String("5"),
+		},
+		"failed within a record": {
+			failAt:         2,
+			wantDeliveries: all[:1],
+		},
+		"failed after a record": {
+			failAt:         3,
+			wantDeliveries: all[:2],
+			wantCheckpoint: aws.String("2"),
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			var deliveries []delivery
+			sinkServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if len(deliveries)+1 == tc.failAt {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				body, _ := ioutil.ReadAll(r.Body)
+				deliveries = append(deliveries, delivery{
+					ID:        r.Header.Get("Ce-Id"),
+					Time:      r.Header.Get("Ce-Time"),
+					LogGroup:  r.Header.Get("Ce-Loggroup"),
+					LogStream: r.Header.Get("Ce-Logstream"),
+					Body:      string(body),
+				})
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer sinkServer.Close()
+
+			streamARN := "arn:aws:kinesis:us-west-2:4444444:stream/kinesis-name"
+			a := &Adapter{
+				SinkURI:       sinkServer.URL,
+				streamARN:     &streamARN,
+				PayloadFormat: PayloadFormatCloudWatchLogs,
+				progress:      newProgress(),
+			}
+			if err := a.initClient(); err != nil {
+				t.Fatalf("failed to create cloudevent client, %v", err)
+			}
+
+			checkpointer := &fakeCheckpointer{}
+			p := &sourceRecordProcessor{adapter: a, logger: zap.S(), shardID: "shard-0"}
+			p.ProcessRecords(&kc.ProcessRecordsInput{
+				Records: []*ks.Record{
+					{Data: gzipLogsData(t, logsData{MessageType: controlMessageType}), SequenceNumber: aws.String("1")},
+					{Data: gzipLogsData(t, logsData{MessageType: "DATA_MESSAGE", LogGroup: "group-a", LogStream: "stream-a", LogEvents: []logEvent{
+						{ID: "e1", Timestamp: 1556704800000, Message: `{"level":"info"}`},
+						{ID: "e2", Timestamp: 1556704801500, Message: "plain text"},
+					}}), SequenceNumber: aws.String("2")},
+					{Data: []byte("not gzipped"), SequenceNumber: aws.String("3")},
+					{Data: gzipLogsData(t, logsData{MessageType: "DATA_MESSAGE", LogGroup: "group-b", LogStream: "stream-b", LogEvents: []logEvent{
+						{ID: "e3", Timestamp: 1556704802000, Message: "other"},
+					}}), SequenceNumber: aws.String("4")},
+					{Data: gzipLogsData(t, logsData{MessageType: controlMessageType}), SequenceNumber: aws.String("5")},
+				},
+				Checkpointer: checkpointer,
+			})
+
+			if diff := cmp.Diff(tc.wantDeliveries, deliveries); diff != "" {
+				t.Errorf("unexpected deliveries (-want, +got) = %v", diff)
+			}
+			if diff := cmp.Diff(tc.wantCheckpoint, checkpointer.sequenceNumber); diff != "" {
+				t.Errorf("unexpected checkpoint (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func gzipLogsData(t *testing.T, data logsData) []byte {
+	b, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
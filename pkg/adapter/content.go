@@ -0,0 +1,292 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents/types"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	kc "github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+)
+
+// Content types of the data of the records.
+const (
+	DataContentTypeJSON   = "application/json"
+	DataContentTypeText   = "text/plain"
+	DataContentTypeBinary = "application/octet-stream"
+)
+
+// Compressions of the data of the records.
+const (
+	CompressionNone   = "none"
+	CompressionGzip   = "gzip"
+	CompressionZlib   = "zlib"
+	CompressionSnappy = "snappy"
+	CompressionZstd   = "zstd"
+
+	// CompressionAuto tells the compression by the magic bytes of the data, and keeps the data as
+	// is when it is not compressed or fails to decompress.
+	CompressionAuto = "auto"
+)
+
+const (
+	recordEventType = "aws.kinesis.record"
+
+	// extPartitionKey is the extension holding the partition key of a record.
+	extPartitionKey = "partitionkey"
+)
+
+// checkContent returns an error if the content type or the compression is unknown.
+func (a *Adapter) checkContent() error {
+	switch a.DataContentType {
+	case "", DataContentTypeJSON, DataContentTypeText, DataContentTypeBinary:
+	default:
+		return fmt.Errorf("unknown data content type %q", a.DataContentType)
+	}
+	switch a.Compression {
+	case "", CompressionNone, CompressionGzip, CompressionZlib, CompressionSnappy, CompressionZstd, CompressionAuto:
+	default:
+		return fmt.Errorf("unknown compression %q", a.Compression)
+	}
+	return nil
+}
+
+// decodeRecord returns the record with its data decompressed, decoded to JSON with the schemas,
+// and checked against the content type. The record is returned as is when its data is not decoded.
+func (a *Adapter) decodeRecord(record *Record) (*Record, error) {
+	if !a.decodesData() {
+		return record, nil
+	}
+	b, err := decompress(a.Compression, record.Data)
+	if err != nil {
+		return nil, err
+	}
+	decoded := *record
+	if a.decoder != nil {
+		var id string
+		if b, id, err = a.decoder.decode(b); err != nil {
+			return nil, err
+		}
+		decoded.dataSchema = a.Schema.dataSchema(id)
+	}
+	switch a.DataContentType {
+	case DataContentTypeJSON:
+		if !json.Valid(b) {
+			return nil, errors.New("data is not JSON")
+		}
+	case DataContentTypeText:
+		if !utf8.Valid(b) {
+			return nil, errors.New("data is not UTF-8 text")
+		}
+	}
+	decoded.Data = b
+	return &decoded, nil
+}
+
+// decodeRecords is the middleware decoding the records with decodeRecord.
+func (a *Adapter) decodeRecords(next EventMapper) EventMapper {
+	return EventMapperFunc(func(shard *Shard, record *Record) ([]cloudevents.Event, error) {
+		decoded, err := a.decodeRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		return next.MapRecord(shard, decoded)
+	})
+}
+
+// decodesData tells whether the data of the records is decompressed, decoded or checked.
+func (a *Adapter) decodesData() bool {
+	compressed := a.Compression != "" && a.Compression != CompressionNone
+	return compressed || a.decoder != nil || a.DataContentType == DataContentTypeJSON || a.DataContentType == DataContentTypeText
+}
+
+var (
+	// snappyStreamID starts the snappy framing format.
+	snappyStreamID = []byte("\xff\x06\x00\x00sNaPpY")
+
+	// zstdMagic starts a zstd frame.
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	// zstdDecoder decompresses zstd data, it is safe for concurrent use. Creating it without
+	// options does not fail.
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// decompress decompresses data with the given compression.
+func decompress(compression string, b []byte) ([]byte, error) {
+	switch compression {
+	case CompressionAuto:
+		compression = sniffCompression(b)
+		if compression == CompressionNone {
+			return b, nil
+		}
+		if data, err := decompress(compression, b); err == nil {
+			return data, nil
+		}
+		return b, nil
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip data: %v", err)
+		}
+		return readAll(r, "gzip")
+	case CompressionZlib:
+		r, err := zlib.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zlib data: %v", err)
+		}
+		return readAll(r, "zlib")
+	case CompressionSnappy:
+		// The snappy block format has no header to be told apart by.
+		if !bytes.HasPrefix(b, snappyStreamID) {
+			data, err := snappy.Decode(nil, b)
+			if err != nil {
+				return nil, fmt.Errorf("invalid snappy data: %v", err)
+			}
+			return data, nil
+		}
+		return readAll(ioutil.NopCloser(snappy.NewReader(bytes.NewReader(b))), "snappy")
+	case CompressionZstd:
+		data, err := zstdDecoder.DecodeAll(b, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd data: %v", err)
+		}
+		return data, nil
+	}
+	return b, nil
+}
+
+func readAll(r io.ReadCloser, compression string) ([]byte, error) {
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s data: %v", compression, err)
+	}
+	return b, nil
+}
+
+// sniffCompression returns the compression of data, as told by its magic bytes.
+func sniffCompression(b []byte) string {
+	switch {
+	case len(b) >= 2 && b[0] == 0x1f && b[1] == 0x8b:
+		return CompressionGzip
+	case len(b) >= 2 && b[0]&0x0f == 8 && b[0]>>4 <= 7 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0:
+		// Deflate with a valid window size and header checksum.
+		return CompressionZlib
+	case bytes.HasPrefix(b, snappyStreamID):
+		return CompressionSnappy
+	case bytes.HasPrefix(b, zstdMagic):
+		return CompressionZstd
+	}
+	return CompressionNone
+}
+
+// encodedRecord is a record whose data is embedded in the JSON events as JSON or as a string,
+// rather than base64-encoded.
+type encodedRecord struct {
+	*Record
+	Data interface{}
+}
+
+// encodedBatch is a recordBatch whose records are encodedRecords.
+type encodedBatch struct {
+	CacheEntryTime     *time.Time
+	CacheExitTime      *time.Time
+	Records            []encodedRecord
+	Checkpointer       kc.IRecordProcessorCheckpointer
+	MillisBehindLatest int64
+}
+
+// batchData returns the data of the Kinesis event of a batch of a shard, as defined by the payload
+// format and the content type.
+func (a *Adapter) batchData(shardID string, m *recordBatch) interface{} {
+	if a.PayloadFormat == PayloadFormatLambda {
+		return a.lambdaEvent(shardID, m)
+	}
+	if a.DataContentType != DataContentTypeJSON && a.DataContentType != DataContentTypeText {
+		return m
+	}
+	encoded := &encodedBatch{
+		CacheEntryTime:     m.CacheEntryTime,
+		CacheExitTime:      m.CacheExitTime,
+		Records:            make([]encodedRecord, 0, len(m.Records)),
+		Checkpointer:       m.Checkpointer,
+		MillisBehindLatest: m.MillisBehindLatest,
+	}
+	for _, record := range m.Records {
+		var data interface{} = string(record.Data)
+		if a.DataContentType == DataContentTypeJSON {
+			data = json.RawMessage(record.Data)
+		}
+		encoded.Records = append(encoded.Records, encodedRecord{Record: record, Data: data})
+	}
+	return encoded
+}
+
+// recordID returns the ID of the event of a record: its sequence number, followed by its
+// subsequence number for the user records aggregated by the Kinesis Producer Library.
+func recordID(record *Record) string {
+	id := aws.StringValue(record.SequenceNumber)
+	if record.SubSequenceNumber != nil {
+		id = fmt.Sprintf("%s:%d", id, *record.SubSequenceNumber)
+	}
+	return id
+}
+
+// kinesisRecordEvents returns the event of a record, whose body is the data of the record. The
+// data decoded with a schema is JSON, and refers to its schema.
+func (a *Adapter) kinesisRecordEvents(record *Record) ([]cloudevents.Event, error) {
+	event := cloudevents.Event{
+		Context: cloudevents.EventContextV02{
+			ID:     recordID(record),
+			Type:   recordEventType,
+			Source: *types.ParseURLRef(fmt.Sprintf("/%s", *a.streamARN)),
+			Extensions: map[string]interface{}{
+				extPartitionKey: aws.StringValue(record.PartitionKey),
+			},
+		}.AsV02(),
+		// The data is sent as is.
+		Data:        record.Data,
+		DataEncoded: true,
+	}
+	if record.ApproximateArrivalTimestamp != nil {
+		event.SetTime(*record.ApproximateArrivalTimestamp)
+	}
+	contentType := a.DataContentType
+	if record.dataSchema != "" {
+		event.SetSchemaURL(record.dataSchema)
+		contentType = DataContentTypeJSON
+	}
+	if contentType == "" {
+		contentType = DataContentTypeBinary
+	}
+	event.SetDataContentType(contentType)
+	return []cloudevents.Event{event}, nil
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	ks "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/golang/snappy"
+	"github.com/google/go-cmp/cmp"
+	"github.com/klauspost/compress/zstd"
+	kc "github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+	"go.uber.org/zap"
+)
+
+func TestDecompress(t *testing.T) {
+	const text = "abcabcabcabc"
+	block := snappy.Encode(nil, []byte(text))
+
+	testCases := map[string]struct {
+		compression string
+		data        []byte
+		want        string
+		wantErr     bool
+	}{
+		"gzip": {
+			compression: CompressionGzip,
+			data:        gzipData(text),
+			want:        text,
+		},
+		"zlib": {
+			compression: CompressionZlib,
+			data:        zlibData(text),
+			want:        text,
+		},
+		"snappy block": {
+			compression: CompressionSnappy,
+			data:        block,
+			want:        text,
+		},
+		"snappy frames": {
+			compression: CompressionSnappy,
+			data:        snappyFrames(text),
+			want:        text,
+		},
+		"zstd": {
+			compression: CompressionZstd,
+			data:        zstdData(text),
+			want:        text,
+		},
+		"auto gzip": {
+			compression: CompressionAuto,
+			data:        gzipData(text),
+			want:        text,
+		},
+		"auto zlib": {
+			compression: CompressionAuto,
+			data:        zlibData(text),
+			want:        text,
+		},
+		"auto snappy": {
+			compression: CompressionAuto,
+			data:        snappyFrames(text),
+			want:        text,
+		},
+		"auto zstd": {
+			compression: CompressionAuto,
+			data:        zstdData(text),
+			want:        text,
+		},
+		"auto uncompressed": {
+			compression: CompressionAuto,
+			data:        []byte(`{"key":"value"}`),
+			want:        `{"key":"value"}`,
+		},
+		"auto corrupted": {
+			compression: CompressionAuto,
+			data:        []byte{0x1f, 0x8b, 0, 1, 2},
+			want:        "\x1f\x8b\x00\x01\x02",
+		},
+		"invalid gzip": {
+			compression: CompressionGzip,
+			data:        []byte(text),
+			wantErr:     true,
+		},
+		"invalid snappy offset": {
+			// A literal "abc" followed by a copy of 9 bytes at offset 4.
+			compression: CompressionSnappy,
+			data:        []byte{12, 2 << 2, 'a', 'b', 'c', 5<<2 | 1, 4},
+			wantErr:     true,
+		},
+		"corrupted snappy frame": {
+			compression: CompressionSnappy,
+			data:        corrupt(snappyFrames(text)),
+			wantErr:     true,
+		},
+		"corrupted zstd frame": {
+			compression: CompressionZstd,
+			data:        corrupt(zstdData(text)),
+			wantErr:     true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			got, err := decompress(tc.compression, tc.data)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, but got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("expected %q, but got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestProcessRecordsContent(t *testing.T) {
+	testCases := map[string]struct {
+		payloadFormat   string
+		dataContentType string
+		wantContentType []string
+		wantBodies      []string
+	}{
+		"binary records": {
+			payloadFormat:   PayloadFormatRecord,
+			wantContentType: []string{"application/octet-stream", "application/octet-stream"},
+			wantBodies:      []string{`{"key":"value"}`, "plain text"},
+		},
+		"json records": {
+			payloadFormat:   PayloadFormatRecord,
+			dataContentType: DataContentTypeJSON,
+			wantContentType: []string{"application/json"},
+			wantBodies:      []string{`{"key":"value"}`},
+		},
+		"text batch": {
+			dataContentType: DataContentTypeText,
+			wantContentType: []string{"application/json"},
+			wantBodies: []string{`{"CacheEntryTime":null,"CacheExitTime":null,"Records":[` +
+				`{"ApproximateArrivalTimestamp":null,"EncryptionType":null,"PartitionKey":"p","SequenceNumber":"1","Data":"{\"key\":\"value\"}"},` +
+				`{"ApproximateArrivalTimestamp":null,"EncryptionType":null,"PartitionKey":"p","SequenceNumber":"2","Data":"plain text"}],` +
+				`"Checkpointer":{"IRecordProcessorCheckpointer":null},"MillisBehindLatest":0}`},
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			var contentTypes, bodies []string
+			sinkServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+				bodies = append(bodies, string(body))
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer sinkServer.Close()
+
+			streamARN := "arn:aws:kinesis:us-west-2:4444444:stream/kinesis-name"
+			a := &Adapter{
+				SinkURI:         sinkServer.URL,
+				streamARN:       &streamARN,
+				PayloadFormat:   tc.payloadFormat,
+				DataContentType: tc.dataContentType,
+				Compression:     CompressionAuto,
+				progress:        newProgress(),
+			}
+			if err := a.initClient(); err != nil {
+				t.Fatalf("failed to create cloudevent client, %v", err)
+			}
+
+			checkpointer := &fakeCheckpointer{}
+			p := &sourceRecordProcessor{adapter: a, logger: zap.S(), shardID: "shard-0"}
+			p.ProcessRecords(&kc.ProcessRecordsInput{
+				Records: []*ks.Record{
+					{Data: gzipData(`{"key":"value"}`), SequenceNumber: aws.String("1"), PartitionKey: aws.String("p")},
+					{Data: []byte("plain text"), SequenceNumber: aws.String("2"), PartitionKey: aws.String("p")},
+				},
+				Checkpointer: checkpointer,
+			})
+
+			if diff := cmp.Diff(tc.wantContentType, contentTypes); diff != "" {
+				t.Errorf("unexpected content types (-want, +got) = %v", diff)
+			}
+			if diff := cmp.Diff(tc.wantBodies, bodies); diff != "" {
+				t.Errorf("unexpected bodies (-want, +got) = %v", diff)
+			}
+			if aws.StringValue(checkpointer.sequenceNumber) != "2" {
+				t.Errorf("expected a checkpoint at 2, but got %v", checkpointer.sequenceNumber)
+			}
+		})
+	}
+}
+
+func gzipData(s string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(s))
+	w.Close()
+	return buf.Bytes()
+}
+
+func zlibData(s string) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write([]byte(s))
+	w.Close()
+	return buf.Bytes()
+}
+
+// snappyFrames returns s compressed in the snappy framing format.
+func snappyFrames(s string) []byte {
+	var buf bytes.Buffer
+	w := snappy.NewBufferedWriter(&buf)
+	w.Write([]byte(s))
+	w.Close()
+	return buf.Bytes()
+}
+
+func zstdData(s string) []byte {
+	w, _ := zstd.NewWriter(nil)
+	defer w.Close()
+	return w.EncodeAll([]byte(s), nil)
+}
+
+// corrupt returns a copy of b with its last byte flipped.
+func corrupt(b []byte) []byte {
+	res := append([]byte{}, b...)
+	res[len(res)-1] ^= 0xff
+	return res
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents/types"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+const (
+	deadLetterEventType = "aws.kinesis.deadletter"
+
+	// extDeadLetterReason is the extension holding why a record could not be decoded.
+	extDeadLetterReason = "deadletterreason"
+)
+
+// rejectRecord returns the dead letter of a record which cannot be decoded, or false if there is
+// no dead-letter sink and the record is skipped.
+func (a *Adapter) rejectRecord(record *Record, reason error, logger *zap.SugaredLogger) (pendingEvent, bool) {
+	if a.DeadLetterSinkURI == "" {
+		logger.Warnf("Skipping record %v: %v", aws.StringValue(record.SequenceNumber), reason)
+		return pendingEvent{}, false
+	}
+	logger.Warnf("Sending record %v to the dead-letter sink: %v", aws.StringValue(record.SequenceNumber), reason)
+	return pendingEvent{
+		event:          a.deadLetterEvent(record, reason),
+		sequenceNumber: record.SequenceNumber,
+		deadLetter:     true,
+	}, true
+}
+
+// deadLetterEvent returns the dead letter of a record, whose body is the data of the record as
+// read from the stream.
+func (a *Adapter) deadLetterEvent(record *Record, reason error) cloudevents.Event {
+	event := cloudevents.Event{
+		Context: cloudevents.EventContextV02{
+			ID:     recordID(record),
+			Type:   deadLetterEventType,
+			Source: *types.ParseURLRef(fmt.Sprintf("/%s", *a.streamARN)),
+			Extensions: map[string]interface{}{
+				extPartitionKey:     aws.StringValue(record.PartitionKey),
+				extDeadLetterReason: reason.Error(),
+			},
+		}.AsV02(),
+		Data:        record.Data,
+		DataEncoded: true,
+	}
+	if record.ApproximateArrivalTimestamp != nil {
+		event.SetTime(*record.ApproximateArrivalTimestamp)
+	}
+	event.SetDataContentType(DataContentTypeBinary)
+	return event
+}
+
+// postDeadLetter sends an event to the DeadLetterSinkURI.
+func (a *Adapter) postDeadLetter(event cloudevents.Event) error {
+	_, err := a.deadLetterClient.Send(context.TODO(), event)
+	return err
+}
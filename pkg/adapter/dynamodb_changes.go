@@ -0,0 +1,157 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents/types"
+)
+
+// dynamoDBEventTypePrefix prefixes the lower-cased name of the item changes to form the type of
+// their events, e.g. aws.dynamodb.insert.
+const dynamoDBEventTypePrefix = "aws.dynamodb."
+
+// dynamoDBChange is the payload of the records written by Kinesis Data Streams for DynamoDB.
+type dynamoDBChange struct {
+	EventID   string             `json:"eventID"`
+	EventName string             `json:"eventName"`
+	TableName string             `json:"tableName"`
+	DynamoDB  dynamoDBStreamData `json:"dynamodb"`
+}
+
+// dynamoDBStreamData is the item change of a record, and the data of its event. The item images
+// are kept in the attribute value format of DynamoDB, unless they are converted to plain JSON.
+type dynamoDBStreamData struct {
+	ApproximateCreationDateTime int64           `json:",omitempty"`
+	Keys                        json.RawMessage `json:",omitempty"`
+	NewImage                    json.RawMessage `json:",omitempty"`
+	OldImage                    json.RawMessage `json:",omitempty"`
+	SizeBytes                   int64           `json:",omitempty"`
+}
+
+// dynamoDBEventNames are the names of the item changes.
+var dynamoDBEventNames = map[string]bool{"INSERT": true, "MODIFY": true, "REMOVE": true}
+
+// dynamoDBChangeEvents returns the event of the item change of a record. Its subject is the name
+// of the table.
+func (a *Adapter) dynamoDBChangeEvents(record *Record) ([]cloudevents.Event, error) {
+	change := &dynamoDBChange{}
+	if err := json.Unmarshal(record.Data, change); err != nil {
+		return nil, fmt.Errorf("not a DynamoDB change: %v", err)
+	}
+	if !dynamoDBEventNames[change.EventName] {
+		return nil, fmt.Errorf("unknown DynamoDB event name %q", change.EventName)
+	}
+
+	data := &change.DynamoDB
+	if a.DynamoDBPlainJSON {
+		for _, image := range []*json.RawMessage{&data.Keys, &data.NewImage, &data.OldImage} {
+			plain, err := plainItem(*image)
+			if err != nil {
+				return nil, err
+			}
+			*image = plain
+		}
+	}
+
+	event := cloudevents.Event{
+		Context: cloudevents.EventContextV02{
+			ID:     change.EventID,
+			Type:   dynamoDBEventTypePrefix + strings.ToLower(change.EventName),
+			Source: *types.ParseURLRef(fmt.Sprintf("/%s", *a.streamARN)),
+		}.AsV02(),
+		Data: data,
+	}
+	event.SetSubject(change.TableName)
+	if t := data.ApproximateCreationDateTime; t > 0 {
+		event.SetTime(creationTime(t))
+	}
+	return []cloudevents.Event{event}, nil
+}
+
+// creationTime returns the time of an item change, given in milliseconds or in microseconds
+// depending on the precision set on the table.
+func creationTime(t int64) time.Time {
+	// Milliseconds do not reach 10^14 before year 5138.
+	if t >= 1e14 {
+		return time.Unix(0, t*int64(time.Microsecond)).UTC()
+	}
+	return time.Unix(0, t*int64(time.Millisecond)).UTC()
+}
+
+// plainItem converts an item in the attribute value format of DynamoDB to plain JSON.
+func plainItem(item json.RawMessage) (json.RawMessage, error) {
+	if item == nil {
+		return nil, nil
+	}
+	// The attribute value format is the JSON encoding of the SDK type.
+	attrs := map[string]*dynamodb.AttributeValue{}
+	if err := json.Unmarshal(item, &attrs); err != nil {
+		return nil, fmt.Errorf("invalid DynamoDB item: %v", err)
+	}
+	return json.Marshal(plainAttributes(attrs))
+}
+
+func plainAttributes(attrs map[string]*dynamodb.AttributeValue) map[string]interface{} {
+	res := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		res[k] = plainValue(v)
+	}
+	return res
+}
+
+// plainValue converts an attribute value to plain JSON. Numbers are kept exact, and binary values
+// are encoded in base64.
+func plainValue(v *dynamodb.AttributeValue) interface{} {
+	switch {
+	case v == nil, v.NULL != nil:
+		return nil
+	case v.S != nil:
+		return *v.S
+	case v.N != nil:
+		return json.Number(*v.N)
+	case v.BOOL != nil:
+		return *v.BOOL
+	case v.B != nil:
+		return v.B
+	case v.M != nil:
+		return plainAttributes(v.M)
+	case v.L != nil:
+		l := make([]interface{}, 0, len(v.L))
+		for _, e := range v.L {
+			l = append(l, plainValue(e))
+		}
+		return l
+	case v.SS != nil:
+		return v.SS
+	case v.NS != nil:
+		ns := make([]json.Number, 0, len(v.NS))
+		for _, n := range v.NS {
+			ns = append(ns, json.Number(*n))
+		}
+		return ns
+	case v.BS != nil:
+		return v.BS
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	ks "github.com/aws/aws-sdk-go/service/kinesis"
+)
+
+func TestDynamoDBChangeEvents(t *testing.T) {
+	const modify = `{"awsRegion":"us-west-2","eventID":"e1","eventName":"MODIFY","tableName":"Music","eventSource":"aws:dynamodb","dynamodb":{` +
+		`"ApproximateCreationDateTime":1556704800000,` +
+		`"Keys":{"Artist":{"S":"Acme"}},` +
+		`"NewImage":{"Artist":{"S":"Acme"},"Plays":{"N":"12345678901234567890"},"Tags":{"SS":["a","b"]},"Live":{"BOOL":true},"Info":{"M":{"Tracks":{"L":[{"N":"1"},{"NULL":true}]}}},"Cover":{"B":"AQI="}},` +
+		`"OldImage":{"Artist":{"S":"Acme"},"Plays":{"N":"1"}},` +
+		`"SizeBytes":42}}`
+
+	testCases := map[string]struct {
+		data      string
+		plainJSON bool
+		wantType  string
+		wantData  string
+		wantTime  time.Time
+		wantErr   bool
+	}{
+		"attribute values": {
+			data:     modify,
+			wantType: "aws.dynamodb.modify",
+			wantData: `{"ApproximateCreationDateTime":1556704800000,"Keys":{"Artist":{"S":"Acme"}},` +
+				`"NewImage":{"Artist":{"S":"Acme"},"Plays":{"N":"12345678901234567890"},"Tags":{"SS":["a","b"]},"Live":{"BOOL":true},"Info":{"M":{"Tracks":{"L":[{"N":"1"},{"NULL":true}]}}},"Cover":{"B":"AQI="}},` +
+				`"OldImage":{"Artist":{"S":"Acme"},"Plays":{"N":"1"}},"SizeBytes":42}`,
+			wantTime: time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC),
+		},
+		"plain json": {
+			data:      modify,
+			plainJSON: true,
+			wantType:  "aws.dynamodb.modify",
+			wantData: `{"ApproximateCreationDateTime":1556704800000,"Keys":{"Artist":"Acme"},` +
+				`"NewImage":{"Artist":"Acme","Cover":"AQI=","Info":{"Tracks":[1,null]},"Live":true,"Plays":12345678901234567890,"Tags":["a","b"]},` +
+				`"OldImage":{"Artist":"Acme","Plays":1},"SizeBytes":42}`,
+			wantTime: time.Date(2019, 5, 1, 10, 0, 0, 0, time.UTC),
+		},
+		"microseconds": {
+			data:      `{"eventID":"e2","eventName":"REMOVE","tableName":"Music","dynamodb":{"ApproximateCreationDateTime":1556704800000001,"Keys":{"Artist":{"S":"Acme"}}}}`,
+			plainJSON: true,
+			wantType:  "aws.dynamodb.remove",
+			wantData:  `{"ApproximateCreationDateTime":1556704800000001,"Keys":{"Artist":"Acme"}}`,
+			wantTime:  time.Date(2019, 5, 1, 10, 0, 0, 1000, time.UTC),
+		},
+		"unknown event name": {
+			data:    `{"eventID":"e3","eventName":"TRUNCATE","tableName":"Music","dynamodb":{}}`,
+			wantErr: true,
+		},
+		"not json": {
+			data:    "not json",
+			wantErr: true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			streamARN := "arn:aws:kinesis:us-west-2:4444444:stream/kinesis-name"
+			a := &Adapter{streamARN: &streamARN, DynamoDBPlainJSON: tc.plainJSON}
+
+			events, err := a.dynamoDBChangeEvents(&Record{Record: ks.Record{Data: []byte(tc.data), SequenceNumber: aws.String("1")}})
+			if tc.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("expected 1 event, but got %d", len(events))
+			}
+			event := events[0]
+			if event.Type() != tc.wantType {
+				t.Errorf("expected type %q, but got %q", tc.wantType, event.Type())
+			}
+			if event.Subject() != "Music" {
+				t.Errorf("expected subject %q, but got %q", "Music", event.Subject())
+			}
+			if !event.Time().Equal(tc.wantTime) {
+				t.Errorf("expected time %v, but got %v", tc.wantTime, event.Time())
+			}
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(data) != tc.wantData {
+				t.Errorf("expected data %s, but got %s", tc.wantData, data)
+			}
+		})
+	}
+}
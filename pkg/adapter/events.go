@@ -0,0 +1,72 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"sync/atomic"
+
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Reasons of the events recorded by the adapter against its KinesisSource.
+const (
+	describeStreamFailedReason = "DescribeStreamFailed"
+	replayFailedReason         = "ReplayFailed"
+	leaseLostReason            = "LeaseLost"
+	shardEndedReason           = "ShardEnded"
+	sinkUnavailableReason      = "SinkUnavailable"
+	sinkRecoveredReason        = "SinkRecovered"
+)
+
+// sinkFailureThreshold is the number of consecutive failed deliveries reported as a persistent
+// failure of the sink.
+const sinkFailureThreshold = 5
+
+// eventf records an event against the KinesisSource, when the adapter has a recorder.
+func (a *Adapter) eventf(eventType, reason, messageFormat string, args ...interface{}) {
+	if a.Recorder == nil {
+		return
+	}
+	src := &v1alpha1.KinesisSource{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       "KinesisSource",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: a.SourceNamespace,
+			Name:      a.SourceName,
+		},
+	}
+	a.Recorder.Eventf(src, eventType, reason, messageFormat, args...)
+}
+
+// sinkFailed counts a failed delivery, and records an event once the failures are persistent.
+func (a *Adapter) sinkFailed(err error) {
+	if atomic.AddInt32(&a.sinkFailures, 1) == sinkFailureThreshold {
+		a.eventf(corev1.EventTypeWarning, sinkUnavailableReason, "Failed to deliver events %d times in a row: %v", sinkFailureThreshold, err)
+	}
+}
+
+// sinkSucceeded resets the count of failed deliveries, and records an event when the sink
+// recovers from persistent failures.
+func (a *Adapter) sinkSucceeded() {
+	if atomic.SwapInt32(&a.sinkFailures, 0) >= sinkFailureThreshold {
+		a.eventf(corev1.EventTypeNormal, sinkRecoveredReason, "Delivered events again.")
+	}
+}
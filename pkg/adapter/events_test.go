@@ -0,0 +1,79 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	kc "github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+	wk "github.com/vmware/vmware-go-kcl/clientlibrary/worker"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestSinkEvents(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	a := &Adapter{SourceNamespace: "ns", SourceName: "source", Recorder: recorder}
+
+	for i := 0; i < sinkFailureThreshold-1; i++ {
+		a.sinkFailed(errors.New("unavailable"))
+	}
+	a.sinkSucceeded()
+	for i := 0; i < sinkFailureThreshold+1; i++ {
+		a.sinkFailed(errors.New("unavailable"))
+	}
+	a.sinkSucceeded()
+	a.sinkSucceeded()
+
+	var got []string
+	for len(recorder.Events) > 0 {
+		got = append(got, <-recorder.Events)
+	}
+	if len(got) != 2 || !strings.HasPrefix(got[0], "Warning "+sinkUnavailableReason) || !strings.HasPrefix(got[1], "Normal "+sinkRecoveredReason) {
+		t.Errorf("unexpected events %q", got)
+	}
+}
+
+func TestLeaseLostEvent(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	a := &Adapter{SourceNamespace: "ns", SourceName: "source", Recorder: recorder, progress: newProgress()}
+	p := &sourceRecordProcessor{adapter: a, logger: zap.S(), shardID: "shardId-0"}
+
+	checkpointer := &fakeCheckpointer{err: errors.New(wk.ErrLeaseNotAquired)}
+	for _, sequenceNumber := range []string{"1", "2"} {
+		p.checkpoint(&kc.ProcessRecordsInput{Checkpointer: checkpointer}, aws.String(sequenceNumber))
+	}
+
+	var got []string
+	for len(recorder.Events) > 0 {
+		got = append(got, <-recorder.Events)
+	}
+	if len(got) != 1 || !strings.HasPrefix(got[0], "Warning "+leaseLostReason) {
+		t.Errorf("unexpected events %q", got)
+	}
+	if shards := a.progress.summarize(nil); len(shards) != 0 {
+		t.Errorf("expected no progress to be recorded, got %+v", shards)
+	}
+}
+
+func TestNoRecorder(t *testing.T) {
+	a := &Adapter{}
+	a.eventf("Normal", shardEndedReason, "Consumed shard %s entirely.", "shardId-0")
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents"
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// filter is the compiled filter of the adapter.
+type filter struct {
+	spec *v1alpha1.FilterSpec
+
+	// paths are the parsed JSONPath expressions of the fields of the spec.
+	paths []*jsonPath
+}
+
+// jsonPath is a parsed JSONPath expression, which the record processors of all the shards search
+// with. A jsonpath.JSONPath keeps the state of its current search, so searches take turns.
+type jsonPath struct {
+	mu   sync.Mutex
+	path *jsonpath.JSONPath
+}
+
+// findResults returns the values the expression selects in the data.
+func (p *jsonPath) findResults(data interface{}) ([][]reflect.Value, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.path.FindResults(data)
+}
+
+// compileFilter parses the JSONPath expressions of the fields of a filter.
+func compileFilter(spec *v1alpha1.FilterSpec) (*filter, error) {
+	f := &filter{spec: spec, paths: make([]*jsonPath, 0, len(spec.Fields))}
+	for _, field := range spec.Fields {
+		path, err := compileJSONPath(field.Path)
+		if err != nil {
+			return nil, err
+		}
+		f.paths = append(f.paths, path)
+	}
+	return f, nil
+}
+
+// compileJSONPath parses a JSONPath expression, such as $.detail.type.
+func compileJSONPath(expr string) (*jsonPath, error) {
+	path := jsonpath.New(expr).AllowMissingKeys(true)
+	if err := path.Parse(v1alpha1.JSONPathTemplate(expr)); err != nil {
+		return nil, fmt.Errorf("invalid JSONPath %q: %v", expr, err)
+	}
+	return &jsonPath{path: path}, nil
+}
+
+// matches tells whether a record is delivered. A nil filter matches every record.
+func (f *filter) matches(record *Record) bool {
+	if f == nil {
+		return true
+	}
+	if f.spec.PartitionKey != nil && !stringMatches(f.spec.PartitionKey, aws.StringValue(record.PartitionKey)) {
+		return false
+	}
+	if arrival := record.ApproximateArrivalTimestamp; arrival != nil {
+		if f.spec.ArrivedAfter != nil && arrival.Before(f.spec.ArrivedAfter.Time) {
+			return false
+		}
+		if f.spec.ArrivedBefore != nil && !arrival.Before(f.spec.ArrivedBefore.Time) {
+			return false
+		}
+	}
+	if len(f.paths) == 0 {
+		return true
+	}
+
+	data, err := decodeJSON(record.Data)
+	if err != nil {
+		return false
+	}
+	for i, path := range f.paths {
+		if !fieldMatches(&f.spec.Fields[i], path, data) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterRecords is the middleware dropping the records which do not match the filter.
+func (a *Adapter) filterRecords(next EventMapper) EventMapper {
+	return EventMapperFunc(func(shard *Shard, record *Record) ([]cloudevents.Event, error) {
+		if !a.filter.matches(record) {
+			filteredRecords.WithLabelValues(shard.ID).Inc()
+			return nil, nil
+		}
+		return next.MapRecord(shard, record)
+	})
+}
+
+// stringMatches tells whether a string matches.
+func stringMatches(m *v1alpha1.StringMatch, s string) bool {
+	if m.Equals != nil {
+		return s == *m.Equals
+	}
+	return m.Prefix != nil && strings.HasPrefix(s, *m.Prefix)
+}
+
+// fieldMatches tells whether any of the values selected in the data by the path of a field matches.
+// Values other than strings are matched by their JSON text.
+func fieldMatches(m *v1alpha1.FieldMatch, path *jsonPath, data interface{}) bool {
+	results, err := path.findResults(data)
+	if err != nil {
+		return false
+	}
+	for _, values := range results {
+		for _, v := range values {
+			if text, ok := jsonText(v); ok && stringMatches(&m.StringMatch, text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeJSON decodes JSON data, whose numbers keep their JSON text.
+func decodeJSON(b []byte) (interface{}, error) {
+	var data interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&data); err != nil {
+		return nil, err
+	}
+	if d.More() {
+		return nil, errors.New("trailing data")
+	}
+	return data, nil
+}
+
+// jsonText returns a string as is, and the other JSON values as JSON.
+func jsonText(v reflect.Value) (string, bool) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return "null", true
+	}
+	if s, ok := v.Interface().(string); ok {
+		return s, true
+	}
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
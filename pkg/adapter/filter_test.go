@@ -0,0 +1,201 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	ks "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/google/go-cmp/cmp"
+	dto "github.com/prometheus/client_model/go"
+	kc "github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFilterMatches(t *testing.T) {
+	arrival := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	record := &Record{Record: ks.Record{
+		Data:                        []byte(`{"detail":{"type":"created","count":42,"ok":true},"items":[{"sku":"A1"},{"sku":"B2"}]}`),
+		PartitionKey:                aws.String("orders-eu"),
+		ApproximateArrivalTimestamp: &arrival,
+	}}
+
+	testCases := map[string]struct {
+		filter *v1alpha1.FilterSpec
+		record *Record
+		want   bool
+	}{
+		"no filter": {
+			want: true,
+		},
+		"partition key prefix": {
+			filter: &v1alpha1.FilterSpec{PartitionKey: &v1alpha1.StringMatch{Prefix: aws.String("orders-")}},
+			want:   true,
+		},
+		"other partition key": {
+			filter: &v1alpha1.FilterSpec{PartitionKey: &v1alpha1.StringMatch{Equals: aws.String("orders")}},
+		},
+		"arrived in the window": {
+			filter: &v1alpha1.FilterSpec{ArrivedAfter: timePtr(arrival), ArrivedBefore: timePtr(arrival.Add(time.Second))},
+			want:   true,
+		},
+		"arrived too early": {
+			filter: &v1alpha1.FilterSpec{ArrivedAfter: timePtr(arrival.Add(time.Second))},
+		},
+		"arrived too late": {
+			filter: &v1alpha1.FilterSpec{ArrivedBefore: timePtr(arrival)},
+		},
+		"field equality": {
+			filter: &v1alpha1.FilterSpec{Fields: []v1alpha1.FieldMatch{
+				{Path: "$.detail.type", StringMatch: v1alpha1.StringMatch{Equals: aws.String("created")}},
+				{Path: "$.detail.count", StringMatch: v1alpha1.StringMatch{Equals: aws.String("42")}},
+				{Path: "{.detail.ok}", StringMatch: v1alpha1.StringMatch{Equals: aws.String("true")}},
+			}},
+			want: true,
+		},
+		"any selected value": {
+			filter: &v1alpha1.FilterSpec{Fields: []v1alpha1.FieldMatch{{Path: "$.items[*].sku", StringMatch: v1alpha1.StringMatch{Prefix: aws.String("B")}}}},
+			want:   true,
+		},
+		"different field": {
+			filter: &v1alpha1.FilterSpec{Fields: []v1alpha1.FieldMatch{{Path: "$.detail.type", StringMatch: v1alpha1.StringMatch{Equals: aws.String("deleted")}}}},
+		},
+		"missing field": {
+			filter: &v1alpha1.FilterSpec{Fields: []v1alpha1.FieldMatch{{Path: "$.detail.missing", StringMatch: v1alpha1.StringMatch{Prefix: aws.String("")}}}},
+		},
+		"not JSON": {
+			filter: &v1alpha1.FilterSpec{Fields: []v1alpha1.FieldMatch{{Path: "$.detail.type", StringMatch: v1alpha1.StringMatch{Prefix: aws.String("")}}}},
+			record: &Record{Record: ks.Record{Data: []byte("plain text")}},
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			var f *filter
+			if tc.filter != nil {
+				var err error
+				if f, err = compileFilter(tc.filter); err != nil {
+					t.Fatalf("failed to compile the filter: %v", err)
+				}
+			}
+			r := record
+			if tc.record != nil {
+				r = tc.record
+			}
+			if got := f.matches(r); got != tc.want {
+				t.Errorf("expected %v, but got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+// TestFilterMatchesConcurrently matches records from several goroutines, as the record processors of
+// the shards do. Run with -race.
+func TestFilterMatchesConcurrently(t *testing.T) {
+	f, err := compileFilter(&v1alpha1.FilterSpec{Fields: []v1alpha1.FieldMatch{
+		{Path: "$.detail.type", StringMatch: v1alpha1.StringMatch{Equals: aws.String("created")}},
+		{Path: "$.items[*].sku", StringMatch: v1alpha1.StringMatch{Prefix: aws.String("B")}},
+	}})
+	if err != nil {
+		t.Fatalf("failed to compile the filter: %v", err)
+	}
+	matching := &Record{Record: ks.Record{Data: []byte(`{"detail":{"type":"created"},"items":[{"sku":"A1"},{"sku":"B2"}]}`)}}
+	other := &Record{Record: ks.Record{Data: []byte(`{"detail":{"type":"deleted"},"items":[{"sku":"B2"}]}`)}}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if !f.matches(matching) || f.matches(other) {
+					errs <- "unexpected match result"
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestProcessRecordsFiltered(t *testing.T) {
+	var bodies []string
+	sinkServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer sinkServer.Close()
+
+	streamARN := "arn:aws:kinesis:us-west-2:4444444:stream/kinesis-name"
+	a := &Adapter{
+		SinkURI:       sinkServer.URL,
+		streamARN:     &streamARN,
+		PayloadFormat: PayloadFormatRecord,
+		Compression:   CompressionAuto,
+		Filter:        &v1alpha1.FilterSpec{Fields: []v1alpha1.FieldMatch{{Path: "$.type", StringMatch: v1alpha1.StringMatch{Equals: aws.String("created")}}}},
+		progress:      newProgress(),
+	}
+	var err error
+	if a.filter, err = compileFilter(a.Filter); err != nil {
+		t.Fatalf("failed to compile the filter: %v", err)
+	}
+	if err := a.initClient(); err != nil {
+		t.Fatalf("failed to create cloudevent client, %v", err)
+	}
+
+	checkpointer := &fakeCheckpointer{}
+	p := &sourceRecordProcessor{adapter: a, logger: zap.S(), shardID: "shard-filtered"}
+	p.ProcessRecords(&kc.ProcessRecordsInput{
+		Records: []*ks.Record{
+			{Data: []byte(`{"type":"updated"}`), SequenceNumber: aws.String("1"), PartitionKey: aws.String("p")},
+			{Data: gzipData(`{"type":"created"}`), SequenceNumber: aws.String("2"), PartitionKey: aws.String("p")},
+			{Data: []byte(`{"type":"deleted"}`), SequenceNumber: aws.String("3"), PartitionKey: aws.String("p")},
+		},
+		Checkpointer: checkpointer,
+	})
+
+	if diff := cmp.Diff([]string{`{"type":"created"}`}, bodies); diff != "" {
+		t.Errorf("unexpected bodies (-want, +got) = %v", diff)
+	}
+	if aws.StringValue(checkpointer.sequenceNumber) != "3" {
+		t.Errorf("expected a checkpoint at 3, but got %v", checkpointer.sequenceNumber)
+	}
+	m := &dto.Metric{}
+	if err := filteredRecords.WithLabelValues("shard-filtered").Write(m); err != nil {
+		t.Fatalf("failed to read the metric: %v", err)
+	}
+	if got := m.GetCounter().GetValue(); got != 2 {
+		t.Errorf("expected 2 filtered records, but got %v", got)
+	}
+}
+
+func timePtr(t time.Time) *metav1.Time {
+	return &metav1.Time{Time: t}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents"
+	"go.uber.org/zap"
+)
+
+// Payload formats of the records.
+const (
+	// PayloadFormatKCL delivers every batch of records read by the KCL as a single event.
+	PayloadFormatKCL = "kcl"
+
+	// PayloadFormatRecord delivers every record as an event, whose body is the data of the record.
+	PayloadFormatRecord = "record"
+
+	// PayloadFormatCloudWatchLogs delivers every log event of the records written by CloudWatch
+	// Logs subscription filters as an event.
+	PayloadFormatCloudWatchLogs = "cloudwatchLogs"
+
+	// PayloadFormatDynamoDBChanges delivers every item change of the records written by Kinesis
+	// Data Streams for DynamoDB as an event.
+	PayloadFormatDynamoDBChanges = "dynamodbChanges"
+
+	// PayloadFormatLambda delivers every batch of records read by the KCL as a single event, whose
+	// body is the KinesisEvent AWS Lambda functions are invoked with.
+	PayloadFormatLambda = "lambda"
+)
+
+// pendingEvent is an event to deliver, along with the sequence number of the Kinesis record it
+// comes from. A Kinesis record may be turned into several events, or none.
+type pendingEvent struct {
+	event          cloudevents.Event
+	sequenceNumber *string
+
+	// deadLetter tells whether the event is sent to the dead-letter sink.
+	deadLetter bool
+}
+
+// checkPayloadFormat returns an error if the payload format, the content type or the compression
+// is unknown, or if a registered payload format takes the name of a built-in one.
+func (a *Adapter) checkPayloadFormat() error {
+	for name := range a.PayloadFormats {
+		if builtinPayloadFormat(name) {
+			return fmt.Errorf("cannot register the built-in payload format %q", name)
+		}
+	}
+	if _, ok := a.PayloadFormats[a.PayloadFormat]; !ok && !builtinPayloadFormat(a.PayloadFormat) {
+		return fmt.Errorf("unknown payload format %q", a.PayloadFormat)
+	}
+	return a.checkContent()
+}
+
+// builtinPayloadFormat tells whether a payload format is one of the adapter.
+func builtinPayloadFormat(name string) bool {
+	switch name {
+	case "", PayloadFormatKCL, PayloadFormatRecord, PayloadFormatCloudWatchLogs, PayloadFormatDynamoDBChanges, PayloadFormatLambda:
+		return true
+	}
+	return false
+}
+
+// newEvents turns a batch of records of a shard into the events to deliver, in the order of the
+// records, with the chain of EventMappers. The records it fails to map are sent to the dead-letter
+// sink, or skipped without one.
+func (a *Adapter) newEvents(shardID string, batch *recordBatch, logger *zap.SugaredLogger) []pendingEvent {
+	var events []pendingEvent
+	var records []*Record
+	shard := a.newShard(shardID, logger)
+	mapper := a.eventMapper(&records)
+	for _, record := range batch.Records {
+		recordEvents, err := mapper.MapRecord(shard, record)
+		userErrs, partial := err.(userRecordErrors)
+		if err != nil && !partial {
+			if deadLetter, ok := a.rejectRecord(record, err, logger); ok {
+				events = append(events, deadLetter)
+			}
+			continue
+		}
+		for _, event := range recordEvents {
+			events = append(events, pendingEvent{event: event, sequenceNumber: record.SequenceNumber})
+		}
+		// The user records of an aggregated record which fail are rejected on their own.
+		for _, e := range userErrs {
+			if deadLetter, ok := a.rejectRecord(e.record, e.err, logger); ok {
+				events = append(events, deadLetter)
+			}
+		}
+	}
+	if !a.batchesRecords() || len(batch.Records) == 0 {
+		return events
+	}
+
+	// The batch is a single event: the dead letters of its records are checkpointed along with it.
+	last := batch.Records[len(batch.Records)-1].SequenceNumber
+	if len(records) > 0 {
+		batch.Records = records
+		event := a.batchEvent(shardID, batch, logger)
+		a.overrides.apply(&event, a.StreamName, shardID, nil)
+		events = append([]pendingEvent{{event: event}}, events...)
+	}
+	for i := range events {
+		events[i].sequenceNumber = last
+	}
+	return events
+}
+
+// batchesRecords tells whether the records of a batch are delivered as a single event.
+func (a *Adapter) batchesRecords() bool {
+	return a.PayloadFormat == "" || a.PayloadFormat == PayloadFormatKCL || a.PayloadFormat == PayloadFormatLambda
+}
+
+// lastDelivered returns the sequence number of the last Kinesis record whose events are all among
+// the given number of first events, or nil if there is none. It is called when the delivery failed
+// before the last event.
+func lastDelivered(events []pendingEvent, delivered int) *string {
+	pending := aws.StringValue(events[delivered].sequenceNumber)
+	for i := delivered - 1; i >= 0; i-- {
+		if aws.StringValue(events[i].sequenceNumber) != pending {
+			return events[i].sequenceNumber
+		}
+	}
+	return nil
+}
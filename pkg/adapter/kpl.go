@@ -0,0 +1,201 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// kplMagic prefixes the records aggregated by the Kinesis Producer Library. It is followed by the
+// AggregatedRecord protobuf message, and by the MD5 digest of the message.
+var kplMagic = []byte{0xF3, 0x89, 0x9A, 0xC2}
+
+// Record is a record of the stream: either a Kinesis record, or one of the user records the Kinesis
+// Producer Library aggregated into a Kinesis record. User records keep the sequence number, arrival
+// time and encryption of the Kinesis record they were aggregated into.
+type Record struct {
+	kinesis.Record
+
+	// SubSequenceNumber is the position of the user record within the aggregated Kinesis record,
+	// it is nil for records that are not aggregated.
+	SubSequenceNumber *int64 `json:",omitempty"`
+
+	// dataSchema is the schema the data was decoded with, if any.
+	dataSchema string
+}
+
+// kinesisRecords wraps the records read from the stream.
+func kinesisRecords(records []*kinesis.Record) []*Record {
+	res := make([]*Record, 0, len(records))
+	for _, record := range records {
+		res = append(res, &Record{Record: *record})
+	}
+	return res
+}
+
+// deaggregateRecords is the middleware expanding the records aggregated by the Kinesis Producer
+// Library into their user records, passed to the next EventMapper in order. The other records,
+// including aggregated records failing their checksum, are passed as is. The events of the user
+// records are returned together, along with userRecordErrors for the ones which fail.
+func deaggregateRecords(next EventMapper) EventMapper {
+	return EventMapperFunc(func(shard *Shard, record *Record) ([]cloudevents.Event, error) {
+		users, err := userRecords(&record.Record)
+		if err != nil {
+			return next.MapRecord(shard, record)
+		}
+		var events []cloudevents.Event
+		var errs userRecordErrors
+		for _, user := range users {
+			userEvents, err := next.MapRecord(shard, user)
+			if err != nil {
+				errs = append(errs, userRecordError{record: user, err: err})
+				continue
+			}
+			events = append(events, userEvents...)
+		}
+		if len(errs) > 0 {
+			return events, errs
+		}
+		return events, nil
+	})
+}
+
+// userRecordErrors are the errors of the user records of an aggregated record which fail to map,
+// sent to the dead-letter sink in place of the aggregated record.
+type userRecordErrors []userRecordError
+
+type userRecordError struct {
+	record *Record
+	err    error
+}
+
+func (e userRecordErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, fmt.Sprintf("user record %d: %v", aws.Int64Value(err.record.SubSequenceNumber), err.err))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// userRecords returns the user records aggregated into a Kinesis record, or an error if it is not
+// an aggregated record.
+func userRecords(record *kinesis.Record) ([]*Record, error) {
+	data := record.Data
+	if len(data) < len(kplMagic)+md5.Size || !bytes.HasPrefix(data, kplMagic) {
+		return nil, errors.New("not an aggregated record")
+	}
+	msg := data[len(kplMagic) : len(data)-md5.Size]
+	if digest := md5.Sum(msg); !bytes.Equal(digest[:], data[len(data)-md5.Size:]) {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	agg, err := parseAggregatedRecord(msg)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Record, 0, len(agg.records))
+	for i, user := range agg.records {
+		if user.partitionKeyIndex >= uint64(len(agg.partitionKeys)) {
+			return nil, fmt.Errorf("partition key index %d out of range", user.partitionKeyIndex)
+		}
+		r := &Record{Record: *record, SubSequenceNumber: aws.Int64(int64(i))}
+		r.Data = user.data
+		r.PartitionKey = aws.String(agg.partitionKeys[user.partitionKeyIndex])
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+// aggregatedRecord is the AggregatedRecord message of the Kinesis Producer Library.
+type aggregatedRecord struct {
+	partitionKeys []string
+	records       []userRecord
+}
+
+// userRecord is the Record message of the Kinesis Producer Library. Explicit hash keys and tags
+// are not kept.
+type userRecord struct {
+	partitionKeyIndex uint64
+	data              []byte
+}
+
+func parseAggregatedRecord(b []byte) (*aggregatedRecord, error) {
+	agg := &aggregatedRecord{}
+	err := parseMessage(b, func(num protowire.Number, typ protowire.Type, v uint64, bs []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			agg.partitionKeys = append(agg.partitionKeys, string(bs))
+		case num == 3 && typ == protowire.BytesType:
+			user := userRecord{}
+			err := parseMessage(bs, func(num protowire.Number, typ protowire.Type, v uint64, bs []byte) error {
+				switch {
+				case num == 1 && typ == protowire.VarintType:
+					user.partitionKeyIndex = v
+				case num == 3 && typ == protowire.BytesType:
+					user.data = bs
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			agg.records = append(agg.records, user)
+		}
+		return nil
+	})
+	return agg, err
+}
+
+// parseMessage calls fn with every field of a protobuf message: the value of varint fields, and
+// the content of length-delimited fields. Other fields are skipped.
+func parseMessage(b []byte, fn func(num protowire.Number, typ protowire.Type, v uint64, bs []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var v uint64
+		var bs []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			bs, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, typ, v, bs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
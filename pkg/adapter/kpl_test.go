@@ -0,0 +1,220 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	ks "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents"
+	"github.com/google/go-cmp/cmp"
+	kc "github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestDeaggregate(t *testing.T) {
+	plain := &ks.Record{Data: []byte(`{"key":"value"}`), SequenceNumber: aws.String("1"), PartitionKey: aws.String("p")}
+	aggregated := &ks.Record{
+		Data:           aggregate([]string{"a", "b"}, []int{0, 1, 0}, []string{"one", "two", "three"}),
+		SequenceNumber: aws.String("2"),
+		PartitionKey:   aws.String("agg"),
+	}
+	corrupted := &ks.Record{Data: aggregate([]string{"a"}, []int{0}, []string{"one"}), SequenceNumber: aws.String("3")}
+	corrupted.Data[len(corrupted.Data)-1]++
+
+	var got []*Record
+	mapper := deaggregateRecords(EventMapperFunc(func(_ *Shard, record *Record) ([]cloudevents.Event, error) {
+		got = append(got, record)
+		return nil, nil
+	}))
+	for _, record := range kinesisRecords([]*ks.Record{plain, aggregated, corrupted}) {
+		if _, err := mapper.MapRecord(&Shard{}, record); err != nil {
+			t.Fatalf("failed to map record %s: %v", aws.StringValue(record.SequenceNumber), err)
+		}
+	}
+
+	user := func(data, partitionKey string, subSequenceNumber int64) *Record {
+		return &Record{
+			Record:            ks.Record{Data: []byte(data), SequenceNumber: aws.String("2"), PartitionKey: aws.String(partitionKey)},
+			SubSequenceNumber: aws.Int64(subSequenceNumber),
+		}
+	}
+	want := []*Record{
+		{Record: *plain},
+		user("one", "a", 0),
+		user("two", "b", 1),
+		user("three", "a", 2),
+		{Record: *corrupted},
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(Record{}), cmp.Comparer(func(a, b ks.Record) bool { return a.String() == b.String() })); diff != "" {
+		t.Errorf("unexpected records (-want, +got) = %v", diff)
+	}
+}
+
+func TestDeaggregateUserRecordErrors(t *testing.T) {
+	streamARN := "arn:aws:kinesis:us-west-2:4444444:stream/kinesis-name"
+	a := &Adapter{
+		streamARN:         &streamARN,
+		PayloadFormat:     PayloadFormatRecord,
+		DeadLetterSinkURI: "http://dead-letters/",
+		Middlewares: []Middleware{func(next EventMapper) EventMapper {
+			return EventMapperFunc(func(shard *Shard, record *Record) ([]cloudevents.Event, error) {
+				if string(record.Data) == "two" {
+					return nil, errors.New("rejected")
+				}
+				return next.MapRecord(shard, record)
+			})
+		}},
+	}
+
+	events := a.newEvents("shard-0", newRecordBatch(&kc.ProcessRecordsInput{
+		Records: []*ks.Record{
+			{Data: aggregate([]string{"a"}, []int{0, 0, 0}, []string{"one", "two", "three"}), SequenceNumber: aws.String("1"), PartitionKey: aws.String("a")},
+		},
+	}), zap.S())
+
+	type event struct {
+		id         string
+		data       string
+		deadLetter bool
+	}
+	var got []event
+	for _, e := range events {
+		got = append(got, event{id: e.event.ID(), data: string(e.event.Data.([]byte)), deadLetter: e.deadLetter})
+		if aws.StringValue(e.sequenceNumber) != "1" {
+			t.Errorf("expected the sequence number of the aggregated record, but got %v", e.sequenceNumber)
+		}
+	}
+	// The rejected user record is sent to the dead-letter sink, the other ones are delivered.
+	want := []event{
+		{id: "1:0", data: "one"},
+		{id: "1:2", data: "three"},
+		{id: "1:1", data: "two", deadLetter: true},
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(event{})); diff != "" {
+		t.Errorf("unexpected events (-want, +got) = %v", diff)
+	}
+}
+
+func TestProcessAggregatedRecords(t *testing.T) {
+	testCases := map[string]struct {
+		failures       int
+		wantCheckpoint *string
+	}{
+		"retried": {
+			failures:       1,
+			wantCheckpoint: aws.String("2"),
+		},
+		"failed": {
+			failures: 2,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			requests := 0
+			var delivered recordBatch
+			sinkServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= tc.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				body, _ := ioutil.ReadAll(r.Body)
+				json.Unmarshal(body, &delivered)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer sinkServer.Close()
+
+			streamARN := "arn:aws:kinesis:us-west-2:4444444:stream/kinesis-name"
+			a := &Adapter{
+				SinkURI:   sinkServer.URL,
+				streamARN: &streamARN,
+				Retry:     RetryPolicy{Attempts: 2, Backoff: time.Millisecond},
+				progress:  newProgress(),
+			}
+			if err := a.initClient(); err != nil {
+				t.Fatalf("failed to create cloudevent client, %v", err)
+			}
+
+			checkpointer := &fakeCheckpointer{}
+			p := &sourceRecordProcessor{adapter: a, logger: zap.S(), shardID: "shard-0"}
+			p.ProcessRecords(&kc.ProcessRecordsInput{
+				Records: []*ks.Record{
+					{Data: []byte("{}"), SequenceNumber: aws.String("1"), PartitionKey: aws.String("p")},
+					{Data: aggregate([]string{"a"}, []int{0, 0}, []string{"one", "two"}), SequenceNumber: aws.String("2"), PartitionKey: aws.String("a")},
+				},
+				Checkpointer: checkpointer,
+			})
+
+			if diff := cmp.Diff(tc.wantCheckpoint, checkpointer.sequenceNumber); diff != "" {
+				t.Errorf("unexpected checkpoint (-want, +got) = %v", diff)
+			}
+			if tc.wantCheckpoint != nil && len(delivered.Records) != 3 {
+				t.Errorf("expected the 3 records to be delivered at once, but got %d", len(delivered.Records))
+			}
+		})
+	}
+}
+
+type fakeCheckpointer struct {
+	kc.IRecordProcessorCheckpointer
+	sequenceNumber *string
+	err            error
+}
+
+func (c *fakeCheckpointer) Checkpoint(sequenceNumber *string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.sequenceNumber = sequenceNumber
+	return nil
+}
+
+// aggregate encodes user records as the Kinesis Producer Library does, given the partition key
+// table and the index of the partition key of each user record.
+func aggregate(partitionKeys []string, keyIndexes []int, data []string) []byte {
+	var msg []byte
+	for _, key := range partitionKeys {
+		msg = appendBytesField(msg, 1, []byte(key))
+	}
+	for i, d := range data {
+		var user []byte
+		user = appendVarintField(user, 1, uint64(keyIndexes[i]))
+		user = appendBytesField(user, 3, []byte(d))
+		msg = appendBytesField(msg, 3, user)
+	}
+	digest := md5.Sum(msg)
+	res := append(append([]byte{}, kplMagic...), msg...)
+	return append(res, digest[:]...)
+}
+
+func appendBytesField(b []byte, field protowire.Number, v []byte) []byte {
+	return protowire.AppendBytes(protowire.AppendTag(b, field, protowire.BytesType), v)
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	return protowire.AppendVarint(b, v)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// lambdaEvent is the KinesisEvent AWS Lambda functions are invoked with, the data of the events of
+// PayloadFormatLambda.
+type lambdaEvent struct {
+	Records []lambdaEventRecord `json:"Records"`
+}
+
+type lambdaEventRecord struct {
+	Kinesis           lambdaKinesisRecord `json:"kinesis"`
+	EventSource       string              `json:"eventSource"`
+	EventVersion      string              `json:"eventVersion"`
+	EventID           string              `json:"eventID"`
+	EventName         string              `json:"eventName"`
+	InvokeIdentityARN string              `json:"invokeIdentityArn"`
+	AWSRegion         string              `json:"awsRegion"`
+	EventSourceARN    string              `json:"eventSourceARN"`
+}
+
+type lambdaKinesisRecord struct {
+	KinesisSchemaVersion string `json:"kinesisSchemaVersion"`
+	PartitionKey         string `json:"partitionKey"`
+	SequenceNumber       string `json:"sequenceNumber"`
+
+	// Data is base64-encoded in JSON.
+	Data []byte `json:"data"`
+
+	// ApproximateArrivalTimestamp is in seconds since the epoch, with milliseconds.
+	ApproximateArrivalTimestamp json.Number `json:"approximateArrivalTimestamp"`
+	EncryptionType              string      `json:"encryptionType,omitempty"`
+}
+
+// lambdaEvent returns the KinesisEvent of a batch of records of a shard. The IAM role of the KCL
+// stands for the role Lambda functions are invoked with.
+func (a *Adapter) lambdaEvent(shardID string, m *recordBatch) *lambdaEvent {
+	event := &lambdaEvent{Records: make([]lambdaEventRecord, 0, len(m.Records))}
+	for _, record := range m.Records {
+		var arrival float64
+		if record.ApproximateArrivalTimestamp != nil {
+			arrival = float64(record.ApproximateArrivalTimestamp.UnixNano()/1e6) / 1e3
+		}
+		event.Records = append(event.Records, lambdaEventRecord{
+			Kinesis: lambdaKinesisRecord{
+				KinesisSchemaVersion:        extKinesisSchemaVersion,
+				PartitionKey:                aws.StringValue(record.PartitionKey),
+				SequenceNumber:              aws.StringValue(record.SequenceNumber),
+				Data:                        record.Data,
+				ApproximateArrivalTimestamp: json.Number(strconv.FormatFloat(arrival, 'f', 3, 64)),
+				EncryptionType:              aws.StringValue(record.EncryptionType),
+			},
+			EventSource:       extEventSource,
+			EventVersion:      eventVersion,
+			EventID:           shardID + ":" + aws.StringValue(record.SequenceNumber),
+			EventName:         extEventName,
+			InvokeIdentityARN: a.KCLIAMRoleARN,
+			AWSRegion:         a.Region,
+			EventSourceARN:    aws.StringValue(a.streamARN),
+		})
+	}
+	return event
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	ks "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/google/go-cmp/cmp"
+	kc "github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+	"go.uber.org/zap"
+)
+
+func TestProcessRecordsLambda(t *testing.T) {
+	var bodies []string
+	sinkServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer sinkServer.Close()
+
+	streamARN := "arn:aws:kinesis:us-west-2:4444444:stream/kinesis-name"
+	a := &Adapter{
+		SinkURI:       sinkServer.URL,
+		Region:        "us-west-2",
+		KCLIAMRoleARN: "arn:aws:iam::4444444:role/kcl",
+		streamARN:     &streamARN,
+		PayloadFormat: PayloadFormatLambda,
+		Compression:   CompressionAuto,
+		progress:      newProgress(),
+	}
+	if err := a.initClient(); err != nil {
+		t.Fatalf("failed to create cloudevent client, %v", err)
+	}
+
+	arrival := time.Date(2018, 12, 17, 22, 10, 50, 987654321, time.UTC)
+	checkpointer := &fakeCheckpointer{}
+	p := &sourceRecordProcessor{adapter: a, logger: zap.S(), shardID: "shardId-000000000006"}
+	p.ProcessRecords(&kc.ProcessRecordsInput{
+		Records: []*ks.Record{{
+			Data:                        gzipData("Hello"),
+			SequenceNumber:              aws.String("1"),
+			PartitionKey:                aws.String("p1"),
+			ApproximateArrivalTimestamp: &arrival,
+		}, {
+			Data:           []byte("World"),
+			SequenceNumber: aws.String("2"),
+			PartitionKey:   aws.String("p2"),
+			EncryptionType: aws.String("KMS"),
+		}},
+		Checkpointer: checkpointer,
+	})
+
+	want := []string{`{"Records":[` +
+		`{"kinesis":{"kinesisSchemaVersion":"1.0","partitionKey":"p1","sequenceNumber":"1","data":"SGVsbG8=","approximateArrivalTimestamp":1545084650.987},` +
+		`"eventSource":"aws:kinesis","eventVersion":"1.0","eventID":"shardId-000000000006:1","eventName":"aws:kinesis:record",` +
+		`"invokeIdentityArn":"arn:aws:iam::4444444:role/kcl","awsRegion":"us-west-2","eventSourceARN":"arn:aws:kinesis:us-west-2:4444444:stream/kinesis-name"},` +
+		`{"kinesis":{"kinesisSchemaVersion":"1.0","partitionKey":"p2","sequenceNumber":"2","data":"V29ybGQ=","approximateArrivalTimestamp":0.000,"encryptionType":"KMS"},` +
+		`"eventSource":"aws:kinesis","eventVersion":"1.0","eventID":"shardId-000000000006:2","eventName":"aws:kinesis:record",` +
+		`"invokeIdentityArn":"arn:aws:iam::4444444:role/kcl","awsRegion":"us-west-2","eventSourceARN":"arn:aws:kinesis:us-west-2:4444444:stream/kinesis-name"}]}`}
+	if diff := cmp.Diff(want, bodies); diff != "" {
+		t.Errorf("unexpected bodies (-want, +got) = %v", diff)
+	}
+	if aws.StringValue(checkpointer.sequenceNumber) != "2" {
+		t.Errorf("expected a checkpoint at 2, but got %v", checkpointer.sequenceNumber)
+	}
+}
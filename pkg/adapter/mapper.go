@@ -0,0 +1,110 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents"
+	"go.uber.org/zap"
+)
+
+// Shard is the context of the records given to EventMappers.
+type Shard struct {
+	// StreamName and StreamARN identify the stream, ID the shard within it.
+	StreamName string
+	StreamARN  string
+	ID         string
+
+	// Logger logs along with the batch being processed.
+	Logger *zap.SugaredLogger
+}
+
+// EventMapper turns a Kinesis record of a shard into the events to deliver, none to drop it. A
+// record it returns an error for is sent to the dead-letter sink, or skipped without one.
+type EventMapper interface {
+	MapRecord(shard *Shard, record *Record) ([]cloudevents.Event, error)
+}
+
+// EventMapperFunc is a function used as an EventMapper.
+type EventMapperFunc func(shard *Shard, record *Record) ([]cloudevents.Event, error)
+
+// MapRecord calls f.
+func (f EventMapperFunc) MapRecord(shard *Shard, record *Record) ([]cloudevents.Event, error) {
+	return f(shard, record)
+}
+
+// Middleware wraps the next EventMapper of a chain. It may pass it another record, drop the record
+// without calling it, change the events it returns, or return events of its own instead.
+type Middleware func(next EventMapper) EventMapper
+
+// eventMapper returns the chain of EventMappers of the adapter. The built-in middlewares expand
+// the records aggregated by the Kinesis Producer Library, decode, filter and transform the records,
+// and override the attributes of the events, before the middlewares of the adapter, which are
+// followed by the EventMapper of the payload format. The records reaching the end of the chain with
+// PayloadFormatKCL and PayloadFormatLambda are appended to batch.
+func (a *Adapter) eventMapper(batch *[]*Record) EventMapper {
+	mapper := a.formatMapper(batch)
+	middlewares := append([]Middleware{deaggregateRecords, a.decodeRecords, a.filterRecords, a.transformRecords, a.overrideEvents}, a.Middlewares...)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		mapper = middlewares[i](mapper)
+	}
+	return mapper
+}
+
+// formatMapper returns the EventMapper of the payload format.
+func (a *Adapter) formatMapper(batch *[]*Record) EventMapper {
+	if mapper, ok := a.PayloadFormatMappers()[a.PayloadFormat]; ok {
+		return mapper
+	}
+	// The records of the batch are delivered together as a single event.
+	return EventMapperFunc(func(_ *Shard, record *Record) ([]cloudevents.Event, error) {
+		*batch = append(*batch, record)
+		return nil, nil
+	})
+}
+
+// PayloadFormatMappers returns the EventMappers of the payload formats delivering every record as
+// events, keyed by name: the ones of PayloadFormatRecord, PayloadFormatCloudWatchLogs and
+// PayloadFormatDynamoDBChanges, configured by the adapter, and the PayloadFormats it registers.
+func (a *Adapter) PayloadFormatMappers() map[string]EventMapper {
+	mappers := map[string]EventMapper{
+		PayloadFormatRecord:          recordMapper(a.kinesisRecordEvents),
+		PayloadFormatCloudWatchLogs:  recordMapper(a.cloudWatchLogsEvents),
+		PayloadFormatDynamoDBChanges: recordMapper(a.dynamoDBChangeEvents),
+	}
+	for name, mapper := range a.PayloadFormats {
+		mappers[name] = mapper
+	}
+	return mappers
+}
+
+// recordMapper returns the EventMapper turning a record into the events returned by fn.
+func recordMapper(fn func(*Record) ([]cloudevents.Event, error)) EventMapper {
+	return EventMapperFunc(func(_ *Shard, record *Record) ([]cloudevents.Event, error) {
+		return fn(record)
+	})
+}
+
+// newShard returns the context of the records of a shard.
+func (a *Adapter) newShard(shardID string, logger *zap.SugaredLogger) *Shard {
+	return &Shard{
+		StreamName: a.StreamName,
+		StreamARN:  aws.StringValue(a.streamARN),
+		ID:         shardID,
+		Logger:     logger,
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	ks "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents"
+	"github.com/cloudevents/sdk-go/pkg/cloudevents/types"
+	"github.com/google/go-cmp/cmp"
+	kc "github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	"go.uber.org/zap"
+)
+
+func TestProcessRecordsMiddlewares(t *testing.T) {
+	type request struct {
+		eventType string
+		shard     string
+		body      string
+	}
+	var delivered, deadLetters []request
+	handler := func(requests *[]request) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			*requests = append(*requests, request{
+				eventType: r.Header.Get("Ce-Type"),
+				shard:     r.Header.Get("Ce-Shard"),
+				body:      string(body),
+			})
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+	sinkServer := httptest.NewServer(handler(&delivered))
+	defer sinkServer.Close()
+	deadLetterServer := httptest.NewServer(handler(&deadLetters))
+	defer deadLetterServer.Close()
+
+	// rejectEmpty sends the records without data to the dead-letter sink.
+	rejectEmpty := func(next EventMapper) EventMapper {
+		return EventMapperFunc(func(shard *Shard, record *Record) ([]cloudevents.Event, error) {
+			if len(record.Data) == 0 {
+				return nil, errors.New("no data")
+			}
+			return next.MapRecord(shard, record)
+		})
+	}
+	// splitLines delivers every line of the data of the records as an event.
+	splitLines := func(next EventMapper) EventMapper {
+		return EventMapperFunc(func(shard *Shard, record *Record) ([]cloudevents.Event, error) {
+			var events []cloudevents.Event
+			for _, line := range strings.Split(string(record.Data), "\n") {
+				if line == "" {
+					continue
+				}
+				lineRecord := *record
+				lineRecord.Data = []byte(line)
+				lineEvents, err := next.MapRecord(shard, &lineRecord)
+				if err != nil {
+					return nil, err
+				}
+				events = append(events, lineEvents...)
+			}
+			for i := range events {
+				events[i].SetExtension("shard", shard.ID)
+			}
+			return events, nil
+		})
+	}
+
+	streamARN := "arn:aws:kinesis:us-west-2:4444444:stream/kinesis-name"
+	a := &Adapter{
+		SinkURI:           sinkServer.URL,
+		DeadLetterSinkURI: deadLetterServer.URL,
+		streamARN:         &streamARN,
+		PayloadFormat:     PayloadFormatRecord,
+		Compression:       CompressionAuto,
+		CEOverrides:       &v1alpha1.CEOverrides{Type: "com.acme.line"},
+		Middlewares:       []Middleware{rejectEmpty, splitLines},
+		progress:          newProgress(),
+	}
+	var err error
+	if a.overrides, err = compileCEOverrides(a.CEOverrides); err != nil {
+		t.Fatalf("failed to compile the overrides: %v", err)
+	}
+	if err := a.initClient(); err != nil {
+		t.Fatalf("failed to create cloudevent client, %v", err)
+	}
+
+	checkpointer := &fakeCheckpointer{}
+	p := &sourceRecordProcessor{adapter: a, logger: zap.S(), shardID: "shard-0"}
+	p.ProcessRecords(&kc.ProcessRecordsInput{
+		Records: []*ks.Record{
+			{Data: gzipData("a\nb\n"), SequenceNumber: aws.String("1"), PartitionKey: aws.String("p")},
+			{Data: []byte{}, SequenceNumber: aws.String("2"), PartitionKey: aws.String("p")},
+		},
+		Checkpointer: checkpointer,
+	})
+
+	wantDelivered := []request{
+		{eventType: "com.acme.line", shard: `"shard-0"`, body: "a"},
+		{eventType: "com.acme.line", shard: `"shard-0"`, body: "b"},
+	}
+	if diff := cmp.Diff(wantDelivered, delivered, cmp.AllowUnexported(request{})); diff != "" {
+		t.Errorf("unexpected events (-want, +got) = %v", diff)
+	}
+	wantDeadLetters := []request{{eventType: "aws.kinesis.deadletter"}}
+	if diff := cmp.Diff(wantDeadLetters, deadLetters, cmp.AllowUnexported(request{})); diff != "" {
+		t.Errorf("unexpected dead letters (-want, +got) = %v", diff)
+	}
+	if aws.StringValue(checkpointer.sequenceNumber) != "2" {
+		t.Errorf("expected a checkpoint at 2, but got %v", checkpointer.sequenceNumber)
+	}
+}
+
+func TestPayloadFormats(t *testing.T) {
+	// lines delivers every line of the data of the records as an event.
+	lines := EventMapperFunc(func(shard *Shard, record *Record) ([]cloudevents.Event, error) {
+		var events []cloudevents.Event
+		for _, line := range strings.Split(string(record.Data), "\n") {
+			events = append(events, cloudevents.Event{
+				Context: cloudevents.EventContextV02{
+					ID:     line,
+					Type:   "com.acme.line",
+					Source: *types.ParseURLRef("/" + shard.StreamName),
+				}.AsV02(),
+				Data: line,
+			})
+		}
+		return events, nil
+	})
+
+	testCases := map[string]struct {
+		payloadFormat string
+		formats       map[string]EventMapper
+		wantErr       string
+		wantIDs       []string
+	}{
+		"registered": {
+			payloadFormat: "lines",
+			formats:       map[string]EventMapper{"lines": lines},
+			wantIDs:       []string{"a", "b"},
+		},
+		"built-in": {
+			payloadFormat: PayloadFormatRecord,
+			formats:       map[string]EventMapper{"lines": lines},
+			wantIDs:       []string{"1"},
+		},
+		"unknown": {
+			payloadFormat: "lines",
+			wantErr:       `unknown payload format "lines"`,
+		},
+		"taking a built-in name": {
+			payloadFormat: PayloadFormatRecord,
+			formats:       map[string]EventMapper{PayloadFormatRecord: lines},
+			wantErr:       `cannot register the built-in payload format "record"`,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			streamARN := "arn:aws:kinesis:us-west-2:4444444:stream/kinesis-name"
+			a := &Adapter{
+				StreamName:     "kinesis-name",
+				streamARN:      &streamARN,
+				PayloadFormat:  tc.payloadFormat,
+				PayloadFormats: tc.formats,
+			}
+			if err := a.checkPayloadFormat(); err != nil || tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Errorf("expected error %q, but got %v", tc.wantErr, err)
+				}
+				return
+			}
+
+			var ids []string
+			for _, e := range a.newEvents("shard-0", newRecordBatch(&kc.ProcessRecordsInput{
+				Records: []*ks.Record{{Data: []byte("a\nb"), SequenceNumber: aws.String("1"), PartitionKey: aws.String("p")}},
+			}), zap.S()) {
+				ids = append(ids, e.event.ID())
+			}
+			if diff := cmp.Diff(tc.wantIDs, ids); diff != "" {
+				t.Errorf("unexpected events (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
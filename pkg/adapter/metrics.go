@@ -0,0 +1,170 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// cloudWatchMetricsInterval is how often the metrics are published to CloudWatch, by the KCL
+	// and by the adapter.
+	cloudWatchMetricsInterval = 10 * time.Second
+
+	// cloudWatchMaxMetrics is how many metrics PutMetricData takes at once.
+	cloudWatchMaxMetrics = 20
+)
+
+// filteredRecords counts the records of every shard which are not delivered because they do not
+// match the filter. It is published along with the metrics of the KCL, as FilteredRecords to
+// CloudWatch.
+var filteredRecords = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "kinesis_source_filtered_records",
+	Help: "Number of records checkpointed without being delivered because they do not match the filter.",
+}, []string{"shard"})
+
+// registerMetrics registers the metrics of the adapter with Prometheus.
+func registerMetrics() error {
+	if err := prometheus.Register(filteredRecords); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// startMetrics publishes the metrics of the adapter to its metrics backend, along with the ones of
+// the KCL. The returned function publishes them a last time, once the worker is shut down.
+func (a *Adapter) startMetrics(cw cloudwatchiface.CloudWatchAPI, logger *zap.SugaredLogger) (func(), error) {
+	switch a.MetricsBackend {
+	case "", MetricsBackendCloudWatch:
+		p, err := newCloudWatchPublisher(cw, a.ConsumerName, a.StreamName)
+		if err != nil {
+			return nil, err
+		}
+		publish := func() {
+			if err := p.publish(); err != nil {
+				logger.Errorw("Failed to publish the metrics to CloudWatch", zap.Error(err))
+			}
+		}
+		stopCh := make(chan struct{})
+		go wait.Until(publish, cloudWatchMetricsInterval, stopCh)
+		return func() {
+			close(stopCh)
+			publish()
+		}, nil
+	case MetricsBackendPrometheus:
+		// The KCL exposes the default registry.
+		if err := registerMetrics(); err != nil {
+			return nil, err
+		}
+	}
+	return func() {}, nil
+}
+
+// cloudWatchPublisher publishes the metrics of the adapter to CloudWatch, in the namespace of the
+// metrics of the KCL and with the same dimensions.
+type cloudWatchPublisher struct {
+	svc       cloudwatchiface.CloudWatchAPI
+	namespace string
+	stream    string
+	registry  *prometheus.Registry
+
+	mu sync.Mutex
+	// published is how many filtered records of every shard are already published.
+	published map[string]float64
+}
+
+func newCloudWatchPublisher(svc cloudwatchiface.CloudWatchAPI, namespace, stream string) (*cloudWatchPublisher, error) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(filteredRecords); err != nil {
+		return nil, err
+	}
+	return &cloudWatchPublisher{
+		svc:       svc,
+		namespace: namespace,
+		stream:    stream,
+		registry:  registry,
+		published: make(map[string]float64),
+	}, nil
+}
+
+// publish publishes the records of every shard filtered since the last time.
+func (p *cloudWatchPublisher) publish() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	families, err := p.registry.Gather()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var shards []string
+	var counts []float64
+	var data []*cloudwatch.MetricDatum
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			var shard string
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "shard" {
+					shard = label.GetValue()
+				}
+			}
+			count := m.GetCounter().GetValue()
+			if count <= p.published[shard] {
+				continue
+			}
+			shards = append(shards, shard)
+			counts = append(counts, count)
+			data = append(data, &cloudwatch.MetricDatum{
+				Dimensions: []*cloudwatch.Dimension{
+					{Name: aws.String("Shard"), Value: aws.String(shard)},
+					{Name: aws.String("KinesisStreamName"), Value: aws.String(p.stream)},
+				},
+				MetricName: aws.String("FilteredRecords"),
+				Unit:       aws.String(cloudwatch.StandardUnitCount),
+				Timestamp:  &now,
+				Value:      aws.Float64(count - p.published[shard]),
+			})
+		}
+	}
+
+	for i := 0; i < len(data); i += cloudWatchMaxMetrics {
+		end := i + cloudWatchMaxMetrics
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := p.svc.PutMetricData(&cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(p.namespace),
+			MetricData: data[i:end],
+		}); err != nil {
+			return err
+		}
+		for j := i; j < end; j++ {
+			p.published[shards[j]] = counts[j]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCloudWatchPublisher(t *testing.T) {
+	svc := &fakeCloudWatch{}
+	p, err := newCloudWatchPublisher(svc, "consumer", "stream")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	filteredRecords.WithLabelValues("shard-cloudwatch").Add(2)
+	if err := p.publish(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	filteredRecords.WithLabelValues("shard-cloudwatch").Inc()
+	svc.err = errors.New("throttled")
+	if err := p.publish(); err != svc.err {
+		t.Fatalf("expected error %v, but got %v", svc.err, err)
+	}
+	// The records which failed to be published are published the next time.
+	svc.err = nil
+	if err := p.publish(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.publish(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if diff := cmp.Diff([]float64{2, 1}, svc.filtered["shard-cloudwatch"]); diff != "" {
+		t.Errorf("unexpected published values (-want, +got) = %v", diff)
+	}
+}
+
+// fakeCloudWatch records the FilteredRecords values it receives, by shard.
+type fakeCloudWatch struct {
+	cloudwatchiface.CloudWatchAPI
+
+	err      error
+	filtered map[string][]float64
+}
+
+func (f *fakeCloudWatch) PutMetricData(input *cloudwatch.PutMetricDataInput) (*cloudwatch.PutMetricDataOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if aws.StringValue(input.Namespace) != "consumer" {
+		return nil, errors.New("unexpected namespace")
+	}
+	if f.filtered == nil {
+		f.filtered = make(map[string][]float64)
+	}
+	for _, datum := range input.MetricData {
+		if aws.StringValue(datum.MetricName) != "FilteredRecords" {
+			continue
+		}
+		dims := make(map[string]string)
+		for _, dim := range datum.Dimensions {
+			dims[aws.StringValue(dim.Name)] = aws.StringValue(dim.Value)
+		}
+		if dims["KinesisStreamName"] != "stream" {
+			return nil, errors.New("unexpected stream")
+		}
+		f.filtered[dims["Shard"]] = append(f.filtered[dims["Shard"]], aws.Float64Value(datum.Value))
+	}
+	return &cloudwatch.PutMetricDataOutput{}, nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/vmware/vmware-go-kcl/clientlibrary/metrics"
+	"go.uber.org/zap"
+)
+
+// Metrics backends of the KCL.
+const (
+	MetricsBackendCloudWatch = "cloudwatch"
+	MetricsBackendPrometheus = "prometheus"
+	MetricsBackendNone       = "none"
+
+	// prometheusListenAddress is where the metrics are exposed to Prometheus.
+	prometheusListenAddress = ":9090"
+)
+
+// KCLOptions are the tunables of the Kinesis Client Library.
+type KCLOptions struct {
+	MaxRecords         int
+	MaxLeasesForWorker int
+	ShardSyncInterval  time.Duration
+	FailoverTime       time.Duration
+}
+
+// DefaultKCLOptions are the KCL tunables used when none are configured.
+var DefaultKCLOptions = KCLOptions{
+	MaxRecords:         10,
+	MaxLeasesForWorker: 20,
+	ShardSyncInterval:  5 * time.Second,
+	FailoverTime:       5 * time.Minute,
+}
+
+// RetryPolicy defines how the delivery of an event is retried. The backoff doubles after
+// every failed attempt, up to MaxBackoff.
+type RetryPolicy struct {
+	// Attempts is the number of deliveries before giving up, including the first one.
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy delivers every event once.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   1,
+	Backoff:    time.Second,
+	MaxBackoff: 30 * time.Second,
+}
+
+// metricsConfig returns the monitoring configuration of the KCL for the metrics backend.
+func (a *Adapter) metricsConfig(creds *credentials.Credentials) (*metrics.MonitoringConfiguration, error) {
+	switch a.MetricsBackend {
+	case "", MetricsBackendCloudWatch:
+		return &metrics.MonitoringConfiguration{
+			MonitoringService: MetricsBackendCloudWatch,
+			Region:            a.Region,
+			CloudWatch: metrics.CloudWatchMonitoringService{
+				MetricsBufferTimeMillis: int(cloudWatchMetricsInterval / time.Millisecond),
+				MetricsMaxQueueSize:     20,
+				Credentials:             creds,
+			}}, nil
+	case MetricsBackendPrometheus:
+		return &metrics.MonitoringConfiguration{
+			MonitoringService: MetricsBackendPrometheus,
+			Region:            a.Region,
+			Prometheus: metrics.PrometheusMonitoringService{
+				ListenAddress: prometheusListenAddress,
+			}}, nil
+	case MetricsBackendNone:
+		return &metrics.MonitoringConfiguration{}, nil
+	}
+	return nil, fmt.Errorf("unknown metrics backend %q", a.MetricsBackend)
+}
+
+// deliver posts the events to the sink, or the dead letters to the dead-letter sink, in order,
+// retrying each of them as defined by the retry policy. It stops at the first event which is not
+// delivered, and returns how many events were delivered.
+func (a *Adapter) deliver(events []pendingEvent, logger *zap.SugaredLogger) (int, error) {
+	for i, e := range events {
+		if err := a.deliverEvent(e, logger); err != nil {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
+
+// deliverEvent posts an event to its sink, retrying as defined by the retry policy.
+func (a *Adapter) deliverEvent(e pendingEvent, logger *zap.SugaredLogger) error {
+	post := a.postMessage
+	if e.deadLetter {
+		post = a.postDeadLetter
+	}
+	backoff := a.Retry.Backoff
+	for attempt := 1; ; attempt++ {
+		err := post(e.event)
+		if err == nil || attempt >= a.Retry.Attempts {
+			return err
+		}
+		logger.Warnf("Failed to post message, retrying in %v: %v", backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; a.Retry.MaxBackoff > 0 && backoff > a.Retry.MaxBackoff {
+			backoff = a.Retry.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	ks "github.com/aws/aws-sdk-go/service/kinesis"
+	kc "github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+	"go.uber.org/zap"
+)
+
+func TestDeliver(t *testing.T) {
+	testCases := map[string]struct {
+		failures     int
+		attempts     int
+		wantRequests int
+		wantErr      bool
+	}{
+		"no retry": {
+			failures:     0,
+			attempts:     1,
+			wantRequests: 1,
+		},
+		"retried until delivered": {
+			failures:     2,
+			attempts:     3,
+			wantRequests: 3,
+		},
+		"attempts exhausted": {
+			failures:     3,
+			attempts:     2,
+			wantRequests: 2,
+			wantErr:      true,
+		},
+		"no attempts": {
+			failures:     1,
+			attempts:     0,
+			wantRequests: 1,
+			wantErr:      true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			requests := 0
+			sinkServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				requests++
+				if requests <= tc.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer sinkServer.Close()
+
+			streamARN := "arn:aws:kinesis:us-west-2:4444444:stream/kinesis-name"
+			a := &Adapter{
+				SinkURI:   sinkServer.URL,
+				streamARN: &streamARN,
+				Retry:     RetryPolicy{Attempts: tc.attempts, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond},
+			}
+			if err := a.initClient(); err != nil {
+				t.Fatalf("failed to create cloudevent client, %v", err)
+			}
+
+			input := &kc.ProcessRecordsInput{
+				Records: []*ks.Record{{Data: []byte("{}"), SequenceNumber: aws.String("1"), PartitionKey: aws.String("1")}},
+			}
+			_, err := a.deliver(a.newEvents("shard-0", newRecordBatch(input), zap.S()), zap.S())
+			if tc.wantErr != (err != nil) {
+				t.Errorf("expected error %v, but got %v", tc.wantErr, err)
+			}
+			if requests != tc.wantRequests {
+				t.Errorf("expected %d requests, but got %d", tc.wantRequests, requests)
+			}
+		})
+	}
+}
+
+func TestMetricsConfig(t *testing.T) {
+	for backend, want := range map[string]string{
+		"":                       MetricsBackendCloudWatch,
+		MetricsBackendCloudWatch: MetricsBackendCloudWatch,
+		MetricsBackendPrometheus: MetricsBackendPrometheus,
+		MetricsBackendNone:       "",
+	} {
+		got, err := (&Adapter{MetricsBackend: backend}).metricsConfig(nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.MonitoringService != want {
+			t.Errorf("expected monitoring service %q for backend %q, but got %q", want, backend, got.MonitoringService)
+		}
+	}
+
+	if _, err := (&Adapter{MetricsBackend: "statsd"}).metricsConfig(nil); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
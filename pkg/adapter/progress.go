@@ -0,0 +1,166 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	wk "github.com/vmware/vmware-go-kcl/clientlibrary/worker"
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	"github.com/whynowy/knative-source-kinesis/pkg/client/clientset/versioned"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// progressReportInterval is how often the progress of the shards is reported.
+	progressReportInterval = 30 * time.Second
+)
+
+// progress tracks the progress of the shards consumed by the adapter.
+type progress struct {
+	mu     sync.Mutex
+	shards map[string]*v1alpha1.ShardStatus
+}
+
+func newProgress() *progress {
+	return &progress{shards: make(map[string]*v1alpha1.ShardStatus)}
+}
+
+// checkpointed records the checkpoint of a shard, along with its lag.
+func (p *progress) checkpointed(shardID, checkpoint string, millisBehindLatest int64) {
+	now := metav1.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	shard := p.shard(shardID)
+	shard.Checkpoint = checkpoint
+	shard.CheckpointTime = &now
+	shard.MillisBehindLatest = &millisBehindLatest
+}
+
+// polled records the lag of a shard read without any new records, which is idle once caught up.
+func (p *progress) polled(shardID string, millisBehindLatest int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.shard(shardID).MillisBehindLatest = &millisBehindLatest
+}
+
+// ended records that a shard has been consumed entirely.
+func (p *progress) ended(shardID string) {
+	now := metav1.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	shard := p.shard(shardID)
+	shard.Checkpoint = wk.SHARD_END
+	shard.CheckpointTime = &now
+	shard.MillisBehindLatest = nil
+}
+
+func (p *progress) shard(shardID string) *v1alpha1.ShardStatus {
+	shard, ok := p.shards[shardID]
+	if !ok {
+		shard = &v1alpha1.ShardStatus{ShardID: shardID}
+		p.shards[shardID] = shard
+	}
+	return shard
+}
+
+// summarize merges the leases and checkpoints of the lease table with the progress recorded by the
+// adapter, sorted by shard ID.
+func (p *progress) summarize(leases []v1alpha1.ShardStatus) []v1alpha1.ShardStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	merged := make(map[string]v1alpha1.ShardStatus, len(leases)+len(p.shards))
+	for _, shard := range p.shards {
+		merged[shard.ShardID] = *shard.DeepCopy()
+	}
+	for _, lease := range leases {
+		shard := merged[lease.ShardID]
+		shard.ShardID = lease.ShardID
+		shard.Owner = lease.Owner
+		shard.LeaseTimeout = lease.LeaseTimeout
+		if lease.Checkpoint != "" {
+			shard.Checkpoint = lease.Checkpoint
+		}
+		merged[lease.ShardID] = shard
+	}
+
+	shards := make([]v1alpha1.ShardStatus, 0, len(merged))
+	for _, shard := range merged {
+		shards = append(shards, shard)
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i].ShardID < shards[j].ShardID })
+	return shards
+}
+
+// readLeases returns the leases and checkpoints of the lease table.
+func readLeases(dynamo dynamodbiface.DynamoDBAPI, table string) ([]v1alpha1.ShardStatus, error) {
+	var leases []v1alpha1.ShardStatus
+	err := dynamo.ScanPages(&dynamodb.ScanInput{TableName: aws.String(table)},
+		func(page *dynamodb.ScanOutput, _ bool) bool {
+			for _, item := range page.Items {
+				key := item[wk.LEASE_KEY_KEY]
+				if key == nil || aws.StringValue(key.S) == replayTokenKey {
+					continue
+				}
+				lease := v1alpha1.ShardStatus{ShardID: aws.StringValue(key.S)}
+				if owner, ok := item[wk.LEASE_OWNER_KEY]; ok {
+					lease.Owner = aws.StringValue(owner.S)
+				}
+				if timeout, ok := item[wk.LEASE_TIMEOUT_KEY]; ok {
+					if t, err := time.Parse(time.RFC3339, aws.StringValue(timeout.S)); err == nil {
+						lease.LeaseTimeout = &metav1.Time{Time: t}
+					}
+				}
+				if checkpoint, ok := item[wk.CHECKPOINT_SEQUENCE_NUMBER_KEY]; ok {
+					lease.Checkpoint = aws.StringValue(checkpoint.S)
+				}
+				leases = append(leases, lease)
+			}
+			return true
+		})
+	return leases, err
+}
+
+// reportProgress patches the progress of the shards into the status of the KinesisSource.
+func (a *Adapter) reportProgress(sources versioned.Interface, dynamo dynamodbiface.DynamoDBAPI, table string, logger *zap.SugaredLogger) {
+	leases, err := readLeases(dynamo, table)
+	if err != nil {
+		logger.Warnf("Failed to read the lease table: %v", err)
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"shards": a.progress.summarize(leases),
+		},
+	})
+	if err != nil {
+		logger.Warnf("Failed to marshal the progress: %v", err)
+		return
+	}
+	if _, err = sources.SourcesV1alpha1().KinesisSources(a.SourceNamespace).Patch(a.SourceName, types.MergePatchType, patch, "status"); err != nil {
+		logger.Warnf("Failed to report the progress: %v", err)
+	}
+}
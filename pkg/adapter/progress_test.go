@@ -0,0 +1,83 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	wk "github.com/vmware/vmware-go-kcl/clientlibrary/worker"
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProgressSummarize(t *testing.T) {
+	p := newProgress()
+	p.checkpointed("shardId-1", "200", 1500)
+	p.checkpointed("shardId-2", "300", 0)
+	p.ended("shardId-2")
+
+	leaseTimeout := metav1.NewTime(time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC))
+	leases := []v1alpha1.ShardStatus{
+		{ShardID: "shardId-0", Owner: "consumer", LeaseTimeout: &leaseTimeout, Checkpoint: "100"},
+		{ShardID: "shardId-1", Owner: "consumer", LeaseTimeout: &leaseTimeout, Checkpoint: "200"},
+	}
+
+	behind := int64(1500)
+	want := []v1alpha1.ShardStatus{
+		{ShardID: "shardId-0", Owner: "consumer", LeaseTimeout: &leaseTimeout, Checkpoint: "100"},
+		{ShardID: "shardId-1", Owner: "consumer", LeaseTimeout: &leaseTimeout, Checkpoint: "200", MillisBehindLatest: &behind},
+		{ShardID: "shardId-2", Checkpoint: wk.SHARD_END},
+	}
+	got := p.summarize(leases)
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(v1alpha1.ShardStatus{}, "CheckpointTime")); diff != "" {
+		t.Errorf("unexpected shards (-want, +got) = %v", diff)
+	}
+	for _, shard := range got[1:] {
+		if shard.CheckpointTime == nil {
+			t.Errorf("expected a checkpoint time for %s", shard.ShardID)
+		}
+	}
+}
+
+func TestProgressIdleShard(t *testing.T) {
+	p := newProgress()
+	p.checkpointed("shardId-0", "100", 600000)
+	p.polled("shardId-0", 0)
+
+	got := p.summarize(nil)
+	if len(got) != 1 || got[0].Checkpoint != "100" {
+		t.Fatalf("expected the checkpoint of shardId-0 to be kept, got %+v", got)
+	}
+	if behind := got[0].MillisBehindLatest; behind == nil || *behind != 0 {
+		t.Errorf("expected the lag of the idle shard to be cleared, got %v", behind)
+	}
+}
+
+func TestReadLeases(t *testing.T) {
+	dynamo := &fakeDynamoDB{table: "consumer", items: map[string]string{"shardId-0": "100", replayTokenKey: "1"}}
+	leases, err := readLeases(dynamo, "consumer")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []v1alpha1.ShardStatus{{ShardID: "shardId-0", Checkpoint: "100"}}
+	if diff := cmp.Diff(want, leases); diff != "" {
+		t.Errorf("unexpected leases (-want, +got) = %v", diff)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protobufDecoder decodes length-prefixed Protobuf messages of a given type to JSON, following the
+// proto3 JSON mapping. The types are described by FileDescriptorSet messages, as written by
+// protoc --descriptor_set_out --include_imports.
+type protobufDecoder struct {
+	message     protoreflect.MessageDescriptor
+	messageType string
+}
+
+func newProtobufDecoder(files map[string][]byte, messageType string) (*protobufDecoder, error) {
+	// The sets written with --include_imports repeat the files they share.
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	for name, b := range files {
+		var s descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(b, &s); err != nil {
+			return nil, fmt.Errorf("invalid descriptor set %s: %v", name, err)
+		}
+		for _, f := range s.File {
+			if !seen[f.GetName()] {
+				seen[f.GetName()] = true
+				set.File = append(set.File, f)
+			}
+		}
+	}
+	registry, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor sets: %v", err)
+	}
+	desc, err := registry.FindDescriptorByName(protoreflect.FullName(messageType))
+	if err != nil {
+		return nil, fmt.Errorf("unknown message type %q", messageType)
+	}
+	message, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a message type", messageType)
+	}
+	return &protobufDecoder{message: message, messageType: messageType}, nil
+}
+
+func (d *protobufDecoder) decode(b []byte) (json.RawMessage, string, error) {
+	l, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) != l {
+		return nil, "", errors.New("not a length-prefixed message")
+	}
+	msg := dynamicpb.NewMessage(d.message)
+	if err := proto.Unmarshal(b[n:], msg); err != nil {
+		return nil, "", fmt.Errorf("invalid %s message: %v", d.messageType, err)
+	}
+	text, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid %s message: %v", d.messageType, err)
+	}
+	// protojson randomly adds spaces to its output, so that it is not relied upon.
+	var res bytes.Buffer
+	if err := json.Compact(&res, text); err != nil {
+		return nil, "", err
+	}
+	return res.Bytes(), d.messageType, nil
+}
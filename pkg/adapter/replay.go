@@ -0,0 +1,177 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	cfg "github.com/vmware/vmware-go-kcl/clientlibrary/config"
+	wk "github.com/vmware/vmware-go-kcl/clientlibrary/worker"
+	"go.uber.org/zap"
+)
+
+const (
+	// replayTokenKey is the lease table key of the item holding the token of the last replay
+	// applied, it does not collide with shard IDs.
+	replayTokenKey = "knative-replay-token"
+	tokenKey       = "Token"
+)
+
+// Replay describes a rewind of the stream to an earlier position, it mirrors the replay of the
+// KinesisSource spec. Exactly one of Timestamp, SequenceNumbers and TrimHorizon is set.
+type Replay struct {
+	// Token identifies the replay, which is applied once per token.
+	Token string `json:"token"`
+
+	// Timestamp rewinds every shard to the records that arrived at or after it.
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+
+	// SequenceNumbers rewinds the given shards to just after the given sequence numbers.
+	SequenceNumbers map[string]string `json:"sequenceNumbers,omitempty"`
+
+	// TrimHorizon rewinds every shard to its oldest available record.
+	TrimHorizon bool `json:"trimHorizon,omitempty"`
+}
+
+// rewindsAllShards reports whether every shard is read again from its oldest available record.
+// The KCL cannot start a shard at a timestamp, so a replay to a timestamp reads every shard from
+// its oldest record as well, and skips the records which arrived before the timestamp.
+func (r *Replay) rewindsAllShards() bool {
+	return r.TrimHorizon || r.Timestamp != nil
+}
+
+// skipped reports whether a record is older than the replay position, and is not delivered.
+func (r *Replay) skipped(record *kinesis.Record) bool {
+	if r == nil || r.Timestamp == nil || record.ApproximateArrivalTimestamp == nil {
+		return false
+	}
+	return record.ApproximateArrivalTimestamp.Before(*r.Timestamp)
+}
+
+// applyReplay rewrites the checkpoints of the lease table for the replay, unless it has been
+// applied already, and configures the KCL to read the shards without a checkpoint from their
+// oldest record when needed. The receive adapter is stopped by the controller before a replay, so
+// no worker holds a lease while the checkpoints are rewritten.
+func (a *Adapter) applyReplay(dynamo dynamodbiface.DynamoDBAPI, kclConfig *cfg.KinesisClientLibConfiguration, logger *zap.SugaredLogger) error {
+	if a.Replay.rewindsAllShards() {
+		kclConfig.WithInitialPositionInStream(cfg.TRIM_HORIZON)
+	}
+
+	table := aws.String(kclConfig.TableName)
+	if err := ensureLeaseTable(dynamo, kclConfig); err != nil {
+		return err
+	}
+
+	marker, err := dynamo.GetItem(&dynamodb.GetItemInput{
+		TableName:      table,
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]*dynamodb.AttributeValue{
+			wk.LEASE_KEY_KEY: {S: aws.String(replayTokenKey)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if token, ok := marker.Item[tokenKey]; ok && aws.StringValue(token.S) == a.Replay.Token {
+		logger.Infof("Replay %q already applied.", a.Replay.Token)
+		return nil
+	}
+
+	if a.Replay.rewindsAllShards() {
+		var delErr error
+		err = dynamo.ScanPages(&dynamodb.ScanInput{TableName: table, ConsistentRead: aws.Bool(true)},
+			func(page *dynamodb.ScanOutput, _ bool) bool {
+				for _, item := range page.Items {
+					key := item[wk.LEASE_KEY_KEY]
+					if key == nil || aws.StringValue(key.S) == replayTokenKey {
+						continue
+					}
+					if _, delErr = dynamo.DeleteItem(&dynamodb.DeleteItemInput{
+						TableName: table,
+						Key:       map[string]*dynamodb.AttributeValue{wk.LEASE_KEY_KEY: key},
+					}); delErr != nil {
+						return false
+					}
+				}
+				return true
+			})
+		if err != nil {
+			return err
+		}
+		if delErr != nil {
+			return delErr
+		}
+	}
+
+	// The leases are dropped along with the previous checkpoints, they are acquired again by the
+	// worker once started.
+	for shardID, seq := range a.Replay.SequenceNumbers {
+		if _, err = dynamo.PutItem(&dynamodb.PutItemInput{
+			TableName: table,
+			Item: map[string]*dynamodb.AttributeValue{
+				wk.LEASE_KEY_KEY:                  {S: aws.String(shardID)},
+				wk.CHECKPOINT_SEQUENCE_NUMBER_KEY: {S: aws.String(seq)},
+			},
+		}); err != nil {
+			return err
+		}
+	}
+
+	if _, err = dynamo.PutItem(&dynamodb.PutItemInput{
+		TableName: table,
+		Item: map[string]*dynamodb.AttributeValue{
+			wk.LEASE_KEY_KEY: {S: aws.String(replayTokenKey)},
+			tokenKey:         {S: aws.String(a.Replay.Token)},
+		},
+	}); err != nil {
+		return err
+	}
+	logger.Infof("Replay %q applied.", a.Replay.Token)
+	return nil
+}
+
+// ensureLeaseTable creates the lease table with the schema of the KCL when it does not exist yet.
+func ensureLeaseTable(dynamo dynamodbiface.DynamoDBAPI, kclConfig *cfg.KinesisClientLibConfiguration) error {
+	table := aws.String(kclConfig.TableName)
+	_, err := dynamo.DescribeTable(&dynamodb.DescribeTableInput{TableName: table})
+	if !isNotFound(err) {
+		return err
+	}
+
+	if _, err = dynamo.CreateTable(&dynamodb.CreateTableInput{
+		TableName: table,
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{{
+			AttributeName: aws.String(wk.LEASE_KEY_KEY),
+			AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+		}},
+		KeySchema: []*dynamodb.KeySchemaElement{{
+			AttributeName: aws.String(wk.LEASE_KEY_KEY),
+			KeyType:       aws.String(dynamodb.KeyTypeHash),
+		}},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(int64(kclConfig.InitialLeaseTableReadCapacity)),
+			WriteCapacityUnits: aws.Int64(int64(kclConfig.InitialLeaseTableWriteCapacity)),
+		},
+	}); err != nil {
+		return err
+	}
+	return dynamo.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: table})
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	ks "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/google/go-cmp/cmp"
+	cfg "github.com/vmware/vmware-go-kcl/clientlibrary/config"
+	wk "github.com/vmware/vmware-go-kcl/clientlibrary/worker"
+	"go.uber.org/zap"
+)
+
+func TestApplyReplay(t *testing.T) {
+	timestamp := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		replay       *Replay
+		items        map[string]string
+		noTable      bool
+		wantItems    map[string]string
+		wantPosition cfg.InitialPositionInStream
+	}{
+		"trim horizon": {
+			replay:       &Replay{Token: "1", TrimHorizon: true},
+			items:        map[string]string{"shardId-0": "100", "shardId-1": "200"},
+			wantItems:    map[string]string{replayTokenKey: "1"},
+			wantPosition: cfg.TRIM_HORIZON,
+		},
+		"timestamp": {
+			replay:       &Replay{Token: "1", Timestamp: &timestamp},
+			items:        map[string]string{"shardId-0": "100"},
+			wantItems:    map[string]string{replayTokenKey: "1"},
+			wantPosition: cfg.TRIM_HORIZON,
+		},
+		"sequence numbers": {
+			replay:       &Replay{Token: "1", SequenceNumbers: map[string]string{"shardId-1": "150"}},
+			items:        map[string]string{"shardId-0": "100", "shardId-1": "200"},
+			wantItems:    map[string]string{"shardId-0": "100", "shardId-1": "150", replayTokenKey: "1"},
+			wantPosition: cfg.LATEST,
+		},
+		"already applied": {
+			replay:       &Replay{Token: "1", TrimHorizon: true},
+			items:        map[string]string{"shardId-0": "100", replayTokenKey: "1"},
+			wantItems:    map[string]string{"shardId-0": "100", replayTokenKey: "1"},
+			wantPosition: cfg.TRIM_HORIZON,
+		},
+		"new token": {
+			replay:       &Replay{Token: "2", TrimHorizon: true},
+			items:        map[string]string{"shardId-0": "100", replayTokenKey: "1"},
+			wantItems:    map[string]string{replayTokenKey: "2"},
+			wantPosition: cfg.TRIM_HORIZON,
+		},
+		"no lease table": {
+			replay:       &Replay{Token: "1", SequenceNumbers: map[string]string{"shardId-0": "150"}},
+			noTable:      true,
+			wantItems:    map[string]string{"shardId-0": "150", replayTokenKey: "1"},
+			wantPosition: cfg.LATEST,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			dynamo := &fakeDynamoDB{table: "consumer", items: tc.items}
+			if tc.noTable {
+				dynamo.table = ""
+			}
+			kclConfig := cfg.NewKinesisClientLibConfig("consumer", "stream", "us-west-2", "consumer").
+				WithInitialPositionInStream(cfg.LATEST)
+			a := &Adapter{Replay: tc.replay}
+
+			if err := a.applyReplay(dynamo, kclConfig, zap.NewNop().Sugar()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.wantItems, dynamo.items); diff != "" {
+				t.Errorf("unexpected lease table (-want, +got) = %v", diff)
+			}
+			if kclConfig.InitialPositionInStream != tc.wantPosition {
+				t.Errorf("expected initial position %v, but got %v", tc.wantPosition, kclConfig.InitialPositionInStream)
+			}
+		})
+	}
+}
+
+func TestApplyReplayDeleteError(t *testing.T) {
+	dynamo := &fakeDynamoDB{
+		table:     "consumer",
+		items:     map[string]string{"shardId-0": "100"},
+		deleteErr: errors.New("throttled"),
+	}
+	kclConfig := cfg.NewKinesisClientLibConfig("consumer", "stream", "us-west-2", "consumer").
+		WithInitialPositionInStream(cfg.LATEST)
+	a := &Adapter{Replay: &Replay{Token: "1", TrimHorizon: true}}
+
+	if err := a.applyReplay(dynamo, kclConfig, zap.NewNop().Sugar()); err != dynamo.deleteErr {
+		t.Fatalf("expected error %v, but got %v", dynamo.deleteErr, err)
+	}
+	// The token is not recorded, so that the replay is applied again on the next start.
+	if diff := cmp.Diff(map[string]string{"shardId-0": "100"}, dynamo.items); diff != "" {
+		t.Errorf("unexpected lease table (-want, +got) = %v", diff)
+	}
+}
+
+func TestReplayedRecords(t *testing.T) {
+	timestamp := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+	record := func(seq string, arrival time.Time) *ks.Record {
+		return &ks.Record{SequenceNumber: aws.String(seq), ApproximateArrivalTimestamp: aws.Time(arrival)}
+	}
+	records := []*ks.Record{
+		record("1", timestamp.Add(-time.Minute)),
+		record("2", timestamp),
+		record("3", timestamp.Add(time.Minute)),
+	}
+
+	a := &Adapter{Replay: &Replay{Token: "1", Timestamp: &timestamp}}
+	var got []string
+	for _, r := range a.replayedRecords(records) {
+		got = append(got, aws.StringValue(r.SequenceNumber))
+	}
+	if diff := cmp.Diff([]string{"2", "3"}, got); diff != "" {
+		t.Errorf("unexpected records (-want, +got) = %v", diff)
+	}
+}
+
+// fakeDynamoDB is an in-memory lease table, holding the checkpoint or token of every item by key.
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+
+	table     string
+	items     map[string]string
+	deleteErr error
+}
+
+func (f *fakeDynamoDB) DescribeTable(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	if aws.StringValue(input.TableName) != f.table {
+		return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "table not found", nil)
+	}
+	return &dynamodb.DescribeTableOutput{}, nil
+}
+
+func (f *fakeDynamoDB) CreateTable(input *dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error) {
+	f.table = aws.StringValue(input.TableName)
+	f.items = make(map[string]string)
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+func (f *fakeDynamoDB) WaitUntilTableExists(input *dynamodb.DescribeTableInput) error {
+	_, err := f.DescribeTable(input)
+	return err
+}
+
+func (f *fakeDynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	key := aws.StringValue(input.Key[wk.LEASE_KEY_KEY].S)
+	value, ok := f.items[key]
+	if !ok {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{Item: f.item(key, value)}, nil
+}
+
+func (f *fakeDynamoDB) ScanPages(_ *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	page := &dynamodb.ScanOutput{}
+	for key, value := range f.items {
+		page.Items = append(page.Items, f.item(key, value))
+	}
+	fn(page, true)
+	return nil
+}
+
+func (f *fakeDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	if f.deleteErr != nil {
+		return nil, f.deleteErr
+	}
+	delete(f.items, aws.StringValue(input.Key[wk.LEASE_KEY_KEY].S))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	key := aws.StringValue(input.Item[wk.LEASE_KEY_KEY].S)
+	if token, ok := input.Item[tokenKey]; ok {
+		f.items[key] = aws.StringValue(token.S)
+	} else {
+		f.items[key] = aws.StringValue(input.Item[wk.CHECKPOINT_SEQUENCE_NUMBER_KEY].S)
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) item(key, value string) map[string]*dynamodb.AttributeValue {
+	attr := wk.CHECKPOINT_SEQUENCE_NUMBER_KEY
+	if key == replayTokenKey {
+		attr = tokenKey
+	}
+	return map[string]*dynamodb.AttributeValue{
+		wk.LEASE_KEY_KEY: {S: aws.String(key)},
+		attr:             {S: aws.String(value)},
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Schema types.
+const (
+	SchemaTypeAvro     = "avro"
+	SchemaTypeProtobuf = "protobuf"
+)
+
+// Schema defines the schemas the data of the records is decoded to JSON with.
+type Schema struct {
+	// Type is the type of the schemas, SchemaTypeAvro or SchemaTypeProtobuf.
+	Type string
+
+	// Dir is the directory holding the schemas: the Avro schemas in files named after their ID in
+	// the schema registry, or the Protobuf descriptor sets.
+	Dir string
+
+	// MessageType is the full name of the Protobuf message of the records.
+	MessageType string
+
+	// URL identifies the schemas. The dataschema of the events is the URL followed by the ID of
+	// the Avro schema, or by the Protobuf message type, as fragment.
+	URL string
+}
+
+// schemaDecoder decodes data to JSON, and returns the ID of the schema it was decoded with.
+type schemaDecoder interface {
+	decode(b []byte) (json.RawMessage, string, error)
+}
+
+// load reads the schemas of the directory.
+func (s *Schema) load() (schemaDecoder, error) {
+	files, err := readSchemaFiles(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	switch s.Type {
+	case SchemaTypeAvro:
+		return newAvroDecoder(files)
+	case SchemaTypeProtobuf:
+		return newProtobufDecoder(files, s.MessageType)
+	}
+	return nil, fmt.Errorf("unknown schema type %q", s.Type)
+}
+
+// dataSchema returns the dataschema of the data decoded with the schema of the given ID.
+func (s *Schema) dataSchema(id string) string {
+	return s.URL + "#" + id
+}
+
+// readSchemaFiles returns the content of the files of a directory by name. The hidden entries of
+// ConfigMap volumes are skipped.
+func readSchemaFiles(dir string) (map[string][]byte, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte, len(infos))
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), ".") || info.IsDir() {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[info.Name()] = b
+	}
+	return files, nil
+}
+
+// sortedJSON rewrites a JSON value with the members of its objects sorted by name. The numbers
+// are kept as written.
+func sortedJSON(b []byte) (json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,437 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	ks "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/google/go-cmp/cmp"
+	kc "github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const orderAvroSchema = `{"type": "record", "name": "Order", "namespace": "demo", "fields": [
+	{"name": "id", "type": "long"},
+	{"name": "name", "type": "string"},
+	{"name": "tags", "type": {"type": "array", "items": "string"}},
+	{"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["A", "B"]}},
+	{"name": "note", "type": ["null", "string"]},
+	{"name": "counts", "type": {"type": "map", "values": "int"}},
+	{"name": "hash", "type": {"type": "fixed", "name": "Hash", "size": 2}},
+	{"name": "parent", "type": ["null", "Hash"]}
+]}`
+
+func TestDecodeAvro(t *testing.T) {
+	d, err := loadSchema(t, SchemaTypeAvro, "", map[string][]byte{"7": []byte(orderAvroSchema)})
+	if err != nil {
+		t.Fatalf("failed to load the schema: %v", err)
+	}
+
+	testCases := map[string]struct {
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		"valid": {
+			data: avroOrder(7),
+			want: `{"counts":{"k":7},"hash":"\u0001\u0002","id":-3,"kind":"B","name":"ab","note":"hi","parent":null,"tags":["x","y"]}`,
+		},
+		"unknown schema": {
+			data:    avroOrder(8),
+			wantErr: true,
+		},
+		"not in the wire format": {
+			data:    []byte(`{"id":1}`),
+			wantErr: true,
+		},
+		"truncated": {
+			data:    avroOrder(7)[:12],
+			wantErr: true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			got, id, err := d.decode(tc.data)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, but got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if id != "7" {
+				t.Errorf("expected schema 7, but got %q", id)
+			}
+			if string(got) != tc.want {
+				t.Errorf("expected %s, but got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeProtobuf(t *testing.T) {
+	d, err := loadSchema(t, SchemaTypeProtobuf, "demo.Order", map[string][]byte{"order.desc": orderDescriptorSet()})
+	if err != nil {
+		t.Fatalf("failed to load the descriptors: %v", err)
+	}
+
+	msg := protobufOrder()
+
+	testCases := map[string]struct {
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		"valid": {
+			data: append(appendVarint(nil, uint64(len(msg))), msg...),
+			want: `{"id":"1099511627776","name":"ab","tags":["x","y"],"status":"SHIPPED","amounts":[1,300],` +
+				`"labels":{"e":"","k":"v"},"itemInfo":{"sku":"s1"},"ratio":1.5,"delta":"-2"}`,
+		},
+		"wrong length prefix": {
+			data:    append(appendVarint(nil, uint64(len(msg)+1)), msg...),
+			wantErr: true,
+		},
+		"wrong wire type": {
+			data:    append([]byte{2}, appendBytesField(nil, 1, []byte("1"))...),
+			wantErr: true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			got, id, err := d.decode(tc.data)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, but got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if id != "demo.Order" {
+				t.Errorf("expected message type demo.Order, but got %q", id)
+			}
+			if string(got) != tc.want {
+				t.Errorf("expected %s, but got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+// TestDecodeMalformed checks that truncated or corrupted data fails to decode rather than panic.
+func TestDecodeMalformed(t *testing.T) {
+	avro, err := loadSchema(t, SchemaTypeAvro, "", map[string][]byte{"7": []byte(orderAvroSchema)})
+	if err != nil {
+		t.Fatalf("failed to load the schema: %v", err)
+	}
+	protobuf, err := loadSchema(t, SchemaTypeProtobuf, "demo.Order", map[string][]byte{"order.desc": orderDescriptorSet()})
+	if err != nil {
+		t.Fatalf("failed to load the descriptors: %v", err)
+	}
+	msg := protobufOrder()
+
+	testCases := map[string]struct {
+		decoder schemaDecoder
+		data    []byte
+	}{
+		"avro":     {decoder: avro, data: avroOrder(7)},
+		"protobuf": {decoder: protobuf, data: append(appendVarint(nil, uint64(len(msg))), msg...)},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			check := func(data []byte) {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Fatalf("panicked decoding %x: %v", data, r)
+					}
+				}()
+				if got, _, err := tc.decoder.decode(data); err == nil && !json.Valid(got) {
+					t.Errorf("decoded %x to invalid JSON %s", data, got)
+				}
+			}
+			for i := range tc.data {
+				check(tc.data[:i])
+			}
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < 1000; i++ {
+				data := append([]byte(nil), tc.data...)
+				for j := r.Intn(4); j >= 0; j-- {
+					data[r.Intn(len(data))] = byte(r.Intn(256))
+				}
+				check(data)
+			}
+		})
+	}
+}
+
+func TestLoadSchemaErrors(t *testing.T) {
+	testCases := map[string]struct {
+		schemaType  string
+		messageType string
+		files       map[string][]byte
+	}{
+		"invalid avro schema ID": {
+			schemaType: SchemaTypeAvro,
+			files:      map[string][]byte{"order.avsc": []byte(orderAvroSchema)},
+		},
+		"unknown avro type": {
+			schemaType: SchemaTypeAvro,
+			files:      map[string][]byte{"1": []byte(`{"type": "record", "name": "R", "fields": [{"name": "f", "type": "Missing"}]}`)},
+		},
+		"unknown message type": {
+			schemaType:  SchemaTypeProtobuf,
+			messageType: "demo.Missing",
+			files:       map[string][]byte{"order.desc": orderDescriptorSet()},
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			if _, err := loadSchema(t, tc.schemaType, tc.messageType, tc.files); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestProcessRecordsDeadLetter(t *testing.T) {
+	type request struct {
+		schemaURL string
+		reason    string
+		body      string
+	}
+	var delivered, deadLetters []request
+	handler := func(requests *[]request) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			*requests = append(*requests, request{
+				schemaURL: r.Header.Get("Ce-Schemaurl"),
+				reason:    r.Header.Get("Ce-Deadletterreason"),
+				body:      string(body),
+			})
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+	sinkServer := httptest.NewServer(handler(&delivered))
+	defer sinkServer.Close()
+	deadLetterServer := httptest.NewServer(handler(&deadLetters))
+	defer deadLetterServer.Close()
+
+	d, err := loadSchema(t, SchemaTypeAvro, "", map[string][]byte{"7": []byte(orderAvroSchema)})
+	if err != nil {
+		t.Fatalf("failed to load the schema: %v", err)
+	}
+	streamARN := "arn:aws:kinesis:us-west-2:4444444:stream/kinesis-name"
+	a := &Adapter{
+		SinkURI:           sinkServer.URL,
+		DeadLetterSinkURI: deadLetterServer.URL,
+		streamARN:         &streamARN,
+		PayloadFormat:     PayloadFormatRecord,
+		Schema:            &Schema{Type: SchemaTypeAvro, URL: "/api/v1/namespaces/ns/configmaps/schemas"},
+		decoder:           d,
+		progress:          newProgress(),
+	}
+	if err := a.initClient(); err != nil {
+		t.Fatalf("failed to create cloudevent client, %v", err)
+	}
+
+	checkpointer := &fakeCheckpointer{}
+	p := &sourceRecordProcessor{adapter: a, logger: zap.S(), shardID: "shard-0"}
+	p.ProcessRecords(&kc.ProcessRecordsInput{
+		Records: []*ks.Record{
+			{Data: avroOrder(7), SequenceNumber: aws.String("1"), PartitionKey: aws.String("p")},
+			{Data: []byte("plain text"), SequenceNumber: aws.String("2"), PartitionKey: aws.String("p")},
+		},
+		Checkpointer: checkpointer,
+	})
+
+	wantDelivered := []request{{
+		schemaURL: "/api/v1/namespaces/ns/configmaps/schemas#7",
+		body:      `{"counts":{"k":7},"hash":"\u0001\u0002","id":-3,"kind":"B","name":"ab","note":"hi","parent":null,"tags":["x","y"]}`,
+	}}
+	if diff := cmp.Diff(wantDelivered, delivered, cmp.AllowUnexported(request{})); diff != "" {
+		t.Errorf("unexpected events (-want, +got) = %v", diff)
+	}
+	wantDeadLetters := []request{{reason: `"not in the Confluent wire format"`, body: "plain text"}}
+	if diff := cmp.Diff(wantDeadLetters, deadLetters, cmp.AllowUnexported(request{})); diff != "" {
+		t.Errorf("unexpected dead letters (-want, +got) = %v", diff)
+	}
+	if aws.StringValue(checkpointer.sequenceNumber) != "2" {
+		t.Errorf("expected a checkpoint at 2, but got %v", checkpointer.sequenceNumber)
+	}
+}
+
+// loadSchema loads the given schema files from a directory laid out as a ConfigMap volume.
+func loadSchema(t *testing.T, schemaType, messageType string, files map[string][]byte) (schemaDecoder, error) {
+	dir, err := ioutil.TempDir("", "schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "..data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, b := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return (&Schema{Type: schemaType, Dir: dir, MessageType: messageType}).load()
+}
+
+// avroOrder returns an order of orderAvroSchema in the Confluent wire format.
+func avroOrder(schemaID uint32) []byte {
+	b := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], schemaID)
+	b = avroLong(b, -3)
+	b = append(avroLong(b, 2), "ab"...)
+	b = avroLong(b, 2)
+	b = append(avroLong(b, 1), 'x')
+	b = append(avroLong(b, 1), 'y')
+	b = avroLong(b, 0)
+	b = avroLong(b, 1)
+	b = avroLong(b, 1)
+	b = append(avroLong(b, 2), "hi"...)
+	// A map block with its size.
+	b = avroLong(avroLong(b, -1), 3)
+	b = append(avroLong(b, 1), 'k')
+	b = avroLong(b, 7)
+	b = avroLong(b, 0)
+	b = append(b, 1, 2)
+	return avroLong(b, 0)
+}
+
+func avroLong(b []byte, v int64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(b, buf[:binary.PutVarint(buf, v)]...)
+}
+
+// protobufOrder returns an order of orderDescriptorSet, with an unknown field.
+func protobufOrder() []byte {
+	var msg []byte
+	msg = appendVarintField(msg, 1, 1<<40)
+	msg = appendBytesField(msg, 2, []byte("ab"))
+	msg = appendBytesField(msg, 3, []byte("x"))
+	msg = appendBytesField(msg, 3, []byte("y"))
+	msg = appendVarintField(msg, 4, 1)
+	msg = appendBytesField(msg, 5, appendVarint(appendVarint(nil, 1), 300))
+	msg = appendBytesField(msg, 6, appendBytesField(appendBytesField(nil, 1, []byte("k")), 2, []byte("v")))
+	msg = appendBytesField(msg, 6, appendBytesField(nil, 1, []byte("e")))
+	msg = appendBytesField(msg, 7, appendBytesField(nil, 1, []byte("s1")))
+	msg = protowire.AppendFixed64(protowire.AppendTag(msg, 8, protowire.Fixed64Type), math.Float64bits(1.5))
+	msg = appendVarintField(msg, 9, 3)
+	msg = appendVarintField(msg, 99, 1)
+	return msg
+}
+
+// orderDescriptorSet returns the FileDescriptorSet of:
+//
+//	package demo;
+//	enum Status { UNKNOWN = 0; SHIPPED = 1; }
+//	message Order {
+//	  message ItemInfo { string sku = 1; }
+//	  int64 id = 1;
+//	  string name = 2;
+//	  repeated string tags = 3;
+//	  Status status = 4;
+//	  repeated int32 amounts = 5;
+//	  map<string, string> labels = 6;
+//	  ItemInfo item_info = 7;
+//	  double ratio = 8;
+//	  sint64 delta = 9;
+//	}
+func orderDescriptorSet() []byte {
+	field := func(name string, number int32, label descriptorpb.FieldDescriptorProto_Label,
+		typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Label:  label.Enum(),
+			Type:   typ.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING
+	msg := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("order.proto"),
+		Package: proto.String("demo"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("SHIPPED"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Order"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+				field("name", 2, optional, str, ""),
+				field("tags", 3, repeated, str, ""),
+				field("status", 4, optional, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".demo.Status"),
+				field("amounts", 5, repeated, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+				field("labels", 6, repeated, msg, ".demo.Order.LabelsEntry"),
+				field("item_info", 7, optional, msg, ".demo.Order.ItemInfo"),
+				field("ratio", 8, optional, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+				field("delta", 9, optional, descriptorpb.FieldDescriptorProto_TYPE_SINT64, ""),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{
+				{
+					Name:  proto.String("ItemInfo"),
+					Field: []*descriptorpb.FieldDescriptorProto{field("sku", 1, optional, str, "")},
+				},
+				{
+					Name:    proto.String("LabelsEntry"),
+					Field:   []*descriptorpb.FieldDescriptorProto{field("key", 1, optional, str, ""), field("value", 2, optional, str, "")},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				},
+			},
+		}},
+	}}}
+	b, err := proto.Marshal(set)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func appendVarintField(b []byte, field protowire.Number, v uint64) []byte {
+	return protowire.AppendVarint(protowire.AppendTag(b, field, protowire.VarintType), v)
+}
@@ -0,0 +1,355 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/cloudevents/sdk-go/pkg/cloudevents"
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+)
+
+// transform is the compiled Transform of the adapter, its steps are applied in order.
+type transform []transformStep
+
+// transformStep is a step of the transform along with its parsed paths, From and To alternating
+// for Rename.
+type transformStep struct {
+	v1alpha1.TransformStep
+	paths [][]v1alpha1.PathSegment
+}
+
+// compileTransform parses the paths of the steps.
+func compileTransform(steps []v1alpha1.TransformStep) (transform, error) {
+	t := make(transform, 0, len(steps))
+	for _, step := range steps {
+		s := transformStep{TransformStep: step}
+		if err := s.compile(); err != nil {
+			return nil, err
+		}
+		t = append(t, s)
+	}
+	return t, nil
+}
+
+func (s *transformStep) compile() error {
+	paths := append(append([]string(nil), s.Select...), s.Drop...)
+	for _, rename := range s.Rename {
+		paths = append(paths, rename.From, rename.To)
+	}
+	if s.Mask != nil {
+		if s.Mask.Replacement == nil && s.Mask.Hash != v1alpha1.MaskHashSHA256 {
+			return fmt.Errorf("unknown mask hash %q", s.Mask.Hash)
+		}
+		paths = append(paths, s.Mask.Paths...)
+	}
+	for _, value := range s.Add {
+		if len(value.Value.Raw) > 0 && !json.Valid(value.Value.Raw) {
+			return fmt.Errorf("invalid value of %s: %s", value.Path, value.Value.Raw)
+		}
+		paths = append(paths, value.Path)
+	}
+
+	s.paths = make([][]v1alpha1.PathSegment, 0, len(paths))
+	for _, path := range paths {
+		segments, err := v1alpha1.ParseFieldPath(path)
+		if err != nil {
+			return err
+		}
+		s.paths = append(s.paths, segments)
+	}
+	return nil
+}
+
+// transform returns a copy of a record whose data is transformed, the record is left as is for
+// the dead-letter sink. A nil or empty transform returns the record itself.
+func (t transform) transformRecord(record *Record) (*Record, error) {
+	if len(t) == 0 {
+		return record, nil
+	}
+	data, err := t.apply(record.Data)
+	if err != nil {
+		return nil, err
+	}
+	transformed := *record
+	transformed.Data = data
+	return &transformed, nil
+}
+
+// transformRecords is the middleware transforming the data of the records.
+func (a *Adapter) transformRecords(next EventMapper) EventMapper {
+	return EventMapperFunc(func(shard *Shard, record *Record) ([]cloudevents.Event, error) {
+		transformed, err := a.transform.transformRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		return next.MapRecord(shard, transformed)
+	})
+}
+
+// apply transforms JSON data. The fields of the objects it returns are sorted.
+func (t transform) apply(data []byte) ([]byte, error) {
+	doc, err := decodeJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot transform data which is not JSON: %v", err)
+	}
+	for i := range t {
+		if doc, err = t[i].apply(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+func (s *transformStep) apply(doc interface{}) (interface{}, error) {
+	switch {
+	case len(s.Select) > 0:
+		if selected, ok := selectPaths(doc, s.paths); ok {
+			return selected, nil
+		}
+		return map[string]interface{}{}, nil
+
+	case len(s.Drop) > 0:
+		for _, path := range s.paths {
+			doc, _ = updatePath(doc, path, false, func(interface{}) (interface{}, bool) {
+				return nil, false
+			})
+		}
+
+	case len(s.Rename) > 0:
+		for i, rename := range s.Rename {
+			from, to := s.paths[2*i], s.paths[2*i+1]
+			value, found := lookupPath(doc, from)
+			if !found {
+				continue
+			}
+			doc, _ = updatePath(doc, from, false, func(interface{}) (interface{}, bool) {
+				return nil, false
+			})
+			var err error
+			if doc, err = updatePath(doc, to, true, func(interface{}) (interface{}, bool) {
+				return value, true
+			}); err != nil {
+				return nil, fmt.Errorf("cannot rename %s to %s: %v", rename.From, rename.To, err)
+			}
+		}
+
+	case s.Mask != nil:
+		for _, path := range s.paths {
+			doc, _ = updatePath(doc, path, false, func(value interface{}) (interface{}, bool) {
+				return mask(s.Mask, value), true
+			})
+		}
+
+	case len(s.Add) > 0:
+		for i, value := range s.Add {
+			var err error
+			if doc, err = updatePath(doc, s.paths[i], true, func(interface{}) (interface{}, bool) {
+				return decodeValue(&value), true
+			}); err != nil {
+				return nil, fmt.Errorf("cannot add %s: %v", value.Path, err)
+			}
+		}
+	}
+	return doc, nil
+}
+
+// mask returns the SHA-256 hash of a string in hex, or of the JSON text of the other values, or
+// the replacement if set.
+func mask(m *v1alpha1.MaskSpec, value interface{}) interface{} {
+	if m.Replacement != nil {
+		return *m.Replacement
+	}
+	s, ok := value.(string)
+	if !ok {
+		b, _ := json.Marshal(value)
+		s = string(b)
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// decodeValue returns a new copy of the value of a field, so that the records never share it.
+func decodeValue(v *v1alpha1.FieldValue) interface{} {
+	if len(v.Value.Raw) == 0 {
+		return nil
+	}
+	// The value is checked by compile, decoding it does not fail.
+	value, _ := decodeJSON(v.Value.Raw)
+	return value
+}
+
+// selectPaths returns the parts of a node designated by the paths, and whether there are any. The
+// elements of arrays which are not selected are removed.
+func selectPaths(node interface{}, paths [][]v1alpha1.PathSegment) (interface{}, bool) {
+	for _, path := range paths {
+		if len(path) == 0 {
+			return node, true
+		}
+	}
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		selected := map[string]interface{}{}
+		for key, child := range n {
+			var rest [][]v1alpha1.PathSegment
+			for _, path := range paths {
+				if path[0].Wildcard || (path[0].Index < 0 && path[0].Field == key) {
+					rest = append(rest, path[1:])
+				}
+			}
+			if value, ok := selectPaths(child, rest); ok {
+				selected[key] = value
+			}
+		}
+		return selected, len(selected) > 0
+
+	case []interface{}:
+		var selected []interface{}
+		for i, elem := range n {
+			var rest [][]v1alpha1.PathSegment
+			for _, path := range paths {
+				if path[0].Wildcard || path[0].Index == i {
+					rest = append(rest, path[1:])
+				}
+			}
+			if value, ok := selectPaths(elem, rest); ok {
+				selected = append(selected, value)
+			}
+		}
+		return selected, len(selected) > 0
+	}
+	return nil, false
+}
+
+// lookupPath returns the value designated by a path without wildcards, and whether it exists.
+func lookupPath(node interface{}, path []v1alpha1.PathSegment) (interface{}, bool) {
+	for _, segment := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			value, ok := n[segment.Field]
+			if !ok || segment.Index >= 0 {
+				return nil, false
+			}
+			node = value
+		case []interface{}:
+			if segment.Index < 0 || segment.Index >= len(n) {
+				return nil, false
+			}
+			node = n[segment.Index]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// updatePath replaces the values designated by a path in a node with the result of fn, or removes
+// them when it returns false, and returns the updated node. The values which do not exist are
+// skipped, or passed to fn as nil if create is set, in which case the missing objects on the path
+// are created; a path going through another value is then an error, unless at a wildcard.
+func updatePath(node interface{}, path []v1alpha1.PathSegment, create bool, fn func(interface{}) (interface{}, bool)) (interface{}, error) {
+	segment, last := path[0], len(path) == 1
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if segment.Index >= 0 {
+			break
+		}
+		keys := []string{segment.Field}
+		if segment.Wildcard {
+			keys = make([]string, 0, len(n))
+			for key := range n {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+		}
+		for _, key := range keys {
+			child, found := n[key]
+			if !found && !create {
+				continue
+			}
+			if last {
+				if value, keep := fn(child); keep {
+					n[key] = value
+				} else {
+					delete(n, key)
+				}
+				continue
+			}
+			if !found {
+				child = map[string]interface{}{}
+			}
+			value, err := updatePath(child, path[1:], create, fn)
+			if err != nil {
+				return nil, err
+			}
+			n[key] = value
+		}
+		return n, nil
+
+	case []interface{}:
+		if !segment.Wildcard && segment.Index < 0 {
+			break
+		}
+		if !segment.Wildcard && segment.Index >= len(n) {
+			if create {
+				return nil, fmt.Errorf("no element %d in an array of %d", segment.Index, len(n))
+			}
+			return n, nil
+		}
+		updated := make([]interface{}, 0, len(n))
+		for i, elem := range n {
+			if !segment.Wildcard && i != segment.Index {
+				updated = append(updated, elem)
+				continue
+			}
+			if last {
+				if value, keep := fn(elem); keep {
+					updated = append(updated, value)
+				}
+				continue
+			}
+			value, err := updatePath(elem, path[1:], create, fn)
+			if err != nil {
+				return nil, err
+			}
+			updated = append(updated, value)
+		}
+		return updated, nil
+	}
+
+	if create && !segment.Wildcard {
+		if segment.Index >= 0 {
+			return nil, fmt.Errorf("no array to set element %d in", segment.Index)
+		}
+		return nil, fmt.Errorf("no object to set field %q in", segment.Field)
+	}
+	return node, nil
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	ks "github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/google/go-cmp/cmp"
+	kc "github.com/vmware/vmware-go-kcl/clientlibrary/interfaces"
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestTransform(t *testing.T) {
+	data := `{"user":{"email":"a@b.c","age":42},"items":[{"sku":"A1","price":3},{"sku":"B2","price":5}],"note":"<x>"}`
+
+	testCases := map[string]struct {
+		transform []v1alpha1.TransformStep
+		data      string
+		want      string
+		wantErr   string
+	}{
+		"select": {
+			transform: []v1alpha1.TransformStep{{Select: []string{"$.user.email", "$.items[*].sku", "$.missing"}}},
+			want:      `{"items":[{"sku":"A1"},{"sku":"B2"}],"user":{"email":"a@b.c"}}`,
+		},
+		"select an element": {
+			transform: []v1alpha1.TransformStep{{Select: []string{"$.items[1]"}}},
+			want:      `{"items":[{"price":5,"sku":"B2"}]}`,
+		},
+		"select nothing": {
+			transform: []v1alpha1.TransformStep{{Select: []string{"$.missing"}}},
+			want:      `{}`,
+		},
+		"drop": {
+			transform: []v1alpha1.TransformStep{{Drop: []string{"$.user", "$.items[*].price", "$['note']"}}},
+			want:      `{"items":[{"sku":"A1"},{"sku":"B2"}]}`,
+		},
+		"drop an element": {
+			transform: []v1alpha1.TransformStep{{Drop: []string{"$.items[0]", "$.user.*"}}},
+			want:      `{"items":[{"price":5,"sku":"B2"}],"note":"<x>","user":{}}`,
+		},
+		"rename": {
+			transform: []v1alpha1.TransformStep{{Rename: []v1alpha1.FieldRename{
+				{From: "$.user.email", To: "$.contact.email"},
+				{From: "$.missing", To: "$.other"},
+			}}},
+			want: `{"contact":{"email":"a@b.c"},"items":[{"price":3,"sku":"A1"},{"price":5,"sku":"B2"}],"note":"<x>","user":{"age":42}}`,
+		},
+		"mask with a hash": {
+			transform: []v1alpha1.TransformStep{{Select: []string{"$.user"}}, {Mask: &v1alpha1.MaskSpec{Paths: []string{"$.user.*", "$.missing"}, Hash: "sha256"}}},
+			want:      `{"user":{"age":"73475cb40a568e8da8a045ced110137e159f890ac4da883b6b17dc651b3a8049","email":"d648b243a3e817eaa3309e00e183483f2867baadf522099f0c2121770536b25a"}}`,
+		},
+		"mask with a replacement": {
+			transform: []v1alpha1.TransformStep{{Select: []string{"$.items"}}, {Mask: &v1alpha1.MaskSpec{Paths: []string{"$.items[*].sku"}, Replacement: aws.String("***")}}},
+			want:      `{"items":[{"price":3,"sku":"***"},{"price":5,"sku":"***"}]}`,
+		},
+		"add": {
+			transform: []v1alpha1.TransformStep{{Select: []string{"$.items"}}, {Add: []v1alpha1.FieldValue{
+				{Path: "$.meta.origin", Value: runtime.RawExtension{Raw: []byte(`"eu"`)}},
+				{Path: "$.items[*].tags", Value: runtime.RawExtension{Raw: []byte(`["new"]`)}},
+				{Path: "$.items[0].price"},
+			}}},
+			want: `{"items":[{"price":null,"sku":"A1","tags":["new"]},{"price":5,"sku":"B2","tags":["new"]}],"meta":{"origin":"eu"}}`,
+		},
+		"add under a value": {
+			transform: []v1alpha1.TransformStep{{Add: []v1alpha1.FieldValue{{Path: "$.note.text", Value: runtime.RawExtension{Raw: []byte(`1`)}}}}},
+			wantErr:   `cannot add $.note.text: no object to set field "text" in`,
+		},
+		"add past an array": {
+			transform: []v1alpha1.TransformStep{{Add: []v1alpha1.FieldValue{{Path: "$.items[2].sku", Value: runtime.RawExtension{Raw: []byte(`"C3"`)}}}}},
+			wantErr:   `cannot add $.items[2].sku: no element 2 in an array of 2`,
+		},
+		"not JSON": {
+			transform: []v1alpha1.TransformStep{{Drop: []string{"$.a"}}},
+			data:      "plain text",
+			wantErr:   "cannot transform data which is not JSON: invalid character 'p' looking for beginning of value",
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			transform, err := compileTransform(tc.transform)
+			if err != nil {
+				t.Fatalf("failed to compile the transform: %v", err)
+			}
+			d := data
+			if tc.data != "" {
+				d = tc.data
+			}
+			got, err := transform.apply([]byte(d))
+			if err != nil {
+				if err.Error() != tc.wantErr {
+					t.Errorf("expected error %q, but got %q", tc.wantErr, err)
+				}
+				return
+			}
+			if tc.wantErr != "" {
+				t.Fatalf("expected error %q, but got none", tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("unexpected data (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
+
+// TestTransformEnv checks the transform written to the env of the receive adapter by the reconciler.
+func TestTransformEnv(t *testing.T) {
+	var steps []v1alpha1.TransformStep
+	env := `[{"drop":["$.ssn"]},{"add":[{"path":"$.origin","value":{"region":"eu"}},{"path":"$.note","value":null}]}]`
+	if err := json.Unmarshal([]byte(env), &steps); err != nil {
+		t.Fatalf("failed to unmarshal the transform: %v", err)
+	}
+	transform, err := compileTransform(steps)
+	if err != nil {
+		t.Fatalf("failed to compile the transform: %v", err)
+	}
+	got, err := transform.apply([]byte(`{"ssn":"123","id":1}`))
+	if err != nil {
+		t.Fatalf("failed to transform: %v", err)
+	}
+	if want := `{"id":1,"note":null,"origin":{"region":"eu"}}`; string(got) != want {
+		t.Errorf("expected %s, but got %s", want, got)
+	}
+}
+
+func TestProcessRecordsTransformed(t *testing.T) {
+	var bodies, deadLetters []string
+	handler := func(bodies *[]string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			*bodies = append(*bodies, string(body))
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+	sinkServer := httptest.NewServer(handler(&bodies))
+	defer sinkServer.Close()
+	deadLetterServer := httptest.NewServer(handler(&deadLetters))
+	defer deadLetterServer.Close()
+
+	streamARN := "arn:aws:kinesis:us-west-2:4444444:stream/kinesis-name"
+	a := &Adapter{
+		SinkURI:           sinkServer.URL,
+		DeadLetterSinkURI: deadLetterServer.URL,
+		streamARN:         &streamARN,
+		PayloadFormat:     PayloadFormatRecord,
+		DataContentType:   DataContentTypeJSON,
+		Transform: []v1alpha1.TransformStep{
+			{Drop: []string{"$.ssn"}},
+			{Add: []v1alpha1.FieldValue{{Path: "$.user.origin", Value: runtime.RawExtension{Raw: []byte(`"eu"`)}}}},
+		},
+		progress: newProgress(),
+	}
+	var err error
+	if a.transform, err = compileTransform(a.Transform); err != nil {
+		t.Fatalf("failed to compile the transform: %v", err)
+	}
+	if err := a.initClient(); err != nil {
+		t.Fatalf("failed to create cloudevent client, %v", err)
+	}
+
+	checkpointer := &fakeCheckpointer{}
+	p := &sourceRecordProcessor{adapter: a, logger: zap.S(), shardID: "shard-0"}
+	p.ProcessRecords(&kc.ProcessRecordsInput{
+		Records: []*ks.Record{
+			{Data: []byte(`{"user":{"id":1},"ssn":"123"}`), SequenceNumber: aws.String("1"), PartitionKey: aws.String("p")},
+			{Data: []byte(`{"user":"anonymous","ssn":"456"}`), SequenceNumber: aws.String("2"), PartitionKey: aws.String("p")},
+		},
+		Checkpointer: checkpointer,
+	})
+
+	if diff := cmp.Diff([]string{`{"user":{"id":1,"origin":"eu"}}`}, bodies); diff != "" {
+		t.Errorf("unexpected bodies (-want, +got) = %v", diff)
+	}
+	if diff := cmp.Diff([]string{`{"user":"anonymous","ssn":"456"}`}, deadLetters); diff != "" {
+		t.Errorf("unexpected dead letters (-want, +got) = %v", diff)
+	}
+	if aws.StringValue(checkpointer.sequenceNumber) != "2" {
+		t.Errorf("expected a checkpoint at 2, but got %v", checkpointer.sequenceNumber)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PathSegment is a segment of a parsed transform path: the name of a field,
+// the index of an element, or * for every field or element.
+// +k8s:deepcopy-gen=false
+type PathSegment struct {
+	// Field is the name of the field, when Index is negative.
+	Field string
+
+	// Index is the index of the element, it is negative for fields.
+	Index int
+
+	// Wildcard stands for every field or element.
+	Wildcard bool
+}
+
+// ParseFieldPath parses a transform path, such as $.a.b, $.a['b'], $.a[0] or
+// $.items[*].sku. It designates at least one field.
+func ParseFieldPath(path string) ([]PathSegment, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path %q does not start with $", path)
+	}
+	var segments []PathSegment
+	for i := 1; i < len(path); {
+		switch path[i] {
+		case '.':
+			end := i + 1
+			for end < len(path) && path[end] != '.' && path[end] != '[' {
+				end++
+			}
+			name := path[i+1 : end]
+			switch name {
+			case "":
+				return nil, fmt.Errorf("path %q has an empty field name", path)
+			case "*":
+				segments = append(segments, PathSegment{Index: -1, Wildcard: true})
+			default:
+				segments = append(segments, PathSegment{Field: name, Index: -1})
+			}
+			i = end
+		case '[':
+			if strings.HasPrefix(path[i:], "['") {
+				end := strings.Index(path[i+2:], "']")
+				if end < 0 {
+					return nil, fmt.Errorf("path %q has an unterminated field name", path)
+				}
+				segments = append(segments, PathSegment{Field: path[i+2 : i+2+end], Index: -1})
+				i += end + 4
+				continue
+			}
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q has an unterminated index", path)
+			}
+			inner := path[i+1 : i+end]
+			if inner == "*" {
+				segments = append(segments, PathSegment{Index: -1, Wildcard: true})
+			} else if index, err := strconv.Atoi(inner); err == nil && index >= 0 {
+				segments = append(segments, PathSegment{Index: index})
+			} else {
+				return nil, fmt.Errorf("path %q has an invalid index %q", path, inner)
+			}
+			i += end + 1
+		default:
+			return nil, fmt.Errorf("path %q has an unexpected %q at offset %d", path, path[i], i)
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("path %q does not designate a field", path)
+	}
+	return segments, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseFieldPath(t *testing.T) {
+	testCases := map[string]struct {
+		path    string
+		want    []PathSegment
+		wantErr bool
+	}{
+		"fields": {
+			path: "$.detail['user.name'].email",
+			want: []PathSegment{{Field: "detail", Index: -1}, {Field: "user.name", Index: -1}, {Field: "email", Index: -1}},
+		},
+		"indexes and wildcards": {
+			path: "$.items[*].tags[0].*",
+			want: []PathSegment{{Field: "items", Index: -1}, {Index: -1, Wildcard: true}, {Field: "tags", Index: -1}, {Index: 0}, {Index: -1, Wildcard: true}},
+		},
+		"root": {
+			path:    "$",
+			wantErr: true,
+		},
+		"relative": {
+			path:    "detail.email",
+			wantErr: true,
+		},
+		"empty field name": {
+			path:    "$.detail..email",
+			wantErr: true,
+		},
+		"negative index": {
+			path:    "$.items[-1]",
+			wantErr: true,
+		},
+		"unterminated index": {
+			path:    "$.items[0",
+			wantErr: true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			got, err := ParseFieldPath(tc.path)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, but got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected segments (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
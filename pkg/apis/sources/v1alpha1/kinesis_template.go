@@ -0,0 +1,129 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Variables of the CEOverrides templates.
+const (
+	// TemplateVariableStream is the name of the stream.
+	TemplateVariableStream = "stream"
+
+	// TemplateVariableShard is the ID of the shard of the record.
+	TemplateVariableShard = "shard"
+
+	// TemplateVariablePartitionKey is the partition key of the record.
+	TemplateVariablePartitionKey = "partitionKey"
+)
+
+// TemplatePart is a part of a parsed CEOverrides template: literal text, or a
+// placeholder replaced with a variable or with the value selected by a
+// JSONPath expression.
+// +k8s:deepcopy-gen=false
+type TemplatePart struct {
+	// Literal is the text of a literal part.
+	Literal string
+
+	// Variable is the variable of a placeholder.
+	Variable string
+
+	// Path is the JSONPath expression of a placeholder.
+	Path string
+
+	// Fallback replaces the placeholder when its lookup fails, if not nil.
+	Fallback *string
+}
+
+// ParseTemplate parses a template of the CEOverrides.
+func ParseTemplate(s string) ([]TemplatePart, error) {
+	var parts []TemplatePart
+	var literal strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "$$"):
+			literal.WriteByte('$')
+			i += 2
+		case strings.HasPrefix(s[i:], "${"):
+			end, sep := placeholderEnd(s, i+2)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated placeholder at offset %d", i)
+			}
+			part := TemplatePart{}
+			expr := s[i+2 : end]
+			if sep >= 0 {
+				fallback := s[sep+2 : end]
+				part.Fallback = &fallback
+				expr = s[i+2 : sep]
+			}
+			switch expr {
+			case TemplateVariableStream, TemplateVariableShard, TemplateVariablePartitionKey:
+				part.Variable = expr
+			default:
+				if !strings.HasPrefix(expr, "$") {
+					return nil, fmt.Errorf("unknown variable %q", expr)
+				}
+				if err := jsonpath.New(expr).Parse(JSONPathTemplate(expr)); err != nil {
+					return nil, fmt.Errorf("invalid JSONPath %q: %v", expr, err)
+				}
+				part.Path = expr
+			}
+			if literal.Len() > 0 {
+				parts = append(parts, TemplatePart{Literal: literal.String()})
+				literal.Reset()
+			}
+			parts = append(parts, part)
+			i = end + 1
+		default:
+			literal.WriteByte(s[i])
+			i++
+		}
+	}
+	if literal.Len() > 0 {
+		parts = append(parts, TemplatePart{Literal: literal.String()})
+	}
+	return parts, nil
+}
+
+// placeholderEnd returns the index of the brace closing the placeholder whose
+// expression starts at i, and the index of the :- preceding its fallback, or
+// -1. Brackets of JSONPath expressions, such as slices, may hold :- and }.
+func placeholderEnd(s string, i int) (int, int) {
+	depth := 0
+	for ; i < len(s); i++ {
+		switch {
+		case s[i] == '[':
+			depth++
+		case s[i] == ']' && depth > 0:
+			depth--
+		case depth > 0:
+		case s[i] == '}':
+			return i, -1
+		case strings.HasPrefix(s[i:], ":-"):
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return -1, -1
+			}
+			return i + 2 + end, i
+		}
+	}
+	return -1, -1
+}
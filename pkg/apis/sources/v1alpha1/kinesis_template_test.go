@@ -0,0 +1,79 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseTemplate(t *testing.T) {
+	testCases := map[string]struct {
+		template string
+		want     []TemplatePart
+		wantErr  bool
+	}{
+		"literal": {
+			template: "com.acme.order",
+			want:     []TemplatePart{{Literal: "com.acme.order"}},
+		},
+		"variables": {
+			template: "/${stream}/${shard}/$$${partitionKey}",
+			want: []TemplatePart{
+				{Literal: "/"}, {Variable: "stream"}, {Literal: "/"}, {Variable: "shard"},
+				{Literal: "/$"}, {Variable: "partitionKey"},
+			},
+		},
+		"paths with fallbacks": {
+			template: "com.acme.${$.detail.type:-unknown}.${$.items[0:-1].sku:-}",
+			want: []TemplatePart{
+				{Literal: "com.acme."}, {Path: "$.detail.type", Fallback: stringPtr("unknown")},
+				{Literal: "."}, {Path: "$.items[0:-1].sku", Fallback: stringPtr("")},
+			},
+		},
+		"unterminated placeholder": {
+			template: "com.acme.${$.detail.type",
+			wantErr:  true,
+		},
+		"unknown variable": {
+			template: "${region}",
+			wantErr:  true,
+		},
+		"invalid JSONPath": {
+			template: "${$.items[}",
+			wantErr:  true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			got, err := ParseTemplate(tc.template)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, but got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected parts (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
@@ -17,6 +17,9 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/knative/pkg/apis/duck"
 	duckv1alpha1 "github.com/knative/pkg/apis/duck/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
@@ -64,9 +67,547 @@ type KinesisSourceSpec struct {
 	// +optional
 	Sink *corev1.ObjectReference `json:"sink,omitempty"`
 
+	// SinkURI is the URI events will be delivered to. When Sink is also set,
+	// SinkURI must be a relative reference whose path is appended to the
+	// address of the Sink, e.g. a path on an Addressable Service.
+	// +optional
+	SinkURI string `json:"sinkUri,omitempty"`
+
 	// ServiceAccoutName is the name of the ServiceAccount that will be used to
 	// run the Receive Adapter Deployment.
 	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Suspend scales the Receive Adapter down to zero to stop consuming the
+	// stream. Checkpoints are kept, and consumption resumes from them once
+	// Suspend is set back to false.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Template is merged over the pod template of the generated Receive
+	// Adapter Deployment.
+	// +optional
+	Template *ReceiveAdapterTemplate `json:"template,omitempty"`
+
+	// Replay rewinds the source to an earlier position of the stream. The
+	// rewind is carried out once per token: changing the token stops the
+	// Receive Adapter, rewrites its checkpoints and restarts it.
+	// +optional
+	Replay *ReplaySpec `json:"replay,omitempty"`
+
+	// DeletionPolicy tells what happens to the AWS resources of the source,
+	// the DynamoDB lease table and the stream consumers registered under the
+	// source name, when the source is deleted. Defaults to Retain.
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// LagThreshold is how far behind the tip of the stream a shard may be
+	// before the source is reported as Lagging. Defaults to 5 minutes.
+	// +optional
+	LagThreshold *metav1.Duration `json:"lagThreshold,omitempty"`
+
+	// KCL tunes the Kinesis Client Library of the Receive Adapter. Unset
+	// fields default to the config-kinesis-source ConfigMap.
+	// +optional
+	KCL *KCLSpec `json:"kcl,omitempty"`
+
+	// MetricsBackend is where the Kinesis Client Library of the Receive
+	// Adapter reports its metrics to. Defaults to the config-kinesis-source
+	// ConfigMap.
+	// +optional
+	MetricsBackend MetricsBackend `json:"metricsBackend,omitempty"`
+
+	// Retry is how the Receive Adapter retries the delivery of a batch of
+	// records to the sink. Unset fields default to the config-kinesis-source
+	// ConfigMap.
+	// +optional
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// Mesh is the service mesh the Receive Adapter pods join. Defaults to the
+	// config-kinesis-source ConfigMap.
+	// +optional
+	Mesh Mesh `json:"mesh,omitempty"`
+
+	// PayloadFormat is how the records are turned into events. Defaults to
+	// kcl.
+	// +optional
+	PayloadFormat PayloadFormat `json:"payloadFormat,omitempty"`
+
+	// DynamoDBChanges tunes the dynamodbChanges payload format, it may only
+	// be set along with it.
+	// +optional
+	DynamoDBChanges *DynamoDBChangesOptions `json:"dynamodbChanges,omitempty"`
+
+	// DataContentType is how the data of the records is delivered with the
+	// kcl and record payload formats. By default, it is base64-encoded in the
+	// events of the kcl format, and the body of the events of the record
+	// format.
+	// +optional
+	DataContentType DataContentType `json:"dataContentType,omitempty"`
+
+	// Compression is how the data of every record is decompressed before
+	// being turned into events. Defaults to none.
+	// +optional
+	Compression Compression `json:"compression,omitempty"`
+
+	// Schema decodes the data of the records to JSON with Avro or Protobuf
+	// schemas. It needs the record payload format.
+	// +optional
+	Schema *SchemaSpec `json:"schema,omitempty"`
+
+	// DeadLetterSinkURI is the absolute URI the records which cannot be
+	// decoded are delivered to, as is, along with the reason. They are
+	// skipped when it is not set.
+	// +optional
+	DeadLetterSinkURI string `json:"deadLetterSinkUri,omitempty"`
+
+	// Filter selects the records delivered to the sink. The other records are
+	// checkpointed without being delivered.
+	// +optional
+	Filter *FilterSpec `json:"filter,omitempty"`
+
+	// CEOverrides overrides the attributes of the events delivered to the
+	// sink.
+	// +optional
+	CEOverrides *CEOverrides `json:"ceOverrides,omitempty"`
+
+	// Transform reshapes the JSON data of the records before they are
+	// delivered, applying its steps in order. It needs the kcl or record
+	// payload format, and JSON data. Records which cannot be transformed are
+	// handled as records which cannot be decoded.
+	// +optional
+	Transform []TransformStep `json:"transform,omitempty"`
+}
+
+// TransformStep is an operation of the transform pipeline, exactly one of
+// its fields must be set. Fields are designated by paths such as $.a.b,
+// $.a['b'], $.a[0] or $.items[*].sku, where * stands for every element of an
+// array, or every field of an object.
+type TransformStep struct {
+	// Select keeps the given fields only.
+	// +optional
+	Select []string `json:"select,omitempty"`
+
+	// Drop removes the given fields.
+	// +optional
+	Drop []string `json:"drop,omitempty"`
+
+	// Rename moves fields, whose paths may not hold *.
+	// +optional
+	Rename []FieldRename `json:"rename,omitempty"`
+
+	// Mask replaces the values of fields.
+	// +optional
+	Mask *MaskSpec `json:"mask,omitempty"`
+
+	// Add sets fields to constant values, creating the missing objects on
+	// their paths.
+	// +optional
+	Add []FieldValue `json:"add,omitempty"`
+}
+
+// FieldRename moves a field.
+type FieldRename struct {
+	// From is the path of the field.
+	From string `json:"from"`
+
+	// To is the new path of the field.
+	To string `json:"to"`
+}
+
+// MaskSpec replaces the values of fields with their hash or with a fixed
+// string. Exactly one of Hash and Replacement must be set.
+type MaskSpec struct {
+	// Paths are the paths of the fields.
+	Paths []string `json:"paths"`
+
+	// Hash replaces every value with its hex-encoded hash: the hash of the
+	// string of a string value, and of the JSON text of other values.
+	// +optional
+	Hash MaskHash `json:"hash,omitempty"`
+
+	// Replacement replaces every value with the given string.
+	// +optional
+	Replacement *string `json:"replacement,omitempty"`
+}
+
+// MaskHash is the hash function masking values.
+type MaskHash string
+
+const (
+	// MaskHashSHA256 hashes values with SHA-256.
+	MaskHashSHA256 MaskHash = "sha256"
+)
+
+// FieldValue sets a field.
+type FieldValue struct {
+	// Path is the path of the field.
+	Path string `json:"path"`
+
+	// Value is the JSON value of the field.
+	Value runtime.RawExtension `json:"value"`
+}
+
+// CEOverrides sets attributes of the events. Every value is a template:
+// literal text in which ${stream}, ${shard} and ${partitionKey} are replaced
+// with the metadata of the record, and ${<JSONPath>}, e.g. ${$.detail.type},
+// with the value selected in the JSON data of the event. ${...:-fallback} is
+// replaced with the fallback when the lookup fails, and $$ with $. An
+// attribute keeps its value when a lookup without fallback fails. The record
+// placeholders need a payload format delivering every record.
+type CEOverrides struct {
+	// Type overrides the type of the events.
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// Source overrides the source of the events, it must be a URI reference.
+	// +optional
+	Source string `json:"source,omitempty"`
+
+	// Subject sets the subject of the events.
+	// +optional
+	Subject string `json:"subject,omitempty"`
+
+	// Extensions sets extensions of the events, keyed by their lowercase
+	// alphanumeric name.
+	// +optional
+	Extensions map[string]string `json:"extensions,omitempty"`
+}
+
+// FilterSpec selects records by their metadata and the fields of their data.
+// A record is delivered when it matches every condition set.
+type FilterSpec struct {
+	// PartitionKey matches the partition key of the records.
+	// +optional
+	PartitionKey *StringMatch `json:"partitionKey,omitempty"`
+
+	// ArrivedAfter keeps the records that arrived at or after the given time.
+	// +optional
+	ArrivedAfter *metav1.Time `json:"arrivedAfter,omitempty"`
+
+	// ArrivedBefore keeps the records that arrived before the given time.
+	// +optional
+	ArrivedBefore *metav1.Time `json:"arrivedBefore,omitempty"`
+
+	// Fields match the JSON data of the records, once decompressed and
+	// decoded. Records whose data is not JSON do not match. They cannot be
+	// set with the cloudwatchLogs payload format.
+	// +optional
+	Fields []FieldMatch `json:"fields,omitempty"`
+}
+
+// StringMatch matches a string. Exactly one of Equals and Prefix must be set.
+type StringMatch struct {
+	// Equals matches the given string.
+	// +optional
+	Equals *string `json:"equals,omitempty"`
+
+	// Prefix matches the strings starting with the given prefix.
+	// +optional
+	Prefix *string `json:"prefix,omitempty"`
+}
+
+// FieldMatch matches a field of JSON data. Fields which are not strings are
+// matched by their JSON text, e.g. 42 or true.
+type FieldMatch struct {
+	// Path is the JSONPath expression selecting the field, e.g. $.detail.type.
+	// The field matches when any of the values selected matches.
+	Path string `json:"path"`
+
+	StringMatch `json:",inline"`
+}
+
+// DefaultLagThreshold is the lag threshold of sources which do not set one.
+const DefaultLagThreshold = 5 * time.Minute
+
+// KCLSpec defines the tunables of the Kinesis Client Library.
+type KCLSpec struct {
+	// MaxRecords is the maximum number of records read from a shard at once.
+	// +optional
+	MaxRecords *int32 `json:"maxRecords,omitempty"`
+
+	// MaxLeasesForWorker is the maximum number of shards a Receive Adapter
+	// consumes.
+	// +optional
+	MaxLeasesForWorker *int32 `json:"maxLeasesForWorker,omitempty"`
+
+	// ShardSyncInterval is how often the shards of the stream are listed.
+	// +optional
+	ShardSyncInterval *metav1.Duration `json:"shardSyncInterval,omitempty"`
+
+	// FailoverTime is how long a lease is held without being renewed.
+	// +optional
+	FailoverTime *metav1.Duration `json:"failoverTime,omitempty"`
+}
+
+// MetricsBackend is the monitoring service the Kinesis Client Library reports
+// its metrics to.
+type MetricsBackend string
+
+const (
+	// MetricsBackendCloudWatch reports the metrics to AWS CloudWatch.
+	MetricsBackendCloudWatch MetricsBackend = "cloudwatch"
+
+	// MetricsBackendPrometheus exposes the metrics to Prometheus.
+	MetricsBackendPrometheus MetricsBackend = "prometheus"
+
+	// MetricsBackendNone does not report the metrics.
+	MetricsBackendNone MetricsBackend = "none"
+)
+
+// Mesh is a service mesh integration of the Receive Adapter.
+type Mesh string
+
+const (
+	// MeshNone leaves the Receive Adapter out of any mesh.
+	MeshNone Mesh = "none"
+
+	// MeshIstio injects the Istio sidecar in the Receive Adapter pods, and
+	// allows them to reach the AWS APIs of their region through a
+	// ServiceEntry.
+	MeshIstio Mesh = "istio"
+
+	// MeshLinkerd injects the Linkerd proxy in the Receive Adapter pods.
+	MeshLinkerd Mesh = "linkerd"
+)
+
+// PayloadFormat is the format of the records of a stream, which decides how
+// they are turned into events.
+type PayloadFormat string
+
+const (
+	// PayloadFormatKCL delivers every batch of records read by the Kinesis
+	// Client Library as a single event.
+	PayloadFormatKCL PayloadFormat = "kcl"
+
+	// PayloadFormatRecord delivers every record as an event, whose data is
+	// the data of the record.
+	PayloadFormatRecord PayloadFormat = "record"
+
+	// PayloadFormatCloudWatchLogs decodes the records delivered by CloudWatch
+	// Logs subscription filters, and delivers every log event as an event.
+	PayloadFormatCloudWatchLogs PayloadFormat = "cloudwatchLogs"
+
+	// PayloadFormatDynamoDBChanges decodes the records written by Kinesis
+	// Data Streams for DynamoDB, and delivers every item change as an event
+	// typed after the change, whose subject is the table name.
+	PayloadFormatDynamoDBChanges PayloadFormat = "dynamodbChanges"
+
+	// PayloadFormatLambda delivers every batch of records as a single event,
+	// whose data is the KinesisEvent AWS Lambda functions are invoked with.
+	PayloadFormatLambda PayloadFormat = "lambda"
+)
+
+// DataContentType is the content type of the data of the records.
+type DataContentType string
+
+const (
+	// DataContentTypeJSON embeds the data in the events as JSON. Records which
+	// do not hold JSON are skipped.
+	DataContentTypeJSON DataContentType = "application/json"
+
+	// DataContentTypeText embeds the data in the events as a string. Records
+	// which do not hold UTF-8 text are skipped.
+	DataContentTypeText DataContentType = "text/plain"
+
+	// DataContentTypeBinary sends the data as is, as the body of the events of
+	// the record payload format.
+	DataContentTypeBinary DataContentType = "application/octet-stream"
+)
+
+// Compression is a compression of the data of the records.
+type Compression string
+
+const (
+	// CompressionNone keeps the data as is.
+	CompressionNone Compression = "none"
+
+	// CompressionGzip decompresses gzip data.
+	CompressionGzip Compression = "gzip"
+
+	// CompressionZlib decompresses zlib data.
+	CompressionZlib Compression = "zlib"
+
+	// CompressionSnappy decompresses snappy data, in the framing format or
+	// else in the block format.
+	CompressionSnappy Compression = "snappy"
+
+	// CompressionZstd decompresses zstd data.
+	CompressionZstd Compression = "zstd"
+
+	// CompressionAuto tells the compression of the data by its magic bytes,
+	// and keeps the data as is when it is not compressed or fails to
+	// decompress.
+	CompressionAuto Compression = "auto"
+)
+
+// SchemaSpec defines the schemas the data of the records is decoded with.
+type SchemaSpec struct {
+	// Type is the type of the schemas.
+	Type SchemaType `json:"type"`
+
+	// ConfigMapName is the name of the ConfigMap holding the schemas, in the
+	// namespace of the source. It holds the Avro schemas under their ID in
+	// the schema registry, or the Protobuf descriptor sets.
+	ConfigMapName string `json:"configMapName"`
+
+	// MessageType is the full name of the Protobuf message of the records,
+	// e.g. acme.orders.v1.Order. It is required with Protobuf.
+	// +optional
+	MessageType string `json:"messageType,omitempty"`
+}
+
+// SchemaType is a type of schemas.
+type SchemaType string
+
+const (
+	// SchemaTypeAvro decodes records holding Avro data in the Confluent wire
+	// format: a zero byte, the 4-byte big-endian ID of the schema and the
+	// data.
+	SchemaTypeAvro SchemaType = "avro"
+
+	// SchemaTypeProtobuf decodes records holding a Protobuf message prefixed
+	// by its varint length.
+	SchemaTypeProtobuf SchemaType = "protobuf"
+)
+
+// DynamoDBChangesOptions defines how the item changes of DynamoDB tables are
+// delivered.
+type DynamoDBChangesOptions struct {
+	// PlainJSON converts the keys and images of the items from the attribute
+	// value format of DynamoDB to plain JSON.
+	// +optional
+	PlainJSON bool `json:"plainJson,omitempty"`
+}
+
+// RetryPolicy defines how the delivery of a batch of records is retried. The
+// backoff doubles after every failed attempt, up to MaxBackoff.
+type RetryPolicy struct {
+	// Attempts is the number of times a batch is delivered before giving up,
+	// including the first one.
+	// +optional
+	Attempts *int32 `json:"attempts,omitempty"`
+
+	// Backoff is how long the first retry is delayed.
+	// +optional
+	Backoff *metav1.Duration `json:"backoff,omitempty"`
+
+	// MaxBackoff bounds the delay between two attempts.
+	// +optional
+	MaxBackoff *metav1.Duration `json:"maxBackoff,omitempty"`
+}
+
+// DeletionPolicy defines what happens to the AWS resources of a source when it
+// is deleted.
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyRetain keeps the AWS resources of a deleted source, so
+	// that a new source with the same name resumes from its checkpoints.
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+
+	// DeletionPolicyDelete deletes the AWS resources of a deleted source.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+)
+
+// ReplaySpec defines the position of the stream a source is rewound to.
+// Exactly one of Timestamp, SequenceNumbers and TrimHorizon must be set.
+type ReplaySpec struct {
+	// Token identifies the replay. A replay is carried out whenever the token
+	// differs from the one of the last completed replay.
+	Token string `json:"token"`
+
+	// Timestamp rewinds every shard to the records that arrived at or after
+	// the given time.
+	// +optional
+	Timestamp *metav1.Time `json:"timestamp,omitempty"`
+
+	// SequenceNumbers rewinds the given shards to just after the given
+	// sequence numbers, keyed by shard ID. The other shards are not rewound.
+	// +optional
+	SequenceNumbers map[string]string `json:"sequenceNumbers,omitempty"`
+
+	// TrimHorizon rewinds every shard to its oldest available record.
+	// +optional
+	TrimHorizon bool `json:"trimHorizon,omitempty"`
+}
+
+// IAMRoleAnnotation is the KIAM annotation of the IAM role assigned to the
+// Receive Adapter pod.
+const IAMRoleAnnotation = "iam.amazonaws.com/role"
+
+// CredentialEnvVars are the environment variables the Receive Adapter gets its
+// AWS credentials from. They only come from awsCredsSecret or kiamOptions,
+// which the policy of the namespace checks, never from the template.
+var CredentialEnvVars = []string{
+	"AWS_APPLICATION_CREDENTIALS",
+	"KCL_IAM_ROLE_ARN",
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_SHARED_CREDENTIALS_FILE",
+	"AWS_CONFIG_FILE",
+	"AWS_PROFILE",
+	"AWS_ROLE_ARN",
+	"AWS_WEB_IDENTITY_TOKEN_FILE",
+}
+
+// ReceiveAdapterTemplate is a restricted PodTemplateSpec, holding the settings
+// of the Receive Adapter pod that can be customized.
+type ReceiveAdapterTemplate struct {
+	// Metadata holds the labels and annotations added to the pod.
+	// +optional
+	Metadata ReceiveAdapterMetadata `json:"metadata,omitempty"`
+
+	// Spec holds the settings merged over the pod spec.
+	// +optional
+	Spec ReceiveAdapterPodSpec `json:"spec,omitempty"`
+}
+
+// ReceiveAdapterMetadata defines the metadata added to the Receive Adapter pod.
+// Labels and annotations set by the controller take precedence, and the KIAM
+// annotation is not allowed.
+type ReceiveAdapterMetadata struct {
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ReceiveAdapterPodSpec defines the pod settings of the Receive Adapter.
+type ReceiveAdapterPodSpec struct {
+	// Image is the image of the receive adapter container. Defaults to the
+	// config-kinesis-source ConfigMap.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Resources are the compute resources of the receive adapter container.
+	// +optional
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Env is the additional environment of the receive adapter container.
+	// Variables set by the controller take precedence, and the ones of the
+	// AWS credentials are not allowed.
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// +optional
+	SecurityContext *corev1.PodSecurityContext `json:"securityContext,omitempty"`
+
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
 }
 
 // KiamOptions defines the spec for KIAM configuration
@@ -92,6 +633,32 @@ const (
 	// KinesisSourceConditionDeployed has status True when the
 	// KinesisSource has had it's receive adapter deployment created.
 	KinesisSourceConditionDeployed duckv1alpha1.ConditionType = "Deployed"
+
+	// KinesisSourceConditionSuspended has status True when the
+	// KinesisSource has been suspended and its receive adapter scaled down.
+	// It does not affect the readiness of the source.
+	KinesisSourceConditionSuspended duckv1alpha1.ConditionType = "Suspended"
+
+	// KinesisSourceConditionReplayed has status True when the replay
+	// requested in the spec has been carried out, and Unknown while it is in
+	// progress. It does not affect the readiness of the source.
+	KinesisSourceConditionReplayed duckv1alpha1.ConditionType = "Replayed"
+
+	// KinesisSourceConditionCleanedUp has status True when the AWS resources
+	// of a deleted source have been deleted, Unknown while they are being
+	// deleted and False when deleting them failed. It is only set with the
+	// Delete deletion policy, and does not affect the readiness of the source.
+	KinesisSourceConditionCleanedUp duckv1alpha1.ConditionType = "CleanedUp"
+
+	// KinesisSourceConditionLagging has status True when a shard is further
+	// behind the tip of the stream than the lag threshold, as reported by the
+	// Receive Adapter. It does not affect the readiness of the source.
+	KinesisSourceConditionLagging duckv1alpha1.ConditionType = "Lagging"
+
+	// KinesisSourceConditionPolicyViolation has status True when the source
+	// uses a stream, an IAM role or a credential mode that the policy of its
+	// namespace does not allow. Its receive adapter is stopped meanwhile.
+	KinesisSourceConditionPolicyViolation duckv1alpha1.ConditionType = "PolicyViolation"
 )
 
 var condSet = duckv1alpha1.NewLivingConditionSet(
@@ -109,6 +676,53 @@ type KinesisSourceStatus struct {
 	// SinkURI is the current active sink URI that has been configured for the KinesisSource.
 	// +optional
 	SinkURI string `json:"sinkUri,omitempty"`
+
+	// Replay is the last completed replay.
+	// +optional
+	Replay *ReplayStatus `json:"replay,omitempty"`
+
+	// Shards is the progress of the shards of the stream, periodically
+	// reported by the Receive Adapter.
+	// +optional
+	Shards []ShardStatus `json:"shards,omitempty"`
+}
+
+// ShardStatus is the progress of a shard.
+type ShardStatus struct {
+	// ShardID is the ID of the shard.
+	ShardID string `json:"shardId"`
+
+	// Owner is the worker holding the lease of the shard.
+	// +optional
+	Owner string `json:"owner,omitempty"`
+
+	// LeaseTimeout is the time the lease of the shard expires unless renewed.
+	// +optional
+	LeaseTimeout *metav1.Time `json:"leaseTimeout,omitempty"`
+
+	// Checkpoint is the last checkpointed sequence number, or SHARD_END once
+	// the shard has been consumed entirely.
+	// +optional
+	Checkpoint string `json:"checkpoint,omitempty"`
+
+	// CheckpointTime is the time of the last checkpoint.
+	// +optional
+	CheckpointTime *metav1.Time `json:"checkpointTime,omitempty"`
+
+	// MillisBehindLatest is how far the last records read from the shard
+	// are behind the tip of the stream, in milliseconds.
+	// +optional
+	MillisBehindLatest *int64 `json:"millisBehindLatest,omitempty"`
+}
+
+// ReplayStatus records a completed replay.
+type ReplayStatus struct {
+	// Token is the token of the replay.
+	Token string `json:"token"`
+
+	// CompletionTime is the time the Receive Adapter was restarted from the
+	// rewritten checkpoints.
+	CompletionTime metav1.Time `json:"completionTime"`
 }
 
 // GetCondition returns the condition currently associated with the given type, or nil.
@@ -157,6 +771,97 @@ func (s *KinesisSourceStatus) MarkNotDeployed(reason, messageFormat string, mess
 	condSet.Manage(s).MarkFalse(KinesisSourceConditionDeployed, reason, messageFormat, messageA...)
 }
 
+// MarkSuspended sets the condition that the source is suspended.
+func (s *KinesisSourceStatus) MarkSuspended() {
+	condSet.Manage(s).MarkTrue(KinesisSourceConditionSuspended)
+}
+
+// MarkResumed sets the condition that the source is no longer suspended, if it
+// has been suspended before.
+func (s *KinesisSourceStatus) MarkResumed() {
+	if s.GetCondition(KinesisSourceConditionSuspended) != nil {
+		condSet.Manage(s).MarkFalse(KinesisSourceConditionSuspended, "Resumed", "")
+	}
+}
+
+// MarkReplaying sets the condition that a replay is in progress.
+func (s *KinesisSourceStatus) MarkReplaying(reason, messageFormat string, messageA ...interface{}) {
+	condSet.Manage(s).MarkUnknown(KinesisSourceConditionReplayed, reason, messageFormat, messageA...)
+}
+
+// MarkReplayed records the completion of the replay with the given token.
+func (s *KinesisSourceStatus) MarkReplayed(token string, completionTime metav1.Time) {
+	s.Replay = &ReplayStatus{Token: token, CompletionTime: completionTime}
+	condSet.Manage(s).MarkTrue(KinesisSourceConditionReplayed)
+}
+
+// MarkCleaningUp sets the condition that the AWS resources of the source are
+// being deleted.
+func (s *KinesisSourceStatus) MarkCleaningUp(reason, messageFormat string, messageA ...interface{}) {
+	condSet.Manage(s).MarkUnknown(KinesisSourceConditionCleanedUp, reason, messageFormat, messageA...)
+}
+
+// MarkCleanedUp sets the condition that the AWS resources of the source have
+// been deleted.
+func (s *KinesisSourceStatus) MarkCleanedUp() {
+	condSet.Manage(s).MarkTrue(KinesisSourceConditionCleanedUp)
+}
+
+// MarkCleanupFailed sets the condition that deleting the AWS resources of the
+// source failed.
+func (s *KinesisSourceStatus) MarkCleanupFailed(reason, messageFormat string, messageA ...interface{}) {
+	condSet.Manage(s).MarkFalse(KinesisSourceConditionCleanedUp, reason, messageFormat, messageA...)
+}
+
+// MarkLag sets the Lagging condition from the reported progress of the
+// shards, given the lag threshold.
+func (s *KinesisSourceStatus) MarkLag(threshold time.Duration) {
+	for _, shard := range s.Shards {
+		if shard.MillisBehindLatest != nil && time.Duration(*shard.MillisBehindLatest)*time.Millisecond > threshold {
+			condSet.Manage(s).SetCondition(duckv1alpha1.Condition{
+				Type:     KinesisSourceConditionLagging,
+				Status:   corev1.ConditionTrue,
+				Reason:   "ThresholdExceeded",
+				Message:  fmt.Sprintf("Shard %s is more than %v behind the tip of the stream.", shard.ShardID, threshold),
+				Severity: duckv1alpha1.ConditionSeverityInfo,
+			})
+			return
+		}
+	}
+	if len(s.Shards) > 0 || s.GetCondition(KinesisSourceConditionLagging) != nil {
+		condSet.Manage(s).MarkFalse(KinesisSourceConditionLagging, "CaughtUp", "")
+	}
+}
+
+// MarkPolicyViolation sets the condition that the source violates the policy
+// of its namespace.
+func (s *KinesisSourceStatus) MarkPolicyViolation(messageFormat string, messageA ...interface{}) {
+	condSet.Manage(s).SetCondition(duckv1alpha1.Condition{
+		Type:     KinesisSourceConditionPolicyViolation,
+		Status:   corev1.ConditionTrue,
+		Reason:   "PolicyViolation",
+		Message:  fmt.Sprintf(messageFormat, messageA...),
+		Severity: duckv1alpha1.ConditionSeverityInfo,
+	})
+}
+
+// MarkPolicyCompliant sets the condition that the source complies with the
+// policy of its namespace, if it has violated it before.
+func (s *KinesisSourceStatus) MarkPolicyCompliant() {
+	if s.GetCondition(KinesisSourceConditionPolicyViolation) != nil {
+		condSet.Manage(s).MarkFalse(KinesisSourceConditionPolicyViolation, "Compliant", "")
+	}
+}
+
+// ReplayPending returns true if the replay requested in the spec has not been
+// carried out yet.
+func (s *KinesisSource) ReplayPending() bool {
+	if s.Spec.Replay == nil {
+		return false
+	}
+	return s.Status.Replay == nil || s.Status.Replay.Token != s.Spec.Replay.Token
+}
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // KinesisSourceList contains a list of KinesisSource
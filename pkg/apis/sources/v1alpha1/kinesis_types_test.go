@@ -19,6 +19,7 @@ package v1alpha1
 import (
 	"log"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -340,3 +341,90 @@ func TestKinesisSourceStatusGetCondition(t *testing.T) {
 		})
 	}
 }
+
+func TestKinesisSourceStatusSuspended(t *testing.T) {
+	s := &KinesisSourceStatus{}
+	s.InitializeConditions()
+	s.MarkSink("uri://example")
+	s.MarkDeployed()
+
+	s.MarkResumed()
+	if c := s.GetCondition(KinesisSourceConditionSuspended); c != nil {
+		t.Errorf("expected no suspended condition before suspending, but got %v", c)
+	}
+
+	s.MarkSuspended()
+	if c := s.GetCondition(KinesisSourceConditionSuspended); c == nil || !c.IsTrue() {
+		t.Errorf("expected suspended condition to be true, but got %v", c)
+	}
+	if !s.IsReady() {
+		t.Errorf("expected suspended source to stay ready")
+	}
+
+	s.MarkResumed()
+	if c := s.GetCondition(KinesisSourceConditionSuspended); c == nil || !c.IsFalse() {
+		t.Errorf("expected suspended condition to be false after resuming, but got %v", c)
+	}
+	if !s.IsReady() {
+		t.Errorf("expected resumed source to stay ready")
+	}
+}
+
+func TestKinesisSourceStatusLagging(t *testing.T) {
+	s := &KinesisSourceStatus{}
+	s.InitializeConditions()
+	s.MarkSink("uri://example")
+	s.MarkDeployed()
+
+	s.MarkLag(time.Minute)
+	if c := s.GetCondition(KinesisSourceConditionLagging); c != nil {
+		t.Errorf("expected no lagging condition before shards are reported, but got %v", c)
+	}
+
+	behind := int64(2 * time.Minute / time.Millisecond)
+	s.Shards = []ShardStatus{
+		{ShardID: "shardId-000000000000"},
+		{ShardID: "shardId-000000000001", MillisBehindLatest: &behind},
+	}
+	s.MarkLag(time.Minute)
+	c := s.GetCondition(KinesisSourceConditionLagging)
+	if c == nil || !c.IsTrue() {
+		t.Fatalf("expected lagging condition to be true, but got %v", c)
+	}
+	if want := "Shard shardId-000000000001 is more than 1m0s behind the tip of the stream."; c.Message != want {
+		t.Errorf("expected message %q, but got %q", want, c.Message)
+	}
+	if !s.IsReady() {
+		t.Errorf("expected lagging source to stay ready")
+	}
+
+	s.MarkLag(5 * time.Minute)
+	if c := s.GetCondition(KinesisSourceConditionLagging); c == nil || !c.IsFalse() {
+		t.Errorf("expected lagging condition to be false below the threshold, but got %v", c)
+	}
+}
+
+func TestKinesisSourceStatusPolicyViolation(t *testing.T) {
+	s := &KinesisSourceStatus{}
+	s.InitializeConditions()
+	s.MarkSink("uri://example")
+
+	s.MarkPolicyCompliant()
+	if c := s.GetCondition(KinesisSourceConditionPolicyViolation); c != nil {
+		t.Errorf("expected no policy violation condition before a violation, but got %v", c)
+	}
+
+	s.MarkPolicyViolation("stream %q is not allowed", "orders")
+	c := s.GetCondition(KinesisSourceConditionPolicyViolation)
+	if c == nil || !c.IsTrue() {
+		t.Fatalf("expected policy violation condition to be true, but got %v", c)
+	}
+	if want := `stream "orders" is not allowed`; c.Message != want {
+		t.Errorf("expected message %q, but got %q", want, c.Message)
+	}
+
+	s.MarkPolicyCompliant()
+	if c := s.GetCondition(KinesisSourceConditionPolicyViolation); c == nil || !c.IsFalse() {
+		t.Errorf("expected policy violation condition to be false once compliant, but got %v", c)
+	}
+}
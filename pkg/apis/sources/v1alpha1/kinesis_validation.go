@@ -0,0 +1,559 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/knative/pkg/apis"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Check that KinesisSource can be validated.
+var _ apis.Validatable = (*KinesisSource)(nil)
+
+// Validate validates the KinesisSource.
+func (s *KinesisSource) Validate(ctx context.Context) *apis.FieldError {
+	return s.Spec.Validate(ctx).ViaField("spec")
+}
+
+// Validate validates the KinesisSourceSpec.
+func (s *KinesisSourceSpec) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	if s.StreamName == "" {
+		errs = errs.Also(apis.ErrMissingField("streamName"))
+	}
+	if s.Region == "" {
+		errs = errs.Also(apis.ErrMissingField("region"))
+	}
+
+	switch s.DeletionPolicy {
+	case "", DeletionPolicyRetain, DeletionPolicyDelete:
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(string(s.DeletionPolicy), "deletionPolicy"))
+	}
+
+	if s.Replay != nil {
+		errs = errs.Also(s.Replay.Validate(ctx).ViaField("replay"))
+	}
+
+	if s.Template != nil {
+		errs = errs.Also(s.Template.Validate(ctx).ViaField("template"))
+	}
+
+	if s.KCL != nil {
+		errs = errs.Also(s.KCL.Validate(ctx).ViaField("kcl"))
+	}
+
+	switch s.MetricsBackend {
+	case "", MetricsBackendCloudWatch, MetricsBackendPrometheus, MetricsBackendNone:
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(string(s.MetricsBackend), "metricsBackend"))
+	}
+
+	if s.Retry != nil {
+		errs = errs.Also(s.Retry.Validate(ctx).ViaField("retry"))
+	}
+
+	switch s.Mesh {
+	case "", MeshNone, MeshIstio, MeshLinkerd:
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(string(s.Mesh), "mesh"))
+	}
+
+	switch s.PayloadFormat {
+	case "", PayloadFormatKCL, PayloadFormatRecord, PayloadFormatCloudWatchLogs, PayloadFormatDynamoDBChanges, PayloadFormatLambda:
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(string(s.PayloadFormat), "payloadFormat"))
+	}
+	if s.DynamoDBChanges != nil && s.PayloadFormat != PayloadFormatDynamoDBChanges {
+		errs = errs.Also(apis.ErrDisallowedFields("dynamodbChanges"))
+	}
+	errs = errs.Also(s.validateContent())
+
+	if s.Schema != nil {
+		errs = errs.Also(s.Schema.Validate(ctx).ViaField("schema"))
+		if s.PayloadFormat != PayloadFormatRecord {
+			errs = errs.Also(&apis.FieldError{
+				Message: "schema needs the record payload format",
+				Paths:   []string{"schema"},
+			})
+		}
+		if s.DataContentType != "" && s.DataContentType != DataContentTypeJSON {
+			errs = errs.Also(&apis.FieldError{
+				Message: "schema decodes the data to application/json",
+				Paths:   []string{"dataContentType"},
+			})
+		}
+	}
+
+	if s.DeadLetterSinkURI != "" {
+		if u, err := url.Parse(s.DeadLetterSinkURI); err != nil || !u.IsAbs() {
+			errs = errs.Also(apis.ErrInvalidValue(s.DeadLetterSinkURI, "deadLetterSinkUri"))
+		}
+	}
+
+	if s.Filter != nil {
+		errs = errs.Also(s.Filter.Validate(ctx).ViaField("filter"))
+		// The records of CloudWatch Logs subscriptions are gzipped when they are filtered.
+		if s.PayloadFormat == PayloadFormatCloudWatchLogs && len(s.Filter.Fields) > 0 {
+			errs = errs.Also(&apis.FieldError{
+				Message: "fields cannot match the gzipped data of the cloudwatchLogs payload format",
+				Paths:   []string{"filter.fields"},
+			})
+		}
+	}
+
+	if s.CEOverrides != nil {
+		errs = errs.Also(s.CEOverrides.Validate(ctx).ViaField("ceOverrides"))
+		if s.PayloadFormat.batches() && s.CEOverrides.usesRecord() {
+			errs = errs.Also(&apis.FieldError{
+				Message: "partitionKey and JSONPath placeholders need a payload format delivering every record",
+				Paths:   []string{"ceOverrides"},
+			})
+		}
+	}
+
+	if len(s.Transform) > 0 {
+		for i, step := range s.Transform {
+			errs = errs.Also(step.Validate(ctx).ViaFieldIndex("transform", i))
+		}
+		switch s.PayloadFormat {
+		case "", PayloadFormatKCL, PayloadFormatRecord:
+		default:
+			errs = errs.Also(&apis.FieldError{
+				Message: "transform needs the kcl or record payload format",
+				Paths:   []string{"transform"},
+			})
+		}
+		if s.DataContentType != DataContentTypeJSON && s.Schema == nil {
+			errs = errs.Also(&apis.FieldError{
+				Message: "transform needs JSON data, an application/json dataContentType or a schema",
+				Paths:   []string{"transform"},
+			})
+		}
+	}
+
+	return errs.Also(s.validateSink())
+}
+
+// batches tells whether the payload format delivers every batch of records as
+// a single event.
+func (f PayloadFormat) batches() bool {
+	return f == "" || f == PayloadFormatKCL || f == PayloadFormatLambda
+}
+
+// validateContent validates the content type and compression of the data of
+// the records.
+func (s *KinesisSourceSpec) validateContent() *apis.FieldError {
+	var errs *apis.FieldError
+
+	switch s.DataContentType {
+	case "":
+	case DataContentTypeJSON, DataContentTypeText, DataContentTypeBinary:
+		switch s.PayloadFormat {
+		case PayloadFormatCloudWatchLogs, PayloadFormatDynamoDBChanges, PayloadFormatLambda:
+			errs = errs.Also(apis.ErrDisallowedFields("dataContentType"))
+		case PayloadFormatRecord:
+		default:
+			if s.DataContentType == DataContentTypeBinary {
+				errs = errs.Also(&apis.FieldError{
+					Message: "application/octet-stream needs the record payload format",
+					Paths:   []string{"dataContentType"},
+				})
+			}
+		}
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(string(s.DataContentType), "dataContentType"))
+	}
+
+	switch s.Compression {
+	case "", CompressionNone, CompressionGzip, CompressionZlib, CompressionSnappy, CompressionZstd, CompressionAuto:
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(string(s.Compression), "compression"))
+	}
+	return errs
+}
+
+// Validate validates the SchemaSpec.
+func (s *SchemaSpec) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	if s.ConfigMapName == "" {
+		errs = errs.Also(apis.ErrMissingField("configMapName"))
+	}
+	switch s.Type {
+	case SchemaTypeAvro:
+		if s.MessageType != "" {
+			errs = errs.Also(apis.ErrDisallowedFields("messageType"))
+		}
+	case SchemaTypeProtobuf:
+		if s.MessageType == "" {
+			errs = errs.Also(apis.ErrMissingField("messageType"))
+		}
+	case "":
+		errs = errs.Also(apis.ErrMissingField("type"))
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(string(s.Type), "type"))
+	}
+	return errs
+}
+
+// Validate validates the FilterSpec.
+func (f *FilterSpec) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	if f.PartitionKey != nil {
+		errs = errs.Also(f.PartitionKey.Validate(ctx).ViaField("partitionKey"))
+	}
+	if f.ArrivedAfter != nil && f.ArrivedBefore != nil && !f.ArrivedAfter.Before(f.ArrivedBefore) {
+		errs = errs.Also(&apis.FieldError{
+			Message: "arrivedAfter must be before arrivedBefore",
+			Paths:   []string{"arrivedAfter", "arrivedBefore"},
+		})
+	}
+	for i, field := range f.Fields {
+		errs = errs.Also(field.Validate(ctx).ViaFieldIndex("fields", i))
+	}
+	return errs
+}
+
+// Validate validates the StringMatch.
+func (m *StringMatch) Validate(ctx context.Context) *apis.FieldError {
+	switch {
+	case m.Equals == nil && m.Prefix == nil:
+		return apis.ErrMissingOneOf("equals", "prefix")
+	case m.Equals != nil && m.Prefix != nil:
+		return apis.ErrMultipleOneOf("equals", "prefix")
+	}
+	return nil
+}
+
+// Validate validates the FieldMatch.
+func (m *FieldMatch) Validate(ctx context.Context) *apis.FieldError {
+	errs := m.StringMatch.Validate(ctx)
+	if m.Path == "" {
+		return errs.Also(apis.ErrMissingField("path"))
+	}
+	if err := jsonpath.New("path").Parse(JSONPathTemplate(m.Path)); err != nil {
+		errs = errs.Also(&apis.FieldError{
+			Message: fmt.Sprintf("invalid JSONPath: %v", err),
+			Paths:   []string{"path"},
+		})
+	}
+	return errs
+}
+
+// JSONPathTemplate returns the JSONPath template of a JSONPath expression,
+// which is enclosed in braces unless it already is.
+func JSONPathTemplate(path string) string {
+	if strings.HasPrefix(path, "{") {
+		return path
+	}
+	return "{" + path + "}"
+}
+
+// reservedAttributes are the names of the context attributes and data of
+// CloudEvents, which extensions may not use.
+var reservedAttributes = map[string]bool{
+	"specversion": true, "id": true, "type": true, "source": true, "subject": true, "time": true,
+	"schemaurl": true, "dataschema": true, "contenttype": true, "datacontenttype": true,
+	"datacontentencoding": true, "data": true,
+}
+
+// extensionNameRegexp matches the names of CloudEvents extensions.
+var extensionNameRegexp = regexp.MustCompile(`^[a-z0-9]{1,20}$`)
+
+// Validate validates the CEOverrides.
+func (o *CEOverrides) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	for name, value := range o.templates() {
+		if _, err := ParseTemplate(value); err != nil {
+			errs = errs.Also(&apis.FieldError{
+				Message: fmt.Sprintf("invalid template: %v", err),
+				Paths:   []string{name},
+			})
+		}
+	}
+	for name := range o.Extensions {
+		if !extensionNameRegexp.MatchString(name) || reservedAttributes[name] {
+			errs = errs.Also(apis.ErrInvalidKeyName(name, "extensions"))
+		}
+	}
+	return errs
+}
+
+// templates returns the templates of the CEOverrides by field path.
+func (o *CEOverrides) templates() map[string]string {
+	templates := make(map[string]string, 3+len(o.Extensions))
+	for name, value := range map[string]string{"type": o.Type, "source": o.Source, "subject": o.Subject} {
+		if value != "" {
+			templates[name] = value
+		}
+	}
+	for name, value := range o.Extensions {
+		templates[fmt.Sprintf("extensions[%s]", name)] = value
+	}
+	return templates
+}
+
+// usesRecord tells whether a template depends on a record rather than on the
+// stream and the shard.
+func (o *CEOverrides) usesRecord() bool {
+	for _, value := range o.templates() {
+		parts, _ := ParseTemplate(value)
+		for _, part := range parts {
+			if part.Path != "" || part.Variable == TemplateVariablePartitionKey {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Validate validates the TransformStep.
+func (t *TransformStep) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	var ops []string
+	if len(t.Select) > 0 {
+		ops = append(ops, "select")
+	}
+	if len(t.Drop) > 0 {
+		ops = append(ops, "drop")
+	}
+	if len(t.Rename) > 0 {
+		ops = append(ops, "rename")
+	}
+	if t.Mask != nil {
+		ops = append(ops, "mask")
+	}
+	if len(t.Add) > 0 {
+		ops = append(ops, "add")
+	}
+	switch len(ops) {
+	case 0:
+		errs = errs.Also(apis.ErrMissingOneOf("select", "drop", "rename", "mask", "add"))
+	case 1:
+	default:
+		errs = errs.Also(apis.ErrMultipleOneOf(ops...))
+	}
+
+	for i, path := range t.Select {
+		errs = errs.Also(validateFieldPath(path, true).ViaFieldIndex("select", i))
+	}
+	for i, path := range t.Drop {
+		errs = errs.Also(validateFieldPath(path, true).ViaFieldIndex("drop", i))
+	}
+	for i, rename := range t.Rename {
+		errs = errs.Also(validateFieldPath(rename.From, false).ViaField("from").ViaFieldIndex("rename", i))
+		errs = errs.Also(validateFieldPath(rename.To, false).ViaField("to").ViaFieldIndex("rename", i))
+	}
+	if t.Mask != nil {
+		errs = errs.Also(t.Mask.Validate(ctx).ViaField("mask"))
+	}
+	for i, value := range t.Add {
+		errs = errs.Also(validateFieldPath(value.Path, true).ViaField("path").ViaFieldIndex("add", i))
+		if value.Value.Raw != nil && !json.Valid(value.Value.Raw) {
+			errs = errs.Also(apis.ErrInvalidValue(string(value.Value.Raw), "value").ViaFieldIndex("add", i))
+		}
+	}
+	return errs
+}
+
+// Validate validates the MaskSpec.
+func (m *MaskSpec) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	if len(m.Paths) == 0 {
+		errs = errs.Also(apis.ErrMissingField("paths"))
+	}
+	for i, path := range m.Paths {
+		errs = errs.Also(validateFieldPath(path, true).ViaFieldIndex("paths", i))
+	}
+	switch {
+	case m.Hash == "" && m.Replacement == nil:
+		errs = errs.Also(apis.ErrMissingOneOf("hash", "replacement"))
+	case m.Hash != "" && m.Replacement != nil:
+		errs = errs.Also(apis.ErrMultipleOneOf("hash", "replacement"))
+	case m.Hash != "" && m.Hash != MaskHashSHA256:
+		errs = errs.Also(apis.ErrInvalidValue(string(m.Hash), "hash"))
+	}
+	return errs
+}
+
+// validateFieldPath validates a transform path, which may hold * if allowed.
+func validateFieldPath(path string, wildcard bool) *apis.FieldError {
+	segments, err := ParseFieldPath(path)
+	if err != nil {
+		return &apis.FieldError{Message: err.Error(), Paths: []string{apis.CurrentField}}
+	}
+	if !wildcard {
+		for _, segment := range segments {
+			if segment.Wildcard {
+				return &apis.FieldError{Message: fmt.Sprintf("path %q may not hold *", path), Paths: []string{apis.CurrentField}}
+			}
+		}
+	}
+	return nil
+}
+
+// Validate validates the ReceiveAdapterTemplate, which must not provide AWS credentials.
+func (t *ReceiveAdapterTemplate) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	credentialsErr := func(path string) *apis.FieldError {
+		return &apis.FieldError{
+			Message: "AWS credentials only come from awsCredsSecret or kiamOptions",
+			Paths:   []string{path},
+		}
+	}
+	if _, ok := t.Metadata.Annotations[IAMRoleAnnotation]; ok {
+		errs = errs.Also(credentialsErr("metadata.annotations[" + IAMRoleAnnotation + "]"))
+	}
+	for i, env := range t.Spec.Env {
+		for _, name := range CredentialEnvVars {
+			if env.Name == name {
+				errs = errs.Also(credentialsErr("name").ViaFieldIndex("env", i).ViaField("spec"))
+			}
+		}
+	}
+	return errs
+}
+
+// Validate validates the ReplaySpec.
+func (r *ReplaySpec) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	if r.Token == "" {
+		errs = errs.Also(apis.ErrMissingField("token"))
+	}
+
+	var targets []string
+	if r.Timestamp != nil {
+		targets = append(targets, "timestamp")
+	}
+	if len(r.SequenceNumbers) > 0 {
+		targets = append(targets, "sequenceNumbers")
+	}
+	if r.TrimHorizon {
+		targets = append(targets, "trimHorizon")
+	}
+	switch len(targets) {
+	case 0:
+		errs = errs.Also(apis.ErrMissingOneOf("timestamp", "sequenceNumbers", "trimHorizon"))
+	case 1:
+	default:
+		errs = errs.Also(apis.ErrMultipleOneOf(targets...))
+	}
+
+	for shardID, seq := range r.SequenceNumbers {
+		if seq == "" {
+			errs = errs.Also(apis.ErrMissingField(fmt.Sprintf("sequenceNumbers[%s]", shardID)))
+		}
+	}
+	return errs
+}
+
+// Validate validates the KCLSpec.
+func (k *KCLSpec) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	if k.MaxRecords != nil && *k.MaxRecords <= 0 {
+		errs = errs.Also(apis.ErrInvalidValue(fmt.Sprint(*k.MaxRecords), "maxRecords"))
+	}
+	if k.MaxLeasesForWorker != nil && *k.MaxLeasesForWorker <= 0 {
+		errs = errs.Also(apis.ErrInvalidValue(fmt.Sprint(*k.MaxLeasesForWorker), "maxLeasesForWorker"))
+	}
+	if k.ShardSyncInterval != nil && k.ShardSyncInterval.Duration <= 0 {
+		errs = errs.Also(apis.ErrInvalidValue(k.ShardSyncInterval.Duration.String(), "shardSyncInterval"))
+	}
+	if k.FailoverTime != nil && k.FailoverTime.Duration <= 0 {
+		errs = errs.Also(apis.ErrInvalidValue(k.FailoverTime.Duration.String(), "failoverTime"))
+	}
+	return errs
+}
+
+// Validate validates the RetryPolicy.
+func (r *RetryPolicy) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	if r.Attempts != nil && *r.Attempts <= 0 {
+		errs = errs.Also(apis.ErrInvalidValue(fmt.Sprint(*r.Attempts), "attempts"))
+	}
+	if r.Backoff != nil && r.Backoff.Duration < 0 {
+		errs = errs.Also(apis.ErrInvalidValue(r.Backoff.Duration.String(), "backoff"))
+	}
+	if r.MaxBackoff != nil && r.MaxBackoff.Duration < 0 {
+		errs = errs.Also(apis.ErrInvalidValue(r.MaxBackoff.Duration.String(), "maxBackoff"))
+	}
+	return errs
+}
+
+// validateSink checks that the sink is given in exactly one of the supported
+// forms: an object reference, an absolute URI, or an object reference plus a
+// URI relative to it.
+func (s *KinesisSourceSpec) validateSink() *apis.FieldError {
+	if s.Sink == nil && s.SinkURI == "" {
+		return apis.ErrMissingOneOf("sink", "sinkUri")
+	}
+
+	if s.Sink != nil {
+		var errs *apis.FieldError
+		if s.Sink.APIVersion == "" {
+			errs = errs.Also(apis.ErrMissingField("sink.apiVersion"))
+		}
+		if s.Sink.Kind == "" {
+			errs = errs.Also(apis.ErrMissingField("sink.kind"))
+		}
+		if s.Sink.Name == "" {
+			errs = errs.Also(apis.ErrMissingField("sink.name"))
+		}
+		if errs != nil {
+			return errs
+		}
+	}
+
+	if s.SinkURI == "" {
+		return nil
+	}
+
+	u, err := url.Parse(s.SinkURI)
+	if err != nil {
+		return apis.ErrInvalidValue(s.SinkURI, "sinkUri")
+	}
+	if s.Sink != nil && u.IsAbs() {
+		return &apis.FieldError{
+			Message: "sinkUri must be a relative reference when sink is set",
+			Paths:   []string{"sinkUri"},
+		}
+	}
+	if s.Sink == nil && (!u.IsAbs() || u.Host == "") {
+		return &apis.FieldError{
+			Message: "sinkUri must be an absolute URI when sink is not set",
+			Paths:   []string{"sinkUri"},
+		}
+	}
+	return nil
+}
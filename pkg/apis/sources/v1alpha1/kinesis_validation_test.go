@@ -0,0 +1,583 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestKinesisSourceValidate(t *testing.T) {
+	sink := &corev1.ObjectReference{
+		APIVersion: "eventing.knative.dev/v1alpha1",
+		Kind:       "Channel",
+		Name:       "cj-3",
+	}
+
+	tests := []struct {
+		name    string
+		spec    KinesisSourceSpec
+		wantErr string
+	}{{
+		name: "sink ref",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+		},
+	}, {
+		name: "absolute sink uri",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			SinkURI:    "https://example.com/events",
+		},
+	}, {
+		name: "sink ref with relative uri",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			SinkURI:    "/events",
+		},
+	}, {
+		name: "no sink",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+		},
+		wantErr: "expected exactly one, got neither: spec.sink, spec.sinkUri",
+	}, {
+		name: "sink ref with absolute uri",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			SinkURI:    "https://example.com/events",
+		},
+		wantErr: "sinkUri must be a relative reference when sink is set: spec.sinkUri",
+	}, {
+		name: "relative uri without sink ref",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			SinkURI:    "/events",
+		},
+		wantErr: "sinkUri must be an absolute URI when sink is not set: spec.sinkUri",
+	}, {
+		name: "incomplete sink ref",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       &corev1.ObjectReference{Name: "cj-3"},
+		},
+		wantErr: "missing field(s): spec.sink.apiVersion, spec.sink.kind",
+	}, {
+		name: "missing stream and region",
+		spec: KinesisSourceSpec{
+			Sink: sink,
+		},
+		wantErr: "missing field(s): spec.region, spec.streamName",
+	}, {
+		name: "delete policy",
+		spec: KinesisSourceSpec{
+			StreamName:     "stream",
+			Region:         "us-west-2",
+			Sink:           sink,
+			DeletionPolicy: DeletionPolicyDelete,
+		},
+	}, {
+		name: "unknown deletion policy",
+		spec: KinesisSourceSpec{
+			StreamName:     "stream",
+			Region:         "us-west-2",
+			Sink:           sink,
+			DeletionPolicy: "Orphan",
+		},
+		wantErr: "invalid value \"Orphan\": spec.deletionPolicy",
+	}, {
+		name: "kcl, metrics and retry",
+		spec: KinesisSourceSpec{
+			StreamName:     "stream",
+			Region:         "us-west-2",
+			Sink:           sink,
+			KCL:            &KCLSpec{MaxRecords: int32Ptr(100)},
+			MetricsBackend: MetricsBackendPrometheus,
+			Retry:          &RetryPolicy{Attempts: int32Ptr(3), Backoff: &metav1.Duration{Duration: time.Second}},
+		},
+	}, {
+		name: "non positive kcl max records",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			KCL:        &KCLSpec{MaxRecords: int32Ptr(0)},
+		},
+		wantErr: "invalid value \"0\": spec.kcl.maxRecords",
+	}, {
+		name: "unknown metrics backend",
+		spec: KinesisSourceSpec{
+			StreamName:     "stream",
+			Region:         "us-west-2",
+			Sink:           sink,
+			MetricsBackend: "statsd",
+		},
+		wantErr: "invalid value \"statsd\": spec.metricsBackend",
+	}, {
+		name: "unknown mesh",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			Mesh:       "consul",
+		},
+		wantErr: "invalid value \"consul\": spec.mesh",
+	}, {
+		name: "cloudwatch logs payload format",
+		spec: KinesisSourceSpec{
+			StreamName:    "stream",
+			Region:        "us-west-2",
+			Sink:          sink,
+			PayloadFormat: PayloadFormatCloudWatchLogs,
+		},
+	}, {
+		name: "lambda payload format",
+		spec: KinesisSourceSpec{
+			StreamName:    "stream",
+			Region:        "us-west-2",
+			Sink:          sink,
+			PayloadFormat: PayloadFormatLambda,
+			Compression:   CompressionGzip,
+			CEOverrides:   &CEOverrides{Subject: "${stream}/${shard}"},
+		},
+	}, {
+		name: "content type of lambda events",
+		spec: KinesisSourceSpec{
+			StreamName:      "stream",
+			Region:          "us-west-2",
+			Sink:            sink,
+			PayloadFormat:   PayloadFormatLambda,
+			DataContentType: DataContentTypeJSON,
+		},
+		wantErr: "must not set the field(s): spec.dataContentType",
+	}, {
+		name: "unknown payload format",
+		spec: KinesisSourceSpec{
+			StreamName:    "stream",
+			Region:        "us-west-2",
+			Sink:          sink,
+			PayloadFormat: "firehose",
+		},
+		wantErr: "invalid value \"firehose\": spec.payloadFormat",
+	}, {
+		name: "dynamodb changes payload format",
+		spec: KinesisSourceSpec{
+			StreamName:      "stream",
+			Region:          "us-west-2",
+			Sink:            sink,
+			PayloadFormat:   PayloadFormatDynamoDBChanges,
+			DynamoDBChanges: &DynamoDBChangesOptions{PlainJSON: true},
+		},
+	}, {
+		name: "dynamodb changes options without the payload format",
+		spec: KinesisSourceSpec{
+			StreamName:      "stream",
+			Region:          "us-west-2",
+			Sink:            sink,
+			DynamoDBChanges: &DynamoDBChangesOptions{PlainJSON: true},
+		},
+		wantErr: "must not set the field(s): spec.dynamodbChanges",
+	}, {
+		name: "binary records with compression",
+		spec: KinesisSourceSpec{
+			StreamName:      "stream",
+			Region:          "us-west-2",
+			Sink:            sink,
+			PayloadFormat:   PayloadFormatRecord,
+			DataContentType: DataContentTypeBinary,
+			Compression:     CompressionAuto,
+		},
+	}, {
+		name: "binary batches",
+		spec: KinesisSourceSpec{
+			StreamName:      "stream",
+			Region:          "us-west-2",
+			Sink:            sink,
+			DataContentType: DataContentTypeBinary,
+		},
+		wantErr: "application/octet-stream needs the record payload format: spec.dataContentType",
+	}, {
+		name: "content type of log events",
+		spec: KinesisSourceSpec{
+			StreamName:      "stream",
+			Region:          "us-west-2",
+			Sink:            sink,
+			PayloadFormat:   PayloadFormatCloudWatchLogs,
+			DataContentType: DataContentTypeJSON,
+		},
+		wantErr: "must not set the field(s): spec.dataContentType",
+	}, {
+		name: "unknown content type and compression",
+		spec: KinesisSourceSpec{
+			StreamName:      "stream",
+			Region:          "us-west-2",
+			Sink:            sink,
+			DataContentType: "application/xml",
+			Compression:     "lz4",
+		},
+		wantErr: "invalid value \"application/xml\": spec.dataContentType\ninvalid value \"lz4\": spec.compression",
+	}, {
+		name: "protobuf records with a dead-letter sink",
+		spec: KinesisSourceSpec{
+			StreamName:        "stream",
+			Region:            "us-west-2",
+			Sink:              sink,
+			PayloadFormat:     PayloadFormatRecord,
+			Schema:            &SchemaSpec{Type: SchemaTypeProtobuf, ConfigMapName: "schemas", MessageType: "acme.Order"},
+			DeadLetterSinkURI: "http://dead-letters.default.svc.cluster.local/",
+		},
+	}, {
+		name: "protobuf without message type",
+		spec: KinesisSourceSpec{
+			StreamName:    "stream",
+			Region:        "us-west-2",
+			Sink:          sink,
+			PayloadFormat: PayloadFormatRecord,
+			Schema:        &SchemaSpec{Type: SchemaTypeProtobuf, ConfigMapName: "schemas"},
+		},
+		wantErr: "missing field(s): spec.schema.messageType",
+	}, {
+		name: "avro batches",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			Schema:     &SchemaSpec{Type: SchemaTypeAvro, ConfigMapName: "schemas"},
+		},
+		wantErr: "schema needs the record payload format: spec.schema",
+	}, {
+		name: "avro as text",
+		spec: KinesisSourceSpec{
+			StreamName:      "stream",
+			Region:          "us-west-2",
+			Sink:            sink,
+			PayloadFormat:   PayloadFormatRecord,
+			DataContentType: DataContentTypeText,
+			Schema:          &SchemaSpec{Type: SchemaTypeAvro, ConfigMapName: "schemas"},
+		},
+		wantErr: "schema decodes the data to application/json: spec.dataContentType",
+	}, {
+		name: "relative dead-letter sink",
+		spec: KinesisSourceSpec{
+			StreamName:        "stream",
+			Region:            "us-west-2",
+			Sink:              sink,
+			DeadLetterSinkURI: "/dead-letters",
+		},
+		wantErr: "invalid value \"/dead-letters\": spec.deadLetterSinkUri",
+	}, {
+		name: "filter",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			Filter: &FilterSpec{
+				PartitionKey: &StringMatch{Prefix: stringPtr("orders-")},
+				ArrivedAfter: &metav1.Time{Time: time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)},
+				Fields: []FieldMatch{
+					{Path: "$.detail.type", StringMatch: StringMatch{Equals: stringPtr("created")}},
+					{Path: "{.items[*].sku}", StringMatch: StringMatch{Prefix: stringPtr("A")}},
+				},
+			},
+		},
+	}, {
+		name: "filter field without a match",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			Filter:     &FilterSpec{Fields: []FieldMatch{{Path: "$.detail"}}},
+		},
+		wantErr: "expected exactly one, got neither: spec.filter.fields[0].equals, spec.filter.fields[0].prefix",
+	}, {
+		name: "filter with an invalid JSONPath",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			Filter:     &FilterSpec{Fields: []FieldMatch{{Path: "$.items[", StringMatch: StringMatch{Equals: stringPtr("a")}}}},
+		},
+		wantErr: "invalid JSONPath: unterminated array: spec.filter.fields[0].path",
+	}, {
+		name: "filter with an empty arrival window and two partition key matches",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			Filter: &FilterSpec{
+				PartitionKey:  &StringMatch{Equals: stringPtr("a"), Prefix: stringPtr("b")},
+				ArrivedAfter:  &metav1.Time{Time: time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)},
+				ArrivedBefore: &metav1.Time{Time: time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		wantErr: "arrivedAfter must be before arrivedBefore: spec.filter.arrivedAfter, spec.filter.arrivedBefore\n" +
+			"expected exactly one, got both: spec.filter.partitionKey.equals, spec.filter.partitionKey.prefix",
+	}, {
+		name: "filter fields with the cloudwatch logs payload format",
+		spec: KinesisSourceSpec{
+			StreamName:    "stream",
+			Region:        "us-west-2",
+			Sink:          sink,
+			PayloadFormat: PayloadFormatCloudWatchLogs,
+			Filter: &FilterSpec{
+				PartitionKey: &StringMatch{Prefix: stringPtr("orders-")},
+				Fields:       []FieldMatch{{Path: "$.logGroup", StringMatch: StringMatch{Equals: stringPtr("orders")}}},
+			},
+		},
+		wantErr: "fields cannot match the gzipped data of the cloudwatchLogs payload format: spec.filter.fields",
+	}, {
+		name: "filter partition key with the cloudwatch logs payload format",
+		spec: KinesisSourceSpec{
+			StreamName:    "stream",
+			Region:        "us-west-2",
+			Sink:          sink,
+			PayloadFormat: PayloadFormatCloudWatchLogs,
+			Filter:        &FilterSpec{PartitionKey: &StringMatch{Prefix: stringPtr("orders-")}},
+		},
+	}, {
+		name: "ce overrides",
+		spec: KinesisSourceSpec{
+			StreamName:    "stream",
+			Region:        "us-west-2",
+			Sink:          sink,
+			PayloadFormat: PayloadFormatRecord,
+			CEOverrides: &CEOverrides{
+				Type:       "com.acme.${$.detail.type:-unknown}",
+				Source:     "/streams/${stream}",
+				Subject:    "${partitionKey}",
+				Extensions: map[string]string{"shard": "${shard}", "tenant": "${$.tenant}"},
+			},
+		},
+	}, {
+		name: "ce overrides of batches",
+		spec: KinesisSourceSpec{
+			StreamName:  "stream",
+			Region:      "us-west-2",
+			Sink:        sink,
+			CEOverrides: &CEOverrides{Type: "com.acme.batch", Source: "/streams/${stream}/${shard}"},
+		},
+	}, {
+		name: "ce overrides of batches from the data",
+		spec: KinesisSourceSpec{
+			StreamName:  "stream",
+			Region:      "us-west-2",
+			Sink:        sink,
+			CEOverrides: &CEOverrides{Type: "${$.type}"},
+		},
+		wantErr: "partitionKey and JSONPath placeholders need a payload format delivering every record: spec.ceOverrides",
+	}, {
+		name: "invalid ce overrides",
+		spec: KinesisSourceSpec{
+			StreamName:    "stream",
+			Region:        "us-west-2",
+			Sink:          sink,
+			PayloadFormat: PayloadFormatRecord,
+			CEOverrides: &CEOverrides{
+				Subject:    "${sequenceNumber}",
+				Extensions: map[string]string{"type": "a"},
+			},
+		},
+		wantErr: "invalid key name \"type\": spec.ceOverrides.extensions\n" +
+			"invalid template: unknown variable \"sequenceNumber\": spec.ceOverrides.subject",
+	}, {
+		name: "transform",
+		spec: KinesisSourceSpec{
+			StreamName:      "stream",
+			Region:          "us-west-2",
+			Sink:            sink,
+			PayloadFormat:   PayloadFormatRecord,
+			DataContentType: DataContentTypeJSON,
+			Transform: []TransformStep{
+				{Select: []string{"$.id", "$.user", "$.items[*].sku"}},
+				{Rename: []FieldRename{{From: "$.user.mail", To: "$.contact['e-mail']"}}},
+				{Drop: []string{"$.user.ssn"}},
+				{Mask: &MaskSpec{Paths: []string{"$.contact.*"}, Hash: MaskHashSHA256}},
+				{Add: []FieldValue{{Path: "$.origin", Value: runtime.RawExtension{Raw: []byte(`{"region":"eu"}`)}}}},
+			},
+		},
+	}, {
+		name: "transform of avro records",
+		spec: KinesisSourceSpec{
+			StreamName:    "stream",
+			Region:        "us-west-2",
+			Sink:          sink,
+			PayloadFormat: PayloadFormatRecord,
+			Schema:        &SchemaSpec{Type: SchemaTypeAvro, ConfigMapName: "schemas"},
+			Transform:     []TransformStep{{Drop: []string{"$.ssn"}}},
+		},
+	}, {
+		name: "transform of binary records",
+		spec: KinesisSourceSpec{
+			StreamName:    "stream",
+			Region:        "us-west-2",
+			Sink:          sink,
+			PayloadFormat: PayloadFormatCloudWatchLogs,
+			Transform:     []TransformStep{{Drop: []string{"$.ssn"}}},
+		},
+		wantErr: "transform needs JSON data, an application/json dataContentType or a schema: spec.transform\n" +
+			"transform needs the kcl or record payload format: spec.transform",
+	}, {
+		name: "invalid transform steps",
+		spec: KinesisSourceSpec{
+			StreamName:      "stream",
+			Region:          "us-west-2",
+			Sink:            sink,
+			DataContentType: DataContentTypeJSON,
+			Transform: []TransformStep{
+				{},
+				{Select: []string{"$.a"}, Drop: []string{"b"}},
+				{Rename: []FieldRename{{From: "$.items[*]", To: "$.all"}}},
+				{Mask: &MaskSpec{Paths: []string{"$.a"}, Hash: "md5"}},
+				{Add: []FieldValue{{Path: "$.a", Value: runtime.RawExtension{Raw: []byte("{")}}}},
+			},
+		},
+		wantErr: "expected exactly one, got both: spec.transform[1].drop, spec.transform[1].select\n" +
+			"expected exactly one, got neither: spec.transform[0].add, spec.transform[0].drop, spec.transform[0].mask, spec.transform[0].rename, spec.transform[0].select\n" +
+			"invalid value \"md5\": spec.transform[3].mask.hash\n" +
+			"invalid value \"{\": spec.transform[4].add[0].value\n" +
+			"path \"$.items[*]\" may not hold *: spec.transform[2].rename[0].from\n" +
+			"path \"b\" does not start with $: spec.transform[1].drop[0]",
+	}, {
+		name: "non positive retry attempts",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			Retry:      &RetryPolicy{Attempts: int32Ptr(0)},
+		},
+		wantErr: "invalid value \"0\": spec.retry.attempts",
+	}, {
+		name: "replay from trim horizon",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			Replay:     &ReplaySpec{Token: "1", TrimHorizon: true},
+		},
+	}, {
+		name: "replay without token",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			Replay:     &ReplaySpec{TrimHorizon: true},
+		},
+		wantErr: "missing field(s): spec.replay.token",
+	}, {
+		name: "replay without position",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			Replay:     &ReplaySpec{Token: "1"},
+		},
+		wantErr: "expected exactly one, got neither: spec.replay.sequenceNumbers, spec.replay.timestamp, spec.replay.trimHorizon",
+	}, {
+		name: "replay with several positions",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			Replay: &ReplaySpec{
+				Token:           "1",
+				TrimHorizon:     true,
+				SequenceNumbers: map[string]string{"shardId-000000000000": "49590338271490256608559692538361571095921575989136588898"},
+			},
+		},
+		wantErr: "expected exactly one, got both: spec.replay.sequenceNumbers, spec.replay.trimHorizon",
+	}, {
+		name: "replay with empty sequence number",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			Replay: &ReplaySpec{
+				Token:           "1",
+				SequenceNumbers: map[string]string{"shardId-000000000000": ""},
+			},
+		},
+		wantErr: "missing field(s): spec.replay.sequenceNumbers[shardId-000000000000]",
+	}, {
+		name: "template",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			Template: &ReceiveAdapterTemplate{
+				Metadata: ReceiveAdapterMetadata{Annotations: map[string]string{"team": "a"}},
+				Spec:     ReceiveAdapterPodSpec{Env: []corev1.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}}},
+			},
+		},
+	}, {
+		name: "template with credentials",
+		spec: KinesisSourceSpec{
+			StreamName: "stream",
+			Region:     "us-west-2",
+			Sink:       sink,
+			Template: &ReceiveAdapterTemplate{
+				Metadata: ReceiveAdapterMetadata{Annotations: map[string]string{IAMRoleAnnotation: "admin"}},
+				Spec: ReceiveAdapterPodSpec{Env: []corev1.EnvVar{
+					{Name: "LOG_LEVEL", Value: "debug"},
+					{Name: "KCL_IAM_ROLE_ARN", Value: "arn:aws:iam::123456789012:role/admin"},
+				}},
+			},
+		},
+		wantErr: "AWS credentials only come from awsCredsSecret or kiamOptions: spec.template.metadata.annotations[iam.amazonaws.com/role], spec.template.spec.env[1].name",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &KinesisSource{Spec: test.spec}
+			got := s.Validate(context.TODO())
+			if test.wantErr == "" {
+				if got != nil {
+					t.Errorf("unexpected error: %v", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("expected error %q, but got nil", test.wantErr)
+			}
+			if got.Error() != test.wantErr {
+				t.Errorf("expected error %q, but got %q", test.wantErr, got.Error())
+			}
+		})
+	}
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -21,10 +21,172 @@ limitations under the License.
 package v1alpha1
 
 import (
-	v1 "k8s.io/api/core/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CEOverrides) DeepCopyInto(out *CEOverrides) {
+	*out = *in
+	if in.Extensions != nil {
+		in, out := &in.Extensions, &out.Extensions
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CEOverrides.
+func (in *CEOverrides) DeepCopy() *CEOverrides {
+	if in == nil {
+		return nil
+	}
+	out := new(CEOverrides)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DynamoDBChangesOptions) DeepCopyInto(out *DynamoDBChangesOptions) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DynamoDBChangesOptions.
+func (in *DynamoDBChangesOptions) DeepCopy() *DynamoDBChangesOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(DynamoDBChangesOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FieldMatch) DeepCopyInto(out *FieldMatch) {
+	*out = *in
+	in.StringMatch.DeepCopyInto(&out.StringMatch)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FieldMatch.
+func (in *FieldMatch) DeepCopy() *FieldMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(FieldMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FieldRename) DeepCopyInto(out *FieldRename) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FieldRename.
+func (in *FieldRename) DeepCopy() *FieldRename {
+	if in == nil {
+		return nil
+	}
+	out := new(FieldRename)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FieldValue) DeepCopyInto(out *FieldValue) {
+	*out = *in
+	in.Value.DeepCopyInto(&out.Value)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FieldValue.
+func (in *FieldValue) DeepCopy() *FieldValue {
+	if in == nil {
+		return nil
+	}
+	out := new(FieldValue)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FilterSpec) DeepCopyInto(out *FilterSpec) {
+	*out = *in
+	if in.PartitionKey != nil {
+		in, out := &in.PartitionKey, &out.PartitionKey
+		*out = new(StringMatch)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ArrivedAfter != nil {
+		in, out := &in.ArrivedAfter, &out.ArrivedAfter
+		*out = (*in).DeepCopy()
+	}
+	if in.ArrivedBefore != nil {
+		in, out := &in.ArrivedBefore, &out.ArrivedBefore
+		*out = (*in).DeepCopy()
+	}
+	if in.Fields != nil {
+		in, out := &in.Fields, &out.Fields
+		*out = make([]FieldMatch, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FilterSpec.
+func (in *FilterSpec) DeepCopy() *FilterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FilterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KCLSpec) DeepCopyInto(out *KCLSpec) {
+	*out = *in
+	if in.MaxRecords != nil {
+		in, out := &in.MaxRecords, &out.MaxRecords
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxLeasesForWorker != nil {
+		in, out := &in.MaxLeasesForWorker, &out.MaxLeasesForWorker
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ShardSyncInterval != nil {
+		in, out := &in.ShardSyncInterval, &out.ShardSyncInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.FailoverTime != nil {
+		in, out := &in.FailoverTime, &out.FailoverTime
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KCLSpec.
+func (in *KCLSpec) DeepCopy() *KCLSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KCLSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KiamOptions) DeepCopyInto(out *KiamOptions) {
 	*out = *in
@@ -109,9 +271,61 @@ func (in *KinesisSourceSpec) DeepCopyInto(out *KinesisSourceSpec) {
 	out.KIAMOptions = in.KIAMOptions
 	if in.Sink != nil {
 		in, out := &in.Sink, &out.Sink
-		*out = new(v1.ObjectReference)
+		*out = new(corev1.ObjectReference)
 		**out = **in
 	}
+	if in.Template != nil {
+		in, out := &in.Template, &out.Template
+		*out = new(ReceiveAdapterTemplate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Replay != nil {
+		in, out := &in.Replay, &out.Replay
+		*out = new(ReplaySpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LagThreshold != nil {
+		in, out := &in.LagThreshold, &out.LagThreshold
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.KCL != nil {
+		in, out := &in.KCL, &out.KCL
+		*out = new(KCLSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Retry != nil {
+		in, out := &in.Retry, &out.Retry
+		*out = new(RetryPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DynamoDBChanges != nil {
+		in, out := &in.DynamoDBChanges, &out.DynamoDBChanges
+		*out = new(DynamoDBChangesOptions)
+		**out = **in
+	}
+	if in.Schema != nil {
+		in, out := &in.Schema, &out.Schema
+		*out = new(SchemaSpec)
+		**out = **in
+	}
+	if in.Filter != nil {
+		in, out := &in.Filter, &out.Filter
+		*out = new(FilterSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CEOverrides != nil {
+		in, out := &in.CEOverrides, &out.CEOverrides
+		*out = new(CEOverrides)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Transform != nil {
+		in, out := &in.Transform, &out.Transform
+		*out = make([]TransformStep, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -129,6 +343,18 @@ func (in *KinesisSourceSpec) DeepCopy() *KinesisSourceSpec {
 func (in *KinesisSourceStatus) DeepCopyInto(out *KinesisSourceStatus) {
 	*out = *in
 	in.Status.DeepCopyInto(&out.Status)
+	if in.Replay != nil {
+		in, out := &in.Replay, &out.Replay
+		*out = new(ReplayStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Shards != nil {
+		in, out := &in.Shards, &out.Shards
+		*out = make([]ShardStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -141,3 +367,319 @@ func (in *KinesisSourceStatus) DeepCopy() *KinesisSourceStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaskSpec) DeepCopyInto(out *MaskSpec) {
+	*out = *in
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Replacement != nil {
+		in, out := &in.Replacement, &out.Replacement
+		*out = new(string)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaskSpec.
+func (in *MaskSpec) DeepCopy() *MaskSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MaskSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReceiveAdapterMetadata) DeepCopyInto(out *ReceiveAdapterMetadata) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReceiveAdapterMetadata.
+func (in *ReceiveAdapterMetadata) DeepCopy() *ReceiveAdapterMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(ReceiveAdapterMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReceiveAdapterPodSpec) DeepCopyInto(out *ReceiveAdapterPodSpec) {
+	*out = *in
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(corev1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(corev1.PodSecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReceiveAdapterPodSpec.
+func (in *ReceiveAdapterPodSpec) DeepCopy() *ReceiveAdapterPodSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReceiveAdapterPodSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReceiveAdapterTemplate) DeepCopyInto(out *ReceiveAdapterTemplate) {
+	*out = *in
+	in.Metadata.DeepCopyInto(&out.Metadata)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReceiveAdapterTemplate.
+func (in *ReceiveAdapterTemplate) DeepCopy() *ReceiveAdapterTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(ReceiveAdapterTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReplaySpec) DeepCopyInto(out *ReplaySpec) {
+	*out = *in
+	if in.Timestamp != nil {
+		in, out := &in.Timestamp, &out.Timestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.SequenceNumbers != nil {
+		in, out := &in.SequenceNumbers, &out.SequenceNumbers
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplaySpec.
+func (in *ReplaySpec) DeepCopy() *ReplaySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ReplaySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReplayStatus) DeepCopyInto(out *ReplayStatus) {
+	*out = *in
+	in.CompletionTime.DeepCopyInto(&out.CompletionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplayStatus.
+func (in *ReplayStatus) DeepCopy() *ReplayStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ReplayStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetryPolicy) DeepCopyInto(out *RetryPolicy) {
+	*out = *in
+	if in.Attempts != nil {
+		in, out := &in.Attempts, &out.Attempts
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Backoff != nil {
+		in, out := &in.Backoff, &out.Backoff
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaxBackoff != nil {
+		in, out := &in.MaxBackoff, &out.MaxBackoff
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetryPolicy.
+func (in *RetryPolicy) DeepCopy() *RetryPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(RetryPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchemaSpec) DeepCopyInto(out *SchemaSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchemaSpec.
+func (in *SchemaSpec) DeepCopy() *SchemaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SchemaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ShardStatus) DeepCopyInto(out *ShardStatus) {
+	*out = *in
+	if in.LeaseTimeout != nil {
+		in, out := &in.LeaseTimeout, &out.LeaseTimeout
+		*out = (*in).DeepCopy()
+	}
+	if in.CheckpointTime != nil {
+		in, out := &in.CheckpointTime, &out.CheckpointTime
+		*out = (*in).DeepCopy()
+	}
+	if in.MillisBehindLatest != nil {
+		in, out := &in.MillisBehindLatest, &out.MillisBehindLatest
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ShardStatus.
+func (in *ShardStatus) DeepCopy() *ShardStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ShardStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StringMatch) DeepCopyInto(out *StringMatch) {
+	*out = *in
+	if in.Equals != nil {
+		in, out := &in.Equals, &out.Equals
+		*out = new(string)
+		**out = **in
+	}
+	if in.Prefix != nil {
+		in, out := &in.Prefix, &out.Prefix
+		*out = new(string)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StringMatch.
+func (in *StringMatch) DeepCopy() *StringMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(StringMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TransformStep) DeepCopyInto(out *TransformStep) {
+	*out = *in
+	if in.Select != nil {
+		in, out := &in.Select, &out.Select
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Drop != nil {
+		in, out := &in.Drop, &out.Drop
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rename != nil {
+		in, out := &in.Rename, &out.Rename
+		*out = make([]FieldRename, len(*in))
+		copy(*out, *in)
+	}
+	if in.Mask != nil {
+		in, out := &in.Mask, &out.Mask
+		*out = new(MaskSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Add != nil {
+		in, out := &in.Add, &out.Add
+		*out = make([]FieldValue, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TransformStep.
+func (in *TransformStep) DeepCopy() *TransformStep {
+	if in == nil {
+		return nil
+	}
+	out := new(TransformStep)
+	in.DeepCopyInto(out)
+	return out
+}
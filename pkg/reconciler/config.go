@@ -0,0 +1,278 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	"github.com/whynowy/knative-source-kinesis/pkg/reconciler/resources"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	// configName is the name of the ConfigMap holding the cluster-wide defaults of the receive
+	// adapters, in the namespace of the controller.
+	configName = "config-kinesis-source"
+
+	// systemNamespaceEnvVar is the name of the environment variable that contains the namespace
+	// of the controller.
+	systemNamespaceEnvVar = "SYSTEM_NAMESPACE"
+
+	// defaultSystemNamespace is the namespace of the controller when systemNamespaceEnvVar is not
+	// defined.
+	defaultSystemNamespace = "knative-sources"
+)
+
+// getSystemNamespace returns the namespace of the controller, holding its ConfigMaps.
+func getSystemNamespace() string {
+	if ns, defined := os.LookupEnv(systemNamespaceEnvVar); defined {
+		return ns
+	}
+	return defaultSystemNamespace
+}
+
+// Keys of the config-kinesis-source ConfigMap.
+const (
+	imageKey                 = "receive-adapter-image"
+	meshKey                  = "mesh"
+	kclMaxRecordsKey         = "kcl-max-records"
+	kclMaxLeasesForWorkerKey = "kcl-max-leases-for-worker"
+	kclShardSyncIntervalKey  = "kcl-shard-sync-interval"
+	kclFailoverTimeKey       = "kcl-failover-time"
+	metricsBackendKey        = "metrics-backend"
+	retryAttemptsKey         = "retry-attempts"
+	retryBackoffKey          = "retry-backoff"
+	retryMaxBackoffKey       = "retry-max-backoff"
+)
+
+// configStore provides the current defaults of the receive adapters, and the policy of the
+// sources.
+type configStore interface {
+	Defaults() *resources.Defaults
+	Policy() policy
+}
+
+// newDefaults parses the data of the config-kinesis-source ConfigMap. The image defaults to the
+// given one, and the mesh to Istio.
+func newDefaults(data map[string]string, image string) (*resources.Defaults, error) {
+	defaults := &resources.Defaults{
+		Image: image,
+		Mesh:  v1alpha1.MeshIstio,
+	}
+	if v, ok := data[imageKey]; ok {
+		defaults.Image = v
+	}
+	if v, ok := data[meshKey]; ok {
+		switch mesh := v1alpha1.Mesh(v); mesh {
+		case v1alpha1.MeshNone, v1alpha1.MeshIstio, v1alpha1.MeshLinkerd:
+			defaults.Mesh = mesh
+		default:
+			return nil, fmt.Errorf("invalid %s %q", meshKey, v)
+		}
+	}
+
+	var err error
+	if defaults.KCL.MaxRecords, err = parseInt32(data, kclMaxRecordsKey); err != nil {
+		return nil, err
+	}
+	if defaults.KCL.MaxLeasesForWorker, err = parseInt32(data, kclMaxLeasesForWorkerKey); err != nil {
+		return nil, err
+	}
+	if defaults.KCL.ShardSyncInterval, err = parseDuration(data, kclShardSyncIntervalKey); err != nil {
+		return nil, err
+	}
+	if defaults.KCL.FailoverTime, err = parseDuration(data, kclFailoverTimeKey); err != nil {
+		return nil, err
+	}
+	if fe := defaults.KCL.Validate(context.TODO()); fe != nil {
+		return nil, fe
+	}
+
+	switch backend := v1alpha1.MetricsBackend(data[metricsBackendKey]); backend {
+	case "", v1alpha1.MetricsBackendCloudWatch, v1alpha1.MetricsBackendPrometheus, v1alpha1.MetricsBackendNone:
+		defaults.MetricsBackend = backend
+	default:
+		return nil, fmt.Errorf("invalid %s %q", metricsBackendKey, backend)
+	}
+
+	if defaults.Retry.Attempts, err = parseInt32(data, retryAttemptsKey); err != nil {
+		return nil, err
+	}
+	if defaults.Retry.Backoff, err = parseDuration(data, retryBackoffKey); err != nil {
+		return nil, err
+	}
+	if defaults.Retry.MaxBackoff, err = parseDuration(data, retryMaxBackoffKey); err != nil {
+		return nil, err
+	}
+	if fe := defaults.Retry.Validate(context.TODO()); fe != nil {
+		return nil, fe
+	}
+	return defaults, nil
+}
+
+func parseInt32(data map[string]string, key string) (*int32, error) {
+	v, ok := data[key]
+	if !ok {
+		return nil, nil
+	}
+	i, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %v", key, v, err)
+	}
+	i32 := int32(i)
+	return &i32, nil
+}
+
+func parseDuration(data map[string]string, key string) (*metav1.Duration, error) {
+	v, ok := data[key]
+	if !ok {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %v", key, v, err)
+	}
+	return &metav1.Duration{Duration: d}, nil
+}
+
+// configWatcher watches the config-kinesis-source ConfigMap. Every source is sent to the
+// controller as a GenericEvent whenever the defaults change. An invalid ConfigMap is ignored, and
+// the previous defaults are kept.
+type configWatcher struct {
+	kube      kubernetes.Interface
+	namespace string
+	image     string
+	events    chan<- event.GenericEvent
+	logger    *zap.SugaredLogger
+
+	// client lists the sources to reconcile again.
+	client client.Client
+
+	mu       sync.RWMutex
+	defaults *resources.Defaults
+}
+
+func newConfigWatcher(kube kubernetes.Interface, namespace, image string, events chan<- event.GenericEvent, logger *zap.SugaredLogger) *configWatcher {
+	// The built-in defaults are valid.
+	defaults, _ := newDefaults(nil, image)
+	return &configWatcher{
+		kube:      kube,
+		namespace: namespace,
+		image:     image,
+		events:    events,
+		logger:    logger,
+		defaults:  defaults,
+	}
+}
+
+// InjectClient is called by the Manager to provide the client listing the sources.
+func (w *configWatcher) InjectClient(c client.Client) error {
+	w.client = c
+	return nil
+}
+
+// Defaults returns the current defaults.
+func (w *configWatcher) Defaults() *resources.Defaults {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.defaults
+}
+
+// Start watches the ConfigMap until the stop channel is closed. It implements manager.Runnable.
+func (w *configWatcher) Start(stopCh <-chan struct{}) error {
+	watchConfigMap(w.kube, w.namespace, configName, w.update, stopCh)
+	return nil
+}
+
+// update replaces the defaults with the ones of the given ConfigMap data, and reconciles every
+// source again.
+func (w *configWatcher) update(data map[string]string) {
+	defaults, err := newDefaults(data, w.image)
+	if err != nil {
+		w.logger.Errorw("Ignoring invalid "+configName, zap.Error(err))
+		return
+	}
+
+	w.mu.Lock()
+	w.defaults = defaults
+	w.mu.Unlock()
+	w.logger.Infow("Updated the receive adapter defaults", zap.Any("defaults", defaults))
+
+	enqueueSources(w.client, w.events, w.logger)
+}
+
+// watchConfigMap calls update with the data of a ConfigMap whenever it changes, and with nil when
+// it is deleted, until the stop channel is closed.
+func watchConfigMap(kube kubernetes.Interface, namespace, name string, update func(map[string]string), stopCh <-chan struct{}) {
+	lw := cache.NewListWatchFromClient(kube.CoreV1().RESTClient(), "configmaps", namespace,
+		fields.OneTermEqualSelector("metadata.name", name))
+	_, informer := cache.NewInformer(lw, &corev1.ConfigMap{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { update(obj.(*corev1.ConfigMap).Data) },
+		UpdateFunc: func(_, obj interface{}) { update(obj.(*corev1.ConfigMap).Data) },
+		DeleteFunc: func(interface{}) { update(nil) },
+	})
+	informer.Run(stopCh)
+}
+
+// enqueueSources sends every source to the controller as a GenericEvent, to reconcile them again.
+// The events are sent from another goroutine, so that the informer calling it is not blocked until
+// the controller received all of them.
+func enqueueSources(c client.Client, events chan<- event.GenericEvent, logger *zap.SugaredLogger) {
+	sources := &v1alpha1.KinesisSourceList{}
+	if err := c.List(context.TODO(), &client.ListOptions{}, sources); err != nil {
+		logger.Errorw("Unable to list the sources to reconcile", zap.Error(err))
+		return
+	}
+	go func() {
+		for i := range sources.Items {
+			src := &sources.Items[i]
+			events <- event.GenericEvent{Meta: src, Object: src}
+		}
+	}()
+}
+
+// watchedConfig is the configStore of the controller, made of the watched ConfigMaps.
+type watchedConfig struct {
+	defaults *configWatcher
+	policy   *policyWatcher
+}
+
+var _ configStore = (*watchedConfig)(nil)
+
+// Defaults implements configStore.
+func (c *watchedConfig) Defaults() *resources.Defaults {
+	return c.defaults.Defaults()
+}
+
+// Policy implements configStore.
+func (c *watchedConfig) Policy() policy {
+	return c.policy.Policy()
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	controllertesting "github.com/knative/eventing-sources/pkg/controller/testing"
+	sourcesv1alpha1 "github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	"github.com/whynowy/knative-source-kinesis/pkg/reconciler/resources"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestNewDefaults(t *testing.T) {
+	maxRecords := int32(100)
+	attempts := int32(3)
+
+	testCases := map[string]struct {
+		data    map[string]string
+		want    *resources.Defaults
+		wantErr bool
+	}{
+		"empty": {
+			want: &resources.Defaults{Image: raImage, Mesh: sourcesv1alpha1.MeshIstio},
+		},
+		"full": {
+			data: map[string]string{
+				imageKey:                "custom-image",
+				meshKey:                 "linkerd",
+				kclMaxRecordsKey:        "100",
+				kclShardSyncIntervalKey: "10s",
+				metricsBackendKey:       "prometheus",
+				retryAttemptsKey:        "3",
+				retryBackoffKey:         "500ms",
+			},
+			want: &resources.Defaults{
+				Image: "custom-image",
+				Mesh:  sourcesv1alpha1.MeshLinkerd,
+				KCL: sourcesv1alpha1.KCLSpec{
+					MaxRecords:        &maxRecords,
+					ShardSyncInterval: &metav1.Duration{Duration: 10 * time.Second},
+				},
+				MetricsBackend: sourcesv1alpha1.MetricsBackendPrometheus,
+				Retry: sourcesv1alpha1.RetryPolicy{
+					Attempts: &attempts,
+					Backoff:  &metav1.Duration{Duration: 500 * time.Millisecond},
+				},
+			},
+		},
+		"unknown mesh": {
+			data:    map[string]string{meshKey: "consul"},
+			wantErr: true,
+		},
+		"invalid duration": {
+			data:    map[string]string{kclFailoverTimeKey: "5"},
+			wantErr: true,
+		},
+		"non positive max records": {
+			data:    map[string]string{kclMaxRecordsKey: "0"},
+			wantErr: true,
+		},
+		"unknown metrics backend": {
+			data:    map[string]string{metricsBackendKey: "statsd"},
+			wantErr: true,
+		},
+		"non positive retry attempts": {
+			data:    map[string]string{retryAttemptsKey: "-1"},
+			wantErr: true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			got, err := newDefaults(tc.data, raImage)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("expected error %v, but got %v", tc.wantErr, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected defaults (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestConfigWatcherUpdate(t *testing.T) {
+	src := getSource()
+	src.TypeMeta = metav1.TypeMeta{APIVersion: sourcesv1alpha1.SchemeGroupVersion.String(), Kind: "KinesisSource"}
+	c := (&controllertesting.TestCase{InitialState: []runtime.Object{src}}).GetClient()
+
+	// The update does not wait for the controller to receive the events.
+	events := make(chan event.GenericEvent)
+	w := newConfigWatcher(nil, testNS, raImage, events, zap.NewNop().Sugar())
+	w.InjectClient(c)
+
+	w.update(map[string]string{imageKey: "custom-image"})
+	if got := w.Defaults().Image; got != "custom-image" {
+		t.Errorf("expected image %q, but got %q", "custom-image", got)
+	}
+	expectEnqueued(t, events, testNS, sourceName)
+
+	// An invalid ConfigMap keeps the previous defaults, and reconciles nothing.
+	w.update(map[string]string{retryAttemptsKey: "none"})
+	if got := w.Defaults().Image; got != "custom-image" {
+		t.Errorf("expected image %q, but got %q", "custom-image", got)
+	}
+	select {
+	case evt := <-events:
+		t.Errorf("unexpected event after an invalid update: %s", evt.Meta.GetName())
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Deleting the ConfigMap restores the built-in defaults.
+	w.update(nil)
+	if diff := cmp.Diff(&resources.Defaults{Image: raImage, Mesh: sourcesv1alpha1.MeshIstio}, w.Defaults()); diff != "" {
+		t.Errorf("unexpected defaults (-want, +got) = %v", diff)
+	}
+	expectEnqueued(t, events, testNS, sourceName)
+}
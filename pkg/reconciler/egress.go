@@ -0,0 +1,102 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"context"
+
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	"github.com/whynowy/knative-source-kinesis/pkg/reconciler/resources"
+
+	"github.com/knative/pkg/logging"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reconcileEgress makes the source an owner of the Istio ServiceEntry of its region when its
+// receive adapter is in the Istio mesh, creating the ServiceEntry if needed, and removes it from
+// the owners of the other ServiceEntries. A ServiceEntry is garbage collected along with the last
+// source owning it. Without Istio installed, the ServiceEntry is skipped.
+func (r *reconciler) reconcileEgress(ctx context.Context, src *v1alpha1.KinesisSource) error {
+	logger := logging.FromContext(ctx).Desugar()
+
+	desired := ""
+	if resources.ResolveMesh(r.config.Defaults(), src) == v1alpha1.MeshIstio {
+		desired = resources.EgressName(src.Spec.Region)
+	}
+
+	entries := &unstructured.UnstructuredList{}
+	entries.SetGroupVersionKind(resources.ServiceEntryGVK.GroupVersion().WithKind(resources.ServiceEntryGVK.Kind + "List"))
+	err := r.client.List(ctx, (&client.ListOptions{}).InNamespace(src.Namespace).MatchingLabels(getEgressLabels()), entries)
+	if meta.IsNoMatchError(err) {
+		// Istio is not installed, the receive adapter goes without the ServiceEntry then.
+		if desired != "" {
+			logger.Warn("Skipping the egress ServiceEntry.", zap.Error(err))
+			r.recorder.Eventf(src, corev1.EventTypeWarning, egressSkippedReason, "Skipped the egress ServiceEntry, Istio is not installed: %v", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i := range entries.Items {
+		se := &entries.Items[i]
+		if se.GetName() == desired {
+			found = true
+			if resources.SetEgressOwner(se, src) {
+				if err := r.client.Update(ctx, se); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !resources.RemoveEgressOwner(se, src) {
+			continue
+		}
+		if len(se.GetOwnerReferences()) == 0 {
+			err = r.client.Delete(ctx, se)
+		} else {
+			err = r.client.Update(ctx, se)
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	if found || desired == "" {
+		return nil
+	}
+	se := resources.MakeEgressServiceEntry(src.Namespace, src.Spec.Region, getEgressLabels())
+	resources.SetEgressOwner(se, src)
+	if err := r.client.Create(ctx, se); err != nil {
+		return err
+	}
+	logger.Info("Egress ServiceEntry created.", zap.String("name", se.GetName()))
+	return nil
+}
+
+func getEgressLabels() map[string]string {
+	return map[string]string{
+		sourceLabelKey: controllerAgentName,
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	controllertesting "github.com/knative/eventing-sources/pkg/controller/testing"
+	sourcesv1alpha1 "github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	"github.com/whynowy/knative-source-kinesis/pkg/reconciler/resources"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcileEgress(t *testing.T) {
+	c := (&controllertesting.TestCase{Scheme: scheme.Scheme}).GetClient()
+	r := &reconciler{
+		client:      c,
+		scheme:      scheme.Scheme,
+		config:      testConfig,
+		sinkTracker: &fakeTracker{},
+		pods:        clientPods{c},
+		recorder:    record.NewFakeRecorder(100),
+	}
+
+	src := getSource()
+	other := getSource()
+	other.Name = "other-source"
+	other.UID = "other-uid"
+
+	reconcileEgress := func(src *sourcesv1alpha1.KinesisSource) {
+		t.Helper()
+		if err := r.reconcileEgress(context.TODO(), src); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	expectOwners := func(region string, want ...types.UID) {
+		t.Helper()
+		se := &unstructured.Unstructured{}
+		se.SetGroupVersionKind(resources.ServiceEntryGVK)
+		err := c.Get(context.TODO(), client.ObjectKey{Namespace: testNS, Name: resources.EgressName(region)}, se)
+		if len(want) == 0 {
+			if !apierrors.IsNotFound(err) {
+				t.Errorf("expected no ServiceEntry for %s, got %v", region, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var got []types.UID
+		for _, owner := range se.GetOwnerReferences() {
+			got = append(got, owner.UID)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("unexpected owners of the ServiceEntry for %s (-want, +got) = %v", region, diff)
+		}
+	}
+
+	reconcileEgress(src)
+	reconcileEgress(other)
+	expectOwners("us-west-2", src.UID, other.UID)
+
+	// Moving to another region moves the ownership.
+	src.Spec.Region = "eu-west-1"
+	reconcileEgress(src)
+	expectOwners("us-west-2", other.UID)
+	expectOwners("eu-west-1", src.UID)
+
+	// Leaving the mesh deletes the ServiceEntries owned by no source.
+	src.Spec.Mesh = sourcesv1alpha1.MeshLinkerd
+	reconcileEgress(src)
+	expectOwners("eu-west-1")
+	expectOwners("us-west-2", other.UID)
+}
+
+// noServiceEntryClient is a client of a cluster without Istio, which has no ServiceEntry kind.
+type noServiceEntryClient struct {
+	client.Client
+}
+
+func (c noServiceEntryClient) List(ctx context.Context, opts *client.ListOptions, list runtime.Object) error {
+	if list.GetObjectKind().GroupVersionKind().Group == resources.ServiceEntryGVK.Group {
+		return &meta.NoKindMatchError{GroupKind: resources.ServiceEntryGVK.GroupKind(), SearchedVersions: []string{resources.ServiceEntryGVK.Version}}
+	}
+	return c.Client.List(ctx, opts, list)
+}
+
+func TestReconcileWithoutIstio(t *testing.T) {
+	c := noServiceEntryClient{(&controllertesting.TestCase{
+		InitialState: []runtime.Object{getAddressable()},
+		Scheme:       scheme.Scheme,
+	}).GetClient()}
+	recorder := record.NewFakeRecorder(100)
+	r := &reconciler{
+		client:      c,
+		scheme:      scheme.Scheme,
+		config:      testConfig,
+		sinkTracker: &fakeTracker{},
+		pods:        clientPods{c},
+		recorder:    recorder,
+	}
+
+	// The receive adapter is deployed in the Istio mesh, the default, without its ServiceEntry.
+	src := getSource()
+	if err := r.Reconcile(context.TODO(), src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !src.Status.GetCondition(sourcesv1alpha1.KinesisSourceConditionDeployed).IsTrue() {
+		t.Errorf("expected the receive adapter to be deployed, got %+v", src.Status.GetCondition(sourcesv1alpha1.KinesisSourceConditionDeployed))
+	}
+
+	close(recorder.Events)
+	skipped := false
+	for event := range recorder.Events {
+		if strings.HasPrefix(event, "Warning "+egressSkippedReason) {
+			skipped = true
+		}
+	}
+	if !skipped {
+		t.Errorf("expected an %s event", egressSkippedReason)
+	}
+}
@@ -20,7 +20,11 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
 	"github.com/whynowy/knative-source-kinesis/pkg/reconciler/resources"
@@ -31,17 +35,24 @@ import (
 
 	"go.uber.org/zap"
 	"k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const (
@@ -50,40 +61,154 @@ const (
 	controllerAgentName = "aws-kinesis-source-controller"
 
 	// raImageEnvVar is the name of the environment variable that
-	// contains the receive adapter's image. It must be defined.
+	// contains the receive adapter's image. It is overridden by the
+	// config-kinesis-source ConfigMap.
 	raImageEnvVar = "KINESIS_RA_IMAGE"
 
 	finalizerName = controllerAgentName
+
+	// cleanupTimeout bounds how long the deletion of a source waits for its AWS resources to
+	// be cleaned up.
+	cleanupTimeout = 15 * time.Minute
+
+	// Labels of the receive adapter Deployment and its pods.
+	sourceLabelKey     = "knative-eventing-source"
+	sourceNameLabelKey = "knative-eventing-source-name"
+
+	// Label of the cleanup Job pods, which are not matched by the receive adapter labels.
+	cleanupLabelKey = "knative-eventing-source-cleanup"
+)
+
+// Reasons of the events recorded against KinesisSources.
+const (
+	invalidSpecReason                    = "InvalidSpec"
+	sinkNotFoundReason                   = "SinkNotFound"
+	configurationErrorReason             = "ConfigurationError"
+	receiveAdapterCreatedReason          = "ReceiveAdapterCreated"
+	receiveAdapterUpdatedReason          = "ReceiveAdapterUpdated"
+	receiveAdapterStoppedReason          = "ReceiveAdapterStopped"
+	duplicateReceiveAdapterDeletedReason = "DuplicateReceiveAdapterDeleted"
+	replayCompletedReason                = "ReplayCompleted"
+	laggingReason                        = "Lagging"
+	cleanupStartedReason                 = "CleanupStarted"
+	cleanedUpReason                      = "CleanedUp"
+	cleanupFailedReason                  = "CleanupFailed"
+	egressFailedReason                   = "EgressFailed"
+	egressSkippedReason                  = "EgressSkipped"
+	policyViolationReason                = "PolicyViolation"
 )
 
 // Add creates a new KinesisSource Controller and adds it to the Manager with
 // default RBAC. The Manager will set fields on the Controller and Start it when
-// the Manager is Started.
-func Add(mgr manager.Manager, logger *zap.SugaredLogger) error {
-	raImage, defined := os.LookupEnv(raImageEnvVar)
-	if !defined {
-		return fmt.Errorf("required environment variable '%s' not defined", raImageEnvVar)
+// the Manager is Started. The controller watches the given namespace only,
+// which must match the namespace of the Manager cache, or all namespaces when
+// it is empty.
+func Add(mgr manager.Manager, logger *zap.SugaredLogger, namespace string) error {
+	systemNamespace := getSystemNamespace()
+
+	dynamicClient, err := dynamic.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+	kubeClient, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+
+	// Changes to the objects referenced by sources are delivered to the
+	// controller through this channel.
+	sinkEvents := make(chan event.GenericEvent)
+	st := newSinkTracker(dynamicClient, mgr.GetRESTMapper(), namespace, sinkEvents)
+	if err := mgr.SetFields(st); err != nil {
+		return err
+	}
+
+	// Changes to the config-kinesis-source and config-kinesis-source-policy
+	// ConfigMaps reconcile every source again through this channel.
+	configEvents := make(chan event.GenericEvent)
+	cw := newConfigWatcher(kubeClient, systemNamespace, os.Getenv(raImageEnvVar), configEvents, logger)
+	if err := mgr.Add(cw); err != nil {
+		return err
+	}
+	pw := newPolicyWatcher(kubeClient, systemNamespace, configEvents, logger)
+	// The policy is loaded before any source is reconciled, so that none
+	// gets a receive adapter it is not allowed to.
+	if err := pw.load(); err != nil {
+		return err
+	}
+	if err := mgr.Add(pw); err != nil {
+		return err
+	}
+
+	// Receive adapter pods are watched to carry on with a replay or a cleanup once they are gone.
+	podEvents := make(chan event.GenericEvent)
+	pods := newPodWatcher(kubeClient, namespace, podEvents)
+	if err := mgr.Add(pods); err != nil {
+		return err
 	}
 
 	log.Println("Adding the AWS Kinesis Source controller.")
 	p := &sdk.Provider{
 		AgentName: controllerAgentName,
 		Parent:    &v1alpha1.KinesisSource{},
-		Owns:      []runtime.Object{&v1.Deployment{}},
+		Owns:      []runtime.Object{&v1.Deployment{}, &batchv1.Job{}},
 		Reconciler: &reconciler{
-			scheme:              mgr.GetScheme(),
-			receiveAdapterImage: raImage,
+			scheme:      mgr.GetScheme(),
+			config:      &watchedConfig{defaults: cw, policy: pw},
+			sinkTracker: st,
+			pods:        pods,
+			recorder:    mgr.GetRecorder(controllerAgentName),
 		},
 	}
 
-	return p.Add(mgr, logger)
+	cm := &controllerManager{Manager: mgr}
+	if err := p.Add(cm, logger); err != nil {
+		return err
+	}
+	if cm.controller == nil {
+		return fmt.Errorf("controller %q was not added to the manager", controllerAgentName)
+	}
+
+	if err := cm.controller.Watch(&source.Channel{Source: sinkEvents}, &handler.EnqueueRequestForObject{}); err != nil {
+		return err
+	}
+	if err := cm.controller.Watch(&source.Channel{Source: configEvents}, &handler.EnqueueRequestForObject{}); err != nil {
+		return err
+	}
+
+	return cm.controller.Watch(&source.Channel{Source: podEvents}, &handler.EnqueueRequestForObject{})
+}
+
+// controllerManager wraps a Manager to capture the Controller created by
+// sdk.Provider, which does not expose it, so that watches beyond the parent
+// and owned resources can be added to it.
+type controllerManager struct {
+	manager.Manager
+	controller controller.Controller
+}
+
+func (m *controllerManager) Add(r manager.Runnable) error {
+	if c, ok := r.(controller.Controller); ok {
+		m.controller = c
+	}
+	return m.Manager.Add(r)
 }
 
 type reconciler struct {
 	client client.Client
 	scheme *runtime.Scheme
 
-	receiveAdapterImage string
+	// config provides the defaults of the receive adapters and the policy of the sources.
+	config configStore
+
+	// sinkTracker re-triggers reconciliation when a referenced sink changes.
+	sinkTracker tracker
+
+	// pods lists the receive adapter pods, which the Manager cache does not hold.
+	pods podLister
+
+	// recorder records events against the sources.
+	recorder record.EventRecorder
 }
 
 func (r *reconciler) InjectClient(c client.Client) error {
@@ -101,6 +226,7 @@ func (r *reconciler) Reconcile(ctx context.Context, object runtime.Object) error
 		logger.Error("could not find Kinesis source", zap.Any("object", object))
 		return nil
 	}
+	defer r.refreshShards(ctx, src)
 
 	// This Source attempts to reconcile two things.
 	// 1. Determine the sink's URI.
@@ -114,6 +240,12 @@ func (r *reconciler) Reconcile(ctx context.Context, object runtime.Object) error
 	// See if the source has been deleted.
 	deletionTimestamp := src.DeletionTimestamp
 	if deletionTimestamp != nil {
+		r.sinkTracker.Untrack(src)
+		if src.Spec.DeletionPolicy == v1alpha1.DeletionPolicyDelete {
+			if done, err := r.cleanup(ctx, src); !done {
+				return err
+			}
+		}
 		r.removeFinalizer(src)
 		return nil
 	}
@@ -122,13 +254,41 @@ func (r *reconciler) Reconcile(ctx context.Context, object runtime.Object) error
 
 	src.Status.InitializeConditions()
 
-	sinkURI, err := sinks.GetSinkURI(ctx, r.client, src.Spec.Sink, src.Namespace)
+	if fe := src.Validate(ctx); fe != nil {
+		src.Status.MarkNotDeployed(invalidSpecReason, "%v", fe)
+		r.recorder.Eventf(src, corev1.EventTypeWarning, invalidSpecReason, "Invalid spec: %v", fe)
+		return fe
+	}
+
+	if err := r.config.Policy().check(src); err != nil {
+		if !src.Status.GetCondition(v1alpha1.KinesisSourceConditionPolicyViolation).IsTrue() {
+			r.recorder.Eventf(src, corev1.EventTypeWarning, policyViolationReason, "Policy violation: %v", err)
+		}
+		src.Status.MarkPolicyViolation("%v", err)
+		// The source is reconciled again when the policy changes.
+		return r.stopViolatingReceiveAdapter(ctx, src)
+	}
+	src.Status.MarkPolicyCompliant()
+
+	if err := r.trackSink(src); err != nil {
+		logger.Error("Unable to track the sink", zap.Error(err))
+		return err
+	}
+
+	sinkURI, err := r.resolveSinkURI(ctx, src)
 	if err != nil {
 		src.Status.MarkNoSink("NotFound", "")
+		r.recorder.Eventf(src, corev1.EventTypeWarning, sinkNotFoundReason, "Unable to resolve the sink: %v", err)
 		return err
 	}
 	src.Status.MarkSink(sinkURI)
 
+	if err := r.reconcileEgress(ctx, src); err != nil {
+		logger.Error("Unable to reconcile the egress ServiceEntry", zap.Error(err))
+		r.recorder.Eventf(src, corev1.EventTypeWarning, egressFailedReason, "Unable to reconcile the egress ServiceEntry: %v", err)
+		return err
+	}
+
 	_, err = r.createReceiveAdapter(ctx, src, sinkURI)
 	if err != nil {
 		logger.Error("Unable to create the receive adapter", zap.Error(err))
@@ -136,9 +296,86 @@ func (r *reconciler) Reconcile(ctx context.Context, object runtime.Object) error
 	}
 	src.Status.MarkDeployed()
 
+	lagThreshold := v1alpha1.DefaultLagThreshold
+	if src.Spec.LagThreshold != nil {
+		lagThreshold = src.Spec.LagThreshold.Duration
+	}
+	wasLagging := src.Status.GetCondition(v1alpha1.KinesisSourceConditionLagging).IsTrue()
+	src.Status.MarkLag(lagThreshold)
+	if lagging := src.Status.GetCondition(v1alpha1.KinesisSourceConditionLagging); lagging.IsTrue() && !wasLagging {
+		r.recorder.Event(src, corev1.EventTypeWarning, laggingReason, lagging.Message)
+	}
+
+	if src.Spec.Suspend {
+		src.Status.MarkSuspended()
+	} else {
+		src.Status.MarkResumed()
+	}
+
 	return nil
 }
 
+// refreshShards replaces the shards of the status with the ones of the latest source. They are
+// patched in by the receive adapter, the status written back once the source is reconciled would
+// revert them otherwise.
+func (r *reconciler) refreshShards(ctx context.Context, src *v1alpha1.KinesisSource) {
+	latest := &v1alpha1.KinesisSource{}
+	if err := r.client.Get(ctx, client.ObjectKey{Namespace: src.Namespace, Name: src.Name}, latest); err != nil {
+		return
+	}
+	src.Status.Shards = latest.Status.Shards
+}
+
+// trackSink makes sure the source is reconciled again whenever the object
+// referenced as its sink changes, e.g. when it gets a new address.
+func (r *reconciler) trackSink(src *v1alpha1.KinesisSource) error {
+	if src.Spec.Sink == nil {
+		r.sinkTracker.Untrack(src)
+		return nil
+	}
+	return r.sinkTracker.Track(src, *src.Spec.Sink)
+}
+
+// resolveSinkURI returns the URI the receive adapter delivers events to. An
+// absolute spec.sinkUri is used as is, otherwise the URI is resolved from the
+// referenced Addressable and any relative spec.sinkUri is appended to it.
+func (r *reconciler) resolveSinkURI(ctx context.Context, src *v1alpha1.KinesisSource) (string, error) {
+	if src.Spec.Sink == nil {
+		return src.Spec.SinkURI, nil
+	}
+
+	sinkURI, err := sinks.GetSinkURI(ctx, r.client, src.Spec.Sink, src.Namespace)
+	if err != nil || src.Spec.SinkURI == "" {
+		return sinkURI, err
+	}
+	return joinSinkURI(sinkURI, src.Spec.SinkURI)
+}
+
+// joinSinkURI appends a relative reference to the address of a sink: its path is appended to the
+// path of the address, whether or not the address ends with a slash, and its query and fragment
+// replace those of the address when set.
+func joinSinkURI(sinkURI, relative string) (string, error) {
+	base, err := url.Parse(sinkURI)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(relative)
+	if err != nil {
+		return "", err
+	}
+	if ref.Path != "" {
+		base.Path = strings.TrimSuffix(base.Path, "/") + "/" + strings.TrimPrefix(ref.Path, "/")
+		base.RawPath = ""
+	}
+	if ref.RawQuery != "" {
+		base.RawQuery = ref.RawQuery
+	}
+	if ref.Fragment != "" {
+		base.Fragment = ref.Fragment
+	}
+	return base.String(), nil
+}
+
 func (r *reconciler) createReceiveAdapter(ctx context.Context, src *v1alpha1.KinesisSource, sinkURI string) (*v1.Deployment, error) {
 	ra, err := r.getReceiveAdapter(ctx, src)
 	if err != nil && !apierrors.IsNotFound(err) {
@@ -146,28 +383,63 @@ func (r *reconciler) createReceiveAdapter(ctx context.Context, src *v1alpha1.Kin
 		return nil, err
 	}
 
-	if len(src.Spec.AwsCredsSecret.Name) == 0 && len(src.Spec.AwsCredsSecret.Key) == 0 && len(src.Spec.KIAMOptions.AssignedIAMRole) == 0 && len(src.Spec.KIAMOptions.KCLIAMRoleARN) == 0 {
+	if !hasCredentials(src) {
 		logging.FromContext(ctx).Error("Neither AwsCredsSecret nor KIAMOptions has valid configuration.")
+		r.recorder.Event(src, corev1.EventTypeWarning, configurationErrorReason, "Neither awsCredsSecret nor kiamOptions is configured.")
+		return nil, fmt.Errorf("Configuration error")
+	}
+
+	defaults := r.config.Defaults()
+	if defaults.Image == "" && (src.Spec.Template == nil || src.Spec.Template.Spec.Image == "") {
+		logging.FromContext(ctx).Error("No receive adapter image is configured.")
+		r.recorder.Eventf(src, corev1.EventTypeWarning, configurationErrorReason, "No receive adapter image is configured, set %s in %s.", imageKey, configName)
 		return nil, fmt.Errorf("Configuration error")
 	}
 
 	adapterArgs := resources.ReceiveAdapterArgs{
-		Image:   r.receiveAdapterImage,
-		Source:  src,
-		Labels:  getLabels(src),
-		SinkURI: sinkURI,
+		Defaults: defaults,
+		Source:   src,
+		Labels:   getLabels(src),
+		SinkURI:  sinkURI,
 	}
 
 	expected := resources.MakeReceiveAdapter(&adapterArgs)
 	if ra != nil {
-		if r.podSpecChanged(ra.Spec.Template.Spec, expected.Spec.Template.Spec) {
-			ra.Spec.Template.Spec = expected.Spec.Template.Spec
+		// A replay rewrites the checkpoints of the stream, which must not happen while a
+		// receive adapter is still consuming it. The current receive adapter is stopped
+		// first, and only then replaced by one carrying out the replay.
+		if src.ReplayPending() && ra.Annotations[resources.ReplayTokenAnnotation] != src.Spec.Replay.Token {
+			stopped, err := r.stopReceiveAdapter(ctx, src, ra)
+			if err != nil || !stopped {
+				src.Status.MarkReplaying("Stopping", "Waiting for the receive adapter to stop.")
+				return ra, err
+			}
+			src.Status.MarkReplaying("Restarting", "Restarting the receive adapter from the replay position.")
+		}
+
+		if r.specChanged(ra, expected) {
+			if ra.Annotations == nil {
+				ra.Annotations = make(map[string]string)
+			}
+			ra.Annotations[resources.SpecHashAnnotation] = expected.Annotations[resources.SpecHashAnnotation]
+			if token, ok := expected.Annotations[resources.ReplayTokenAnnotation]; ok {
+				ra.Annotations[resources.ReplayTokenAnnotation] = token
+			} else {
+				delete(ra.Annotations, resources.ReplayTokenAnnotation)
+			}
+			ra.Spec.Replicas = expected.Spec.Replicas
+			ra.Spec.Template = expected.Spec.Template
 			if err = r.client.Update(ctx, ra); err != nil {
 				return ra, err
 			}
 			logging.FromContext(ctx).Desugar().Info("Receive Adapter updated.", zap.Any("receiveAdapter", ra))
+			r.recorder.Eventf(src, corev1.EventTypeNormal, receiveAdapterUpdatedReason, "Updated receive adapter %q.", ra.Name)
 		} else {
 			logging.FromContext(ctx).Desugar().Info("Reusing existing receive adapter", zap.Any("receiveAdapter", ra))
+			if src.ReplayPending() && rolledOut(ra) {
+				src.Status.MarkReplayed(src.Spec.Replay.Token, metav1.Now())
+				r.recorder.Eventf(src, corev1.EventTypeNormal, replayCompletedReason, "Completed replay %q.", src.Spec.Replay.Token)
+			}
 		}
 		return ra, nil
 	}
@@ -180,24 +452,161 @@ func (r *reconciler) createReceiveAdapter(ctx context.Context, src *v1alpha1.Kin
 		return nil, err
 	}
 	logging.FromContext(ctx).Desugar().Info("Receive Adapter created.", zap.Error(err), zap.Any("receiveAdapter", expected))
+	r.recorder.Eventf(src, corev1.EventTypeNormal, receiveAdapterCreatedReason, "Created receive adapter %q.", expected.Name)
 	return expected, err
 }
 
-func (r *reconciler) podSpecChanged(oldPodSpec corev1.PodSpec, newPodSpec corev1.PodSpec) bool {
-	if !equality.Semantic.DeepDerivative(newPodSpec, oldPodSpec) {
-		return true
+// stopViolatingReceiveAdapter stops the receive adapter of a source violating the policy of its
+// namespace. It is started again once the source complies with the policy.
+func (r *reconciler) stopViolatingReceiveAdapter(ctx context.Context, src *v1alpha1.KinesisSource) error {
+	src.Status.MarkNotDeployed(policyViolationReason, "The source violates the policy of its namespace.")
+	ra, err := r.getReceiveAdapter(ctx, src)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = r.stopReceiveAdapter(ctx, src, ra)
+	return err
+}
+
+// hasCredentials reports whether the source is configured with AWS credentials.
+func hasCredentials(src *v1alpha1.KinesisSource) bool {
+	return len(src.Spec.AwsCredsSecret.Name) > 0 || len(src.Spec.AwsCredsSecret.Key) > 0 || len(src.Spec.KIAMOptions.AssignedIAMRole) > 0 || len(src.Spec.KIAMOptions.KCLIAMRoleARN) > 0
+}
+
+// cleanup deletes the AWS resources of a deleted source, and reports whether its finalizer can be
+// removed. The receive adapter is stopped first, so that it does not recreate the lease table, then
+// a Job deletes the resources with the credentials of the receive adapter. A failing cleanup is
+// reported in the status of the source, and given up after cleanupTimeout so that it does not block
+// the deletion forever.
+func (r *reconciler) cleanup(ctx context.Context, src *v1alpha1.KinesisSource) (bool, error) {
+	logger := logging.FromContext(ctx).Desugar()
+
+	// Without credentials, no AWS resources can have been created.
+	if !hasCredentials(src) {
+		return true, nil
+	}
+
+	// A Job must not run with credentials the policy does not allow.
+	if err := r.config.Policy().check(src); err != nil {
+		r.recorder.Eventf(src, corev1.EventTypeWarning, policyViolationReason, "Skipped deleting the AWS resources of the source: %v", err)
+		return true, nil
+	}
+
+	done, err := r.runCleanup(ctx, src)
+	if done {
+		src.Status.MarkCleanedUp()
+		r.recorder.Event(src, corev1.EventTypeNormal, cleanedUpReason, "Deleted the AWS resources of the source.")
+		return true, nil
+	}
+	if err != nil {
+		src.Status.MarkCleanupFailed("CleanupFailed", "%v", err)
+		r.recorder.Eventf(src, corev1.EventTypeWarning, cleanupFailedReason, "Unable to delete the AWS resources of the source: %v", err)
+	}
+	if time.Since(src.DeletionTimestamp.Time) > cleanupTimeout {
+		logger.Warn("Giving up cleaning up the AWS resources of the source.", zap.Error(err))
+		r.recorder.Eventf(src, corev1.EventTypeWarning, cleanupFailedReason, "Gave up deleting the AWS resources of the source after %v.", cleanupTimeout)
+		return true, nil
+	}
+	return false, err
+}
+
+// runCleanup moves the cleanup of a deleted source forward, and reports whether it is done.
+func (r *reconciler) runCleanup(ctx context.Context, src *v1alpha1.KinesisSource) (bool, error) {
+	ra, err := r.getReceiveAdapter(ctx, src)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	if ra != nil {
+		stopped, err := r.stopReceiveAdapter(ctx, src, ra)
+		if err != nil || !stopped {
+			src.Status.MarkCleaningUp("Stopping", "Waiting for the receive adapter to stop.")
+			return false, err
+		}
 	}
-	if len(oldPodSpec.Containers) != len(newPodSpec.Containers) {
+
+	job := &batchv1.Job{}
+	err = r.client.Get(ctx, client.ObjectKey{Namespace: src.Namespace, Name: resources.CleanupJobName(src)}, job)
+	if apierrors.IsNotFound(err) {
+		job = resources.MakeCleanupJob(&resources.ReceiveAdapterArgs{
+			Defaults: r.config.Defaults(),
+			Source:   src,
+			Labels:   getCleanupLabels(src),
+			SinkURI:  src.Status.SinkURI,
+		})
+		if err := controllerutil.SetControllerReference(src, job, r.scheme); err != nil {
+			return false, err
+		}
+		if err := r.client.Create(ctx, job); err != nil {
+			return false, err
+		}
+		logging.FromContext(ctx).Desugar().Info("Cleanup Job created.", zap.String("name", job.Name))
+		r.recorder.Eventf(src, corev1.EventTypeNormal, cleanupStartedReason, "Created cleanup job %q.", job.Name)
+		src.Status.MarkCleaningUp("Running", "Deleting the AWS resources of the source.")
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+			return false, fmt.Errorf("cleanup job %s failed: %s", job.Name, cond.Message)
+		}
+	}
+	if job.Status.Succeeded > 0 {
+		return true, nil
+	}
+	src.Status.MarkCleaningUp("Running", "Deleting the AWS resources of the source.")
+	return false, nil
+}
+
+// specChanged reports whether an existing receive adapter differs from the expected one, either
+// in its number of replicas or in the hash of the pod template it was last updated with.
+func (r *reconciler) specChanged(ra *v1.Deployment, expected *v1.Deployment) bool {
+	if ra.Spec.Replicas == nil || *ra.Spec.Replicas != *expected.Spec.Replicas {
 		return true
 	}
-	for i := range newPodSpec.Containers {
-		if !equality.Semantic.DeepEqual(newPodSpec.Containers[i].Env, oldPodSpec.Containers[i].Env) {
-			return true
+	return ra.Annotations[resources.SpecHashAnnotation] != expected.Annotations[resources.SpecHashAnnotation]
+}
+
+// stopReceiveAdapter scales the receive adapter down to zero, keeping its pod template, and reports
+// whether all of its pods are gone.
+func (r *reconciler) stopReceiveAdapter(ctx context.Context, src *v1alpha1.KinesisSource, ra *v1.Deployment) (bool, error) {
+	if ra.Spec.Replicas == nil || *ra.Spec.Replicas != 0 {
+		replicas := int32(0)
+		ra.Spec.Replicas = &replicas
+		if err := r.client.Update(ctx, ra); err != nil {
+			return false, err
 		}
+		logging.FromContext(ctx).Desugar().Info("Receive Adapter stopped.", zap.String("name", ra.Name))
+		r.recorder.Eventf(src, corev1.EventTypeNormal, receiveAdapterStoppedReason, "Stopped receive adapter %q.", ra.Name)
+		return false, nil
+	}
+
+	// Terminating pods are no longer counted in the status of the Deployment, but may still
+	// be checkpointing, so the pods themselves are looked up.
+	pods, err := r.pods.List(src.Namespace, r.getLabelSelector(src))
+	if err != nil {
+		return false, err
 	}
-	return false
+	return len(pods) == 0, nil
 }
 
+// rolledOut reports whether the pods of the current pod template of the receive adapter are
+// available.
+func rolledOut(ra *v1.Deployment) bool {
+	if ra.Status.ObservedGeneration < ra.Generation {
+		return false
+	}
+	return ra.Status.UpdatedReplicas > 0 && ra.Status.AvailableReplicas > 0
+}
+
+// getReceiveAdapter returns the receive adapter Deployment controlled by the source. Only one
+// receive adapter may consume the stream, so when several are found, the one with the expected
+// name is kept, or else the oldest one is adopted, and the others are deleted.
 func (r *reconciler) getReceiveAdapter(ctx context.Context, src *v1alpha1.KinesisSource) (*v1.Deployment, error) {
 	dl := &v1.DeploymentList{}
 	err := r.client.List(ctx, &client.ListOptions{
@@ -217,12 +626,36 @@ func (r *reconciler) getReceiveAdapter(ctx context.Context, src *v1alpha1.Kinesi
 		logging.FromContext(ctx).Desugar().Error("Unable to list deployments: %v", zap.Error(err))
 		return nil, err
 	}
-	for _, dep := range dl.Items {
-		if metav1.IsControlledBy(&dep, src) {
-			return &dep, nil
+	var controlled []*v1.Deployment
+	for i := range dl.Items {
+		if metav1.IsControlledBy(&dl.Items[i], src) {
+			controlled = append(controlled, &dl.Items[i])
 		}
 	}
-	return nil, apierrors.NewNotFound(schema.GroupResource{}, "")
+	if len(controlled) == 0 {
+		return nil, apierrors.NewNotFound(schema.GroupResource{}, "")
+	}
+
+	name := resources.ReceiveAdapterName(src)
+	sort.Slice(controlled, func(i, j int) bool {
+		if (controlled[i].Name == name) != (controlled[j].Name == name) {
+			return controlled[i].Name == name
+		}
+		if !controlled[i].CreationTimestamp.Equal(&controlled[j].CreationTimestamp) {
+			return controlled[i].CreationTimestamp.Before(&controlled[j].CreationTimestamp)
+		}
+		return controlled[i].Name < controlled[j].Name
+	})
+
+	for _, dup := range controlled[1:] {
+		if err := r.client.Delete(ctx, dup); err != nil && !apierrors.IsNotFound(err) {
+			logging.FromContext(ctx).Desugar().Error("Unable to delete duplicate receive adapter", zap.String("name", dup.Name), zap.Error(err))
+			return nil, err
+		}
+		logging.FromContext(ctx).Desugar().Info("Duplicate receive adapter deleted.", zap.String("name", dup.Name))
+		r.recorder.Eventf(src, corev1.EventTypeNormal, duplicateReceiveAdapterDeletedReason, "Deleted duplicate receive adapter %q.", dup.Name)
+	}
+	return controlled[0], nil
 }
 
 func (r *reconciler) getLabelSelector(src *v1alpha1.KinesisSource) labels.Selector {
@@ -243,7 +676,14 @@ func (r *reconciler) removeFinalizer(s *v1alpha1.KinesisSource) {
 
 func getLabels(src *v1alpha1.KinesisSource) map[string]string {
 	return map[string]string{
-		"knative-eventing-source":      controllerAgentName,
-		"knative-eventing-source-name": src.Name,
+		sourceLabelKey:     controllerAgentName,
+		sourceNameLabelKey: src.Name,
+	}
+}
+
+func getCleanupLabels(src *v1alpha1.KinesisSource) map[string]string {
+	return map[string]string{
+		sourceLabelKey:  controllerAgentName,
+		cleanupLabelKey: src.Name,
 	}
 }
@@ -21,17 +21,24 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
-	sourcesv1alpha1 "github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	"github.com/google/go-cmp/cmp"
 	genericv1alpha1 "github.com/knative/eventing-sources/pkg/apis/sources/v1alpha1"
 	controllertesting "github.com/knative/eventing-sources/pkg/controller/testing"
 	duckv1alpha1 "github.com/knative/pkg/apis/duck/v1alpha1"
+	sourcesv1alpha1 "github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	"github.com/whynowy/knative-source-kinesis/pkg/reconciler/resources"
 	"k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -41,6 +48,8 @@ var (
 	deletionTime = metav1.Now().Rfc3339Copy()
 
 	trueVal = true
+
+	testConfig = &staticConfig{defaults: &resources.Defaults{Image: raImage, Mesh: sourcesv1alpha1.MeshIstio}}
 )
 
 const (
@@ -56,6 +65,8 @@ const (
 	addressableAPIVersion = "duck.knative.dev/v1alpha1"
 	addressableDNS        = "addressable.sink.svc.cluster.local"
 	addressableURI        = "http://addressable.sink.svc.cluster.local/"
+
+	externalSinkURI = "https://example.com/events"
 )
 
 func init() {
@@ -65,6 +76,9 @@ func init() {
 	sourcesv1alpha1.SchemeBuilder.AddToScheme(scheme.Scheme)
 	genericv1alpha1.SchemeBuilder.AddToScheme(scheme.Scheme)
 	duckv1alpha1.AddToScheme(scheme.Scheme)
+	// ServiceEntries are handled as unstructured objects.
+	scheme.Scheme.AddKnownTypeWithName(resources.ServiceEntryGVK, &unstructured.Unstructured{})
+	scheme.Scheme.AddKnownTypeWithName(resources.ServiceEntryGVK.GroupVersion().WithKind("ServiceEntryList"), &unstructured.UnstructuredList{})
 }
 
 func TestReconcile(t *testing.T) {
@@ -125,6 +139,42 @@ func TestReconcile(t *testing.T) {
 				getReadySource(),
 			},
 		},
+		{
+			Name: "successful create - absolute sink uri",
+			InitialState: []runtime.Object{
+				getSourceWithSinkURI(nil, externalSinkURI),
+			},
+			Reconciles: &sourcesv1alpha1.KinesisSource{},
+			WantPresent: []runtime.Object{
+				getReadySourceWithSinkURI(nil, externalSinkURI, externalSinkURI),
+			},
+		},
+		{
+			Name: "successful create - sink ref with relative uri",
+			InitialState: []runtime.Object{
+				getSourceWithSinkURI(getSource().Spec.Sink, "/events"),
+				getAddressable(),
+			},
+			WantPresent: []runtime.Object{
+				getReadySourceWithSinkURI(getSource().Spec.Sink, "/events", addressableURI+"events"),
+			},
+		},
+		{
+			Name: "invalid sink",
+			InitialState: []runtime.Object{
+				getSourceWithSinkURI(getSource().Spec.Sink, externalSinkURI),
+			},
+			WantPresent: []runtime.Object{
+				func() *sourcesv1alpha1.KinesisSource {
+					src := getSourceWithSinkURI(getSource().Spec.Sink, externalSinkURI)
+					src.Finalizers = []string{finalizerName}
+					src.Status.InitializeConditions()
+					src.Status.MarkNotDeployed("InvalidSpec", "%v", "sinkUri must be a relative reference when sink is set: spec.sinkUri")
+					return src
+				}(),
+			},
+			WantErrMsg: "sinkUri must be a relative reference when sink is set: spec.sinkUri",
+		},
 		{
 			Name: "deleting - remove finalizer",
 			InitialState: []runtime.Object{
@@ -143,7 +193,78 @@ func TestReconcile(t *testing.T) {
 			},
 			Mocks: controllertesting.Mocks{
 				MockCreates: []controllertesting.MockCreate{
-					func(_ client.Client, _ context.Context, _ runtime.Object) (controllertesting.MockHandled, error) {
+					func(_ client.Client, _ context.Context, obj runtime.Object) (controllertesting.MockHandled, error) {
+						if _, ok := obj.(*v1.Deployment); !ok {
+							return controllertesting.Unhandled, nil
+						}
+						return controllertesting.Handled, errors.New("an error that won't be seen because create is not called")
+					},
+				},
+			},
+			WantPresent: []runtime.Object{
+				getReadySource(),
+			},
+		},
+		{
+			Name: "successful create - up-to-date receive adapter is not updated",
+			InitialState: []runtime.Object{
+				getSource(),
+				getAddressable(),
+				getUpToDateReceiveAdapter(),
+			},
+			Mocks: controllertesting.Mocks{
+				MockUpdates: []controllertesting.MockUpdate{
+					func(_ client.Client, _ context.Context, obj runtime.Object) (controllertesting.MockHandled, error) {
+						if _, ok := obj.(*v1.Deployment); ok {
+							return controllertesting.Handled, errors.New("an error that won't be seen because update is not called")
+						}
+						return controllertesting.Unhandled, nil
+					},
+				},
+			},
+			WantPresent: []runtime.Object{
+				getReadySource(),
+			},
+		},
+		{
+			Name: "suspended - scale down receive adapter",
+			InitialState: []runtime.Object{
+				getSuspendedSource(),
+				getAddressable(),
+				getUpToDateReceiveAdapter(),
+			},
+			WantPresent: []runtime.Object{
+				func() *sourcesv1alpha1.KinesisSource {
+					src := getSuspendedSource()
+					src.Finalizers = []string{finalizerName}
+					src.Status.InitializeConditions()
+					src.Status.MarkSink(addressableURI)
+					src.Status.MarkDeployed()
+					src.Status.MarkSuspended()
+					return src
+				}(),
+				func() *v1.Deployment {
+					ra := getUpToDateReceiveAdapter()
+					zero := int32(0)
+					ra.Spec.Replicas = &zero
+					return ra
+				}(),
+			},
+		},
+		{
+			Name: "duplicate receive adapters - keep the one with the expected name",
+			InitialState: []runtime.Object{
+				getSource(),
+				getAddressable(),
+				getReceiveAdapterNamed("kinesis-test-kinesis-source-abcde", deletionTime),
+				getReceiveAdapterNamed("kinesis-test-kinesis-source", metav1.Now()),
+			},
+			Mocks: controllertesting.Mocks{
+				MockCreates: []controllertesting.MockCreate{
+					func(_ client.Client, _ context.Context, obj runtime.Object) (controllertesting.MockHandled, error) {
+						if _, ok := obj.(*v1.Deployment); !ok {
+							return controllertesting.Unhandled, nil
+						}
 						return controllertesting.Handled, errors.New("an error that won't be seen because create is not called")
 					},
 				},
@@ -151,6 +272,34 @@ func TestReconcile(t *testing.T) {
 			WantPresent: []runtime.Object{
 				getReadySource(),
 			},
+			WantAbsent: []runtime.Object{
+				getReceiveAdapterNamed("kinesis-test-kinesis-source-abcde", deletionTime),
+			},
+		},
+		{
+			Name: "duplicate receive adapters - adopt the oldest generated one",
+			InitialState: []runtime.Object{
+				getSource(),
+				getAddressable(),
+				getReceiveAdapterNamed("kinesis-test-kinesis-source-fghij", metav1.Now()),
+				getReceiveAdapterNamed("kinesis-test-kinesis-source-abcde", deletionTime),
+			},
+			Mocks: controllertesting.Mocks{
+				MockCreates: []controllertesting.MockCreate{
+					func(_ client.Client, _ context.Context, obj runtime.Object) (controllertesting.MockHandled, error) {
+						if _, ok := obj.(*v1.Deployment); !ok {
+							return controllertesting.Unhandled, nil
+						}
+						return controllertesting.Handled, errors.New("an error that won't be seen because create is not called")
+					},
+				},
+			},
+			WantPresent: []runtime.Object{
+				getReadySource(),
+			},
+			WantAbsent: []runtime.Object{
+				getReceiveAdapterNamed("kinesis-test-kinesis-source-fghij", metav1.Now()),
+			},
 		},
 	}
 	for _, tc := range testCases {
@@ -162,15 +311,472 @@ func TestReconcile(t *testing.T) {
 		tc.Scheme = scheme.Scheme
 		c := tc.GetClient()
 		r := &reconciler{
-			client:              c,
-			scheme:              tc.Scheme,
-			receiveAdapterImage: raImage,
+			client:      c,
+			scheme:      tc.Scheme,
+			config:      testConfig,
+			sinkTracker: &fakeTracker{},
+			pods:        clientPods{c},
+			recorder:    record.NewFakeRecorder(100),
 		}
 		r.InjectClient(c)
 		t.Run(tc.Name, tc.Runner(t, r, c))
 	}
 }
 
+func TestReconcileTracksSink(t *testing.T) {
+	src := getSource()
+	c := (&controllertesting.TestCase{InitialState: []runtime.Object{getAddressable()}}).GetClient()
+	ft := &fakeTracker{}
+	r := &reconciler{
+		client:      c,
+		scheme:      scheme.Scheme,
+		config:      testConfig,
+		sinkTracker: ft,
+		pods:        clientPods{c},
+		recorder:    record.NewFakeRecorder(100),
+	}
+
+	if err := r.Reconcile(context.TODO(), src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]corev1.ObjectReference{*src.Spec.Sink}, ft.refs[sourceName]); diff != "" {
+		t.Errorf("unexpected tracked refs (-want, +got) = %v", diff)
+	}
+
+	src.DeletionTimestamp = &deletionTime
+	if err := r.Reconcile(context.TODO(), src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := ft.refs[sourceName]; ok {
+		t.Errorf("expected sink to be untracked after deletion, got %v", ft.refs[sourceName])
+	}
+}
+
+func TestReconcilePreservesShards(t *testing.T) {
+	// The receive adapter reported a shard after the source was read for reconciling.
+	reported := getSource()
+	reported.Status.Shards = []sourcesv1alpha1.ShardStatus{{ShardID: "shardId-0", Checkpoint: "100"}}
+	c := (&controllertesting.TestCase{
+		InitialState: []runtime.Object{getAddressable(), reported},
+		Scheme:       scheme.Scheme,
+	}).GetClient()
+	r := &reconciler{
+		client:      c,
+		scheme:      scheme.Scheme,
+		config:      testConfig,
+		sinkTracker: &fakeTracker{},
+		pods:        clientPods{c},
+		recorder:    record.NewFakeRecorder(100),
+	}
+
+	src := getSource()
+	if err := r.Reconcile(context.TODO(), src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(reported.Status.Shards, src.Status.Shards); diff != "" {
+		t.Errorf("unexpected shards (-want, +got) = %v", diff)
+	}
+}
+
+func TestJoinSinkURI(t *testing.T) {
+	testCases := map[string]struct {
+		sinkURI  string
+		relative string
+		want     string
+	}{
+		"base with a trailing slash": {
+			sinkURI:  "http://addressable.sink.svc.cluster.local/",
+			relative: "/events",
+			want:     "http://addressable.sink.svc.cluster.local/events",
+		},
+		"base without a trailing slash": {
+			sinkURI:  "http://addressable.sink.svc.cluster.local/base",
+			relative: "events",
+			want:     "http://addressable.sink.svc.cluster.local/base/events",
+		},
+		"absolute path": {
+			sinkURI:  "http://addressable.sink.svc.cluster.local/base/",
+			relative: "/events/kinesis",
+			want:     "http://addressable.sink.svc.cluster.local/base/events/kinesis",
+		},
+		"query only": {
+			sinkURI:  "http://addressable.sink.svc.cluster.local/base?a=1",
+			relative: "?b=2",
+			want:     "http://addressable.sink.svc.cluster.local/base?b=2",
+		},
+		"path and fragment": {
+			sinkURI:  "http://addressable.sink.svc.cluster.local",
+			relative: "events#kinesis",
+			want:     "http://addressable.sink.svc.cluster.local/events#kinesis",
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			got, err := joinSinkURI(tc.sinkURI, tc.relative)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, but got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestReconcilePolicyViolation(t *testing.T) {
+	c := (&controllertesting.TestCase{
+		InitialState: []runtime.Object{getAddressable(), getUpToDateReceiveAdapter()},
+		Scheme:       scheme.Scheme,
+	}).GetClient()
+	config := &staticConfig{
+		defaults: testConfig.defaults,
+		policy:   policy{testNS: {CredentialModes: []string{credentialModeKIAM}}},
+	}
+	r := &reconciler{
+		client:      c,
+		scheme:      scheme.Scheme,
+		config:      config,
+		sinkTracker: &fakeTracker{},
+		pods:        clientPods{c},
+		recorder:    record.NewFakeRecorder(100),
+	}
+
+	src := getSource()
+	if err := r.Reconcile(context.TODO(), src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c := src.Status.GetCondition(sourcesv1alpha1.KinesisSourceConditionPolicyViolation); !c.IsTrue() {
+		t.Errorf("expected policy violation condition to be true, but got %v", c)
+	}
+	if src.Status.IsReady() {
+		t.Error("expected a source violating the policy not to be ready")
+	}
+	ra := &v1.Deployment{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Namespace: testNS, Name: getUpToDateReceiveAdapter().Name}, ra); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ra.Spec.Replicas == nil || *ra.Spec.Replicas != 0 {
+		t.Errorf("expected the receive adapter to be stopped, but got %v replicas", ra.Spec.Replicas)
+	}
+
+	// Once the policy allows the source, its receive adapter is started again.
+	config.policy[testNS].CredentialModes = append(config.policy[testNS].CredentialModes, credentialModeSecret)
+	if err := r.Reconcile(context.TODO(), src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c := src.Status.GetCondition(sourcesv1alpha1.KinesisSourceConditionPolicyViolation); !c.IsFalse() {
+		t.Errorf("expected policy violation condition to be false, but got %v", c)
+	}
+	if err := c.Get(context.TODO(), client.ObjectKey{Namespace: testNS, Name: getUpToDateReceiveAdapter().Name}, ra); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ra.Spec.Replicas == nil || *ra.Spec.Replicas != 1 {
+		t.Errorf("expected the receive adapter to be started, but got %v replicas", ra.Spec.Replicas)
+	}
+}
+
+func TestReconcileReplay(t *testing.T) {
+	pod := getReceiveAdapterPod()
+	c := (&controllertesting.TestCase{
+		InitialState: []runtime.Object{getAddressable(), getUpToDateReceiveAdapter(), pod},
+		Scheme:       scheme.Scheme,
+	}).GetClient()
+	r := &reconciler{
+		client:      c,
+		scheme:      scheme.Scheme,
+		config:      testConfig,
+		sinkTracker: &fakeTracker{},
+		pods:        clientPods{c},
+		recorder:    record.NewFakeRecorder(100),
+	}
+
+	src := getSource()
+	src.Spec.Replay = &sourcesv1alpha1.ReplaySpec{Token: "rewind-1", TrimHorizon: true}
+	key := client.ObjectKey{Namespace: testNS, Name: resources.ReceiveAdapterName(src)}
+
+	reconcile := func(wantReason string) *v1.Deployment {
+		t.Helper()
+		if err := r.Reconcile(context.TODO(), src); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cond := src.Status.GetCondition(sourcesv1alpha1.KinesisSourceConditionReplayed)
+		if cond == nil || cond.Reason != wantReason {
+			t.Fatalf("expected replay condition with reason %q, got %+v", wantReason, cond)
+		}
+		ra := &v1.Deployment{}
+		if err := c.Get(context.TODO(), key, ra); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return ra
+	}
+
+	// The receive adapter is scaled down first, with its pod template unchanged.
+	ra := reconcile("Stopping")
+	if *ra.Spec.Replicas != 0 {
+		t.Errorf("expected the receive adapter to be scaled down, got %d replicas", *ra.Spec.Replicas)
+	}
+	if _, ok := ra.Annotations[resources.ReplayTokenAnnotation]; ok {
+		t.Errorf("expected the receive adapter not to carry out the replay while stopping")
+	}
+
+	// It is not restarted while its pod is still running.
+	ra = reconcile("Stopping")
+	if _, ok := ra.Annotations[resources.ReplayTokenAnnotation]; ok {
+		t.Errorf("expected the receive adapter not to carry out the replay while stopping")
+	}
+
+	if err := c.Delete(context.TODO(), pod); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ra = reconcile("Restarting")
+	if *ra.Spec.Replicas != 1 {
+		t.Errorf("expected the receive adapter to be scaled up, got %d replicas", *ra.Spec.Replicas)
+	}
+	if token := ra.Annotations[resources.ReplayTokenAnnotation]; token != "rewind-1" {
+		t.Errorf("expected replay token %q, got %q", "rewind-1", token)
+	}
+
+	ra.Status.UpdatedReplicas = 1
+	ra.Status.AvailableReplicas = 1
+	if err := c.Update(context.TODO(), ra); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reconcile("")
+	if src.Status.Replay == nil || src.Status.Replay.Token != "rewind-1" {
+		t.Errorf("expected the replay to be recorded, got %+v", src.Status.Replay)
+	}
+	if src.ReplayPending() {
+		t.Errorf("expected no pending replay")
+	}
+}
+
+func TestReconcileCleanup(t *testing.T) {
+	pod := getReceiveAdapterPod()
+	c := (&controllertesting.TestCase{
+		InitialState: []runtime.Object{getUpToDateReceiveAdapter(), pod},
+		Scheme:       scheme.Scheme,
+	}).GetClient()
+	r := &reconciler{
+		client:      c,
+		scheme:      scheme.Scheme,
+		config:      testConfig,
+		sinkTracker: &fakeTracker{},
+		pods:        clientPods{c},
+		recorder:    record.NewFakeRecorder(100),
+	}
+
+	src := getDeletingSource()
+	src.Spec.DeletionPolicy = sourcesv1alpha1.DeletionPolicyDelete
+	now := metav1.Now()
+	src.DeletionTimestamp = &now
+	jobKey := client.ObjectKey{Namespace: testNS, Name: resources.CleanupJobName(src)}
+
+	reconcile := func(wantStatus corev1.ConditionStatus, wantReason string) {
+		t.Helper()
+		if err := r.Reconcile(context.TODO(), src); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cond := src.Status.GetCondition(sourcesv1alpha1.KinesisSourceConditionCleanedUp)
+		if cond == nil || cond.Status != wantStatus || cond.Reason != wantReason {
+			t.Fatalf("expected cleanup condition %s with reason %q, got %+v", wantStatus, wantReason, cond)
+		}
+	}
+
+	// The receive adapter is stopped before cleaning up.
+	reconcile(corev1.ConditionUnknown, "Stopping")
+	reconcile(corev1.ConditionUnknown, "Stopping")
+	if err := c.Get(context.TODO(), jobKey, &batchv1.Job{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected no cleanup job while the receive adapter is running, got %v", err)
+	}
+
+	if err := c.Delete(context.TODO(), pod); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reconcile(corev1.ConditionUnknown, "Running")
+	job := &batchv1.Job{}
+	if err := c.Get(context.TODO(), jobKey, job); err != nil {
+		t.Fatalf("expected a cleanup job, got %v", err)
+	}
+	if len(src.Finalizers) == 0 {
+		t.Errorf("expected the finalizer to be kept while cleaning up")
+	}
+
+	job.Status.Succeeded = 1
+	if err := c.Update(context.TODO(), job); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reconcile(corev1.ConditionTrue, "")
+	if len(src.Finalizers) != 0 {
+		t.Errorf("expected the finalizer to be removed, got %v", src.Finalizers)
+	}
+}
+
+func TestReconcileCleanupFailure(t *testing.T) {
+	src := getDeletingSource()
+	src.Spec.DeletionPolicy = sourcesv1alpha1.DeletionPolicyDelete
+	job := resources.MakeCleanupJob(&resources.ReceiveAdapterArgs{
+		Defaults: testConfig.Defaults(),
+		Source:   src,
+		Labels:   getCleanupLabels(src),
+	})
+	job.TypeMeta = metav1.TypeMeta{APIVersion: batchv1.SchemeGroupVersion.String(), Kind: "Job"}
+	job.Status.Conditions = []batchv1.JobCondition{{
+		Type:    batchv1.JobFailed,
+		Status:  corev1.ConditionTrue,
+		Message: "Job has reached the specified backoff limit",
+	}}
+	c := (&controllertesting.TestCase{
+		InitialState: []runtime.Object{job},
+		Scheme:       scheme.Scheme,
+	}).GetClient()
+	r := &reconciler{
+		client:      c,
+		scheme:      scheme.Scheme,
+		config:      testConfig,
+		sinkTracker: &fakeTracker{},
+		pods:        clientPods{c},
+		recorder:    record.NewFakeRecorder(100),
+	}
+
+	// A recent deletion waits for the cleanup to be retried.
+	now := metav1.Now()
+	src.DeletionTimestamp = &now
+	if err := r.Reconcile(context.TODO(), src); err == nil {
+		t.Errorf("expected an error")
+	}
+	cond := src.Status.GetCondition(sourcesv1alpha1.KinesisSourceConditionCleanedUp)
+	if cond == nil || cond.Status != corev1.ConditionFalse || cond.Reason != "CleanupFailed" {
+		t.Errorf("expected a failed cleanup condition, got %+v", cond)
+	}
+	if len(src.Finalizers) == 0 {
+		t.Errorf("expected the finalizer to be kept")
+	}
+
+	// The cleanup is given up once it timed out.
+	expired := metav1.NewTime(time.Now().Add(-cleanupTimeout - time.Minute))
+	src.DeletionTimestamp = &expired
+	if err := r.Reconcile(context.TODO(), src); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(src.Finalizers) != 0 {
+		t.Errorf("expected the finalizer to be removed, got %v", src.Finalizers)
+	}
+}
+
+func TestReconcileEvents(t *testing.T) {
+	testCases := map[string]struct {
+		initialState []runtime.Object
+		src          *sourcesv1alpha1.KinesisSource
+		want         []string
+	}{
+		"receive adapter created": {
+			initialState: []runtime.Object{getAddressable()},
+			src:          getSource(),
+			want:         []string{`Normal ReceiveAdapterCreated Created receive adapter "kinesis-test-kinesis-source".`},
+		},
+		"receive adapter updated": {
+			initialState: []runtime.Object{getAddressable(), getUpToDateReceiveAdapter()},
+			src:          getSuspendedSource(),
+			want:         []string{`Normal ReceiveAdapterUpdated Updated receive adapter "kinesis-test-kinesis-source".`},
+		},
+		"up-to-date receive adapter": {
+			initialState: []runtime.Object{getAddressable(), getUpToDateReceiveAdapter()},
+			src:          getSource(),
+		},
+		"sink not found": {
+			src:  getSource(),
+			want: []string{`Warning SinkNotFound Unable to resolve the sink: sinks.duck.knative.dev "testsink" not found`},
+		},
+		"invalid spec": {
+			src:  getSourceWithSinkURI(nil, ""),
+			want: []string{`Warning InvalidSpec Invalid spec: expected exactly one, got neither: spec.sink, spec.sinkUri`},
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			c := (&controllertesting.TestCase{InitialState: tc.initialState, Scheme: scheme.Scheme}).GetClient()
+			recorder := record.NewFakeRecorder(10)
+			r := &reconciler{
+				client:      c,
+				scheme:      scheme.Scheme,
+				config:      testConfig,
+				sinkTracker: &fakeTracker{},
+				pods:        clientPods{c},
+				recorder:    recorder,
+			}
+
+			r.Reconcile(context.TODO(), tc.src)
+
+			close(recorder.Events)
+			var got []string
+			for event := range recorder.Events {
+				got = append(got, event)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected events (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
+
+// fakeTracker records the references tracked for each source by name.
+// staticConfig is a configStore holding fixed defaults and policy.
+type staticConfig struct {
+	defaults *resources.Defaults
+	policy   policy
+}
+
+func (c *staticConfig) Defaults() *resources.Defaults {
+	return c.defaults
+}
+
+func (c *staticConfig) Policy() policy {
+	return c.policy
+}
+
+type fakeTracker struct {
+	refs map[string][]corev1.ObjectReference
+}
+
+func (t *fakeTracker) Track(src *sourcesv1alpha1.KinesisSource, refs ...corev1.ObjectReference) error {
+	if t.refs == nil {
+		t.refs = make(map[string][]corev1.ObjectReference)
+	}
+	t.refs[src.Name] = refs
+	return nil
+}
+
+func (t *fakeTracker) Untrack(src *sourcesv1alpha1.KinesisSource) {
+	delete(t.refs, src.Name)
+}
+
+// clientPods lists the pods from the fake client.
+type clientPods struct {
+	client client.Client
+}
+
+func (p clientPods) List(namespace string, selector labels.Selector) ([]*corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	err := p.client.List(context.TODO(), &client.ListOptions{
+		Namespace:     namespace,
+		LabelSelector: selector,
+		Raw: &metav1.ListOptions{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: corev1.SchemeGroupVersion.String(),
+				Kind:       "Pod",
+			},
+		},
+	}, pods)
+	if err != nil {
+		return nil, err
+	}
+	var items []*corev1.Pod
+	for i := range pods.Items {
+		items = append(items, &pods.Items[i])
+	}
+	return items, nil
+}
+
 func getSource() *sourcesv1alpha1.KinesisSource {
 	obj := &sourcesv1alpha1.KinesisSource{
 		TypeMeta: metav1.TypeMeta{
@@ -204,6 +810,12 @@ func getSource() *sourcesv1alpha1.KinesisSource {
 	return obj
 }
 
+func getSuspendedSource() *sourcesv1alpha1.KinesisSource {
+	src := getSource()
+	src.Spec.Suspend = true
+	return src
+}
+
 func getDeletingSourceWithoutFinalizer() *sourcesv1alpha1.KinesisSource {
 	src := getSource()
 	src.DeletionTimestamp = &deletionTime
@@ -241,6 +853,22 @@ func getReadySource() *sourcesv1alpha1.KinesisSource {
 	return src
 }
 
+func getSourceWithSinkURI(sink *corev1.ObjectReference, sinkURI string) *sourcesv1alpha1.KinesisSource {
+	src := getSource()
+	src.Spec.Sink = sink
+	src.Spec.SinkURI = sinkURI
+	return src
+}
+
+func getReadySourceWithSinkURI(sink *corev1.ObjectReference, sinkURI, resolvedURI string) *sourcesv1alpha1.KinesisSource {
+	src := getSourceWithSinkURI(sink, sinkURI)
+	src.Finalizers = []string{finalizerName}
+	src.Status.InitializeConditions()
+	src.Status.MarkSink(resolvedURI)
+	src.Status.MarkDeployed()
+	return src
+}
+
 func om(namespace, name string) metav1.ObjectMeta {
 	return metav1.ObjectMeta{
 		Namespace: namespace,
@@ -286,3 +914,36 @@ func getReceiveAdapter() *v1.Deployment {
 		},
 	}
 }
+
+func getReceiveAdapterNamed(name string, created metav1.Time) *v1.Deployment {
+	ra := getReceiveAdapter()
+	ra.Name = name
+	ra.CreationTimestamp = created
+	return ra
+}
+
+func getUpToDateReceiveAdapter() *v1.Deployment {
+	ra := resources.MakeReceiveAdapter(&resources.ReceiveAdapterArgs{
+		Defaults: testConfig.Defaults(),
+		Source:   getSource(),
+		Labels:   getLabels(getSource()),
+		SinkURI:  addressableURI,
+	})
+	ra.TypeMeta = getReceiveAdapter().TypeMeta
+	ra.OwnerReferences = getReceiveAdapter().OwnerReferences
+	return ra
+}
+
+func getReceiveAdapterPod() *corev1.Pod {
+	return &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNS,
+			Name:      "kinesis-test-kinesis-source-abcde",
+			Labels:    getLabels(getSource()),
+		},
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"fmt"
+
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// podLister lists the receive adapter pods, terminating ones included.
+type podLister interface {
+	// List returns the receive adapter pods of the given namespace matching the selector.
+	List(namespace string, selector labels.Selector) ([]*corev1.Pod, error)
+}
+
+// podWatcher watches the receive adapter pods only, selected by their labels, so that the
+// controller does not cache every pod it can see. Any change to a pod is sent to the controller
+// as a GenericEvent for the source it consumes the stream for.
+type podWatcher struct {
+	events   chan<- event.GenericEvent
+	indexer  cache.Indexer
+	informer cache.Controller
+}
+
+var _ podLister = (*podWatcher)(nil)
+
+func newPodWatcher(kube kubernetes.Interface, namespace string, events chan<- event.GenericEvent) *podWatcher {
+	w := &podWatcher{events: events}
+	selector := labels.SelectorFromSet(labels.Set{sourceLabelKey: controllerAgentName}).String()
+	lw := &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			opts.LabelSelector = selector
+			return kube.CoreV1().Pods(namespace).List(opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			opts.LabelSelector = selector
+			return kube.CoreV1().Pods(namespace).Watch(opts)
+		},
+	}
+	w.indexer, w.informer = cache.NewIndexerInformer(lw, &corev1.Pod{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc:    w.notify,
+		UpdateFunc: func(_, obj interface{}) { w.notify(obj) },
+		DeleteFunc: w.notify,
+	}, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	return w
+}
+
+// Start watches the pods until the stop channel is closed. It implements manager.Runnable.
+func (w *podWatcher) Start(stopCh <-chan struct{}) error {
+	w.informer.Run(stopCh)
+	return nil
+}
+
+// List implements podLister. It fails until the pods are synced, rather than reporting none.
+func (w *podWatcher) List(namespace string, selector labels.Selector) ([]*corev1.Pod, error) {
+	if !w.informer.HasSynced() {
+		return nil, fmt.Errorf("receive adapter pods are not synced yet")
+	}
+	var pods []*corev1.Pod
+	err := cache.ListAllByNamespace(w.indexer, namespace, selector, func(obj interface{}) {
+		pods = append(pods, obj.(*corev1.Pod))
+	})
+	return pods, err
+}
+
+// notify enqueues the source the given pod consumes the stream for.
+// The event is sent from another goroutine, so that the informer calling it is not blocked
+// until the controller received it.
+func (w *podWatcher) notify(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	name := pod.Labels[sourceNameLabelKey]
+	if name == "" {
+		return
+	}
+	src := &v1alpha1.KinesisSource{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: pod.Namespace,
+			Name:      name,
+		},
+	}
+	go func() {
+		w.events <- event.GenericEvent{Meta: src, Object: src}
+	}()
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestPodWatcherNotify(t *testing.T) {
+	events := make(chan event.GenericEvent, 10)
+	w := newPodWatcher(nil, testNS, events)
+
+	pod := getReceiveAdapterPod()
+	w.notify(pod)
+	expectEnqueued(t, events, testNS, sourceName)
+
+	w.notify(cache.DeletedFinalStateUnknown{Key: testNS + "/" + pod.Name, Obj: pod})
+	expectEnqueued(t, events, testNS, sourceName)
+
+	unlabelled := getReceiveAdapterPod()
+	delete(unlabelled.Labels, sourceNameLabelKey)
+	w.notify(unlabelled)
+	w.notify(&corev1.ConfigMap{})
+	select {
+	case evt := <-events:
+		t.Errorf("expected no source to be enqueued, got %v", evt.Meta)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPodWatcherListNotSynced(t *testing.T) {
+	w := newPodWatcher(nil, testNS, make(chan event.GenericEvent))
+
+	// Reporting no pods before they are synced would restart a stopping receive adapter.
+	if _, err := w.List(testNS, labels.Everything()); err == nil {
+		t.Error("expected an error listing the pods before they are synced")
+	}
+}
@@ -0,0 +1,324 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+
+	"github.com/ghodss/yaml"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	// policyConfigName is the name of the ConfigMap holding the policy of the sources, in the
+	// namespace of the controller.
+	policyConfigName = "config-kinesis-source-policy"
+
+	// defaultPolicyKey is the key of the policy of the namespaces without one of their own.
+	defaultPolicyKey = "_default"
+)
+
+// Credential modes of the sources.
+const (
+	credentialModeSecret = "secret"
+	credentialModeKIAM   = "kiam"
+)
+
+// namespacePolicy is what the sources of a namespace may use. Patterns are matched against the
+// whole value, and * matches any sequence of characters. An omitted list does not restrict
+// anything.
+type namespacePolicy struct {
+	// StreamARNs are the patterns of the ARNs of the streams the sources may consume.
+	StreamARNs []string `json:"streamArns,omitempty"`
+
+	// IAMRoles are the patterns of the IAM roles the sources may use with KIAM, both the one
+	// assigned to the receive adapter and the one it assumes.
+	IAMRoles []string `json:"iamRoles,omitempty"`
+
+	// CredentialModes are the ways the sources may get their AWS credentials: secret or kiam.
+	CredentialModes []string `json:"credentialModes,omitempty"`
+
+	streamARNs []*regexp.Regexp
+	// anyAccountStreamARNs are the StreamARNs matching any account, for the streams whose
+	// account is unknown.
+	anyAccountStreamARNs []*regexp.Regexp
+	iamRoles             []*regexp.Regexp
+}
+
+// policy maps namespaces to what their sources may use. An empty policy does not restrict
+// anything, otherwise the sources of a namespace without a policy of its own, nor a default one,
+// are rejected.
+type policy map[string]*namespacePolicy
+
+// newPolicy parses the data of the config-kinesis-source-policy ConfigMap, which holds the YAML
+// policy of every namespace under its name.
+func newPolicy(data map[string]string) (policy, error) {
+	p := make(policy, len(data))
+	for namespace, v := range data {
+		np := &namespacePolicy{}
+		if err := yaml.Unmarshal([]byte(v), np); err != nil {
+			return nil, fmt.Errorf("invalid policy of %q: %v", namespace, err)
+		}
+		for _, mode := range np.CredentialModes {
+			if mode != credentialModeSecret && mode != credentialModeKIAM {
+				return nil, fmt.Errorf("invalid credential mode %q in the policy of %q", mode, namespace)
+			}
+		}
+		np.streamARNs = compilePatterns(np.StreamARNs)
+		np.anyAccountStreamARNs = compilePatterns(anyAccountARNs(np.StreamARNs))
+		np.iamRoles = compilePatterns(np.IAMRoles)
+		p[namespace] = np
+	}
+	return p, nil
+}
+
+func compilePatterns(patterns []string) []*regexp.Regexp {
+	if patterns == nil {
+		return nil
+	}
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		// Quoting makes the expression valid.
+		expr := strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1)
+		res = append(res, regexp.MustCompile("^"+expr+"$"))
+	}
+	return res
+}
+
+// check returns an error describing why the policy forbids the source, or nil if it allows it.
+func (p policy) check(src *v1alpha1.KinesisSource) error {
+	if len(p) == 0 {
+		return nil
+	}
+	np, ok := p[src.Namespace]
+	if !ok {
+		if np, ok = p[defaultPolicyKey]; !ok {
+			return fmt.Errorf("no policy allows sources in namespace %q", src.Namespace)
+		}
+	}
+
+	mode := credentialMode(src)
+	if np.CredentialModes != nil && !contains(np.CredentialModes, mode) {
+		return fmt.Errorf("credential mode %q is not allowed", mode)
+	}
+
+	if np.streamARNs != nil {
+		arn, accountKnown := streamARN(src)
+		patterns := np.streamARNs
+		if !accountKnown {
+			patterns = np.anyAccountStreamARNs
+		}
+		if !matchesAny(patterns, arn) {
+			return fmt.Errorf("stream %q is not allowed", arn)
+		}
+	}
+
+	if np.iamRoles != nil {
+		var roles []string
+		if mode == credentialModeKIAM {
+			roles = append(roles, src.Spec.KIAMOptions.AssignedIAMRole, src.Spec.KIAMOptions.KCLIAMRoleARN)
+		}
+		// The template may not provide credentials, its roles are checked all the same.
+		roles = append(roles, templateRoles(src)...)
+		for _, role := range roles {
+			if role != "" && !matchesAny(np.iamRoles, role) {
+				return fmt.Errorf("IAM role %q is not allowed", role)
+			}
+		}
+	}
+	return nil
+}
+
+// templateRoles returns the IAM roles the template of a source sets, in the KIAM annotation or
+// the environment variable of the role the receive adapter assumes.
+func templateRoles(src *v1alpha1.KinesisSource) []string {
+	if src.Spec.Template == nil {
+		return nil
+	}
+	var roles []string
+	if role, ok := src.Spec.Template.Metadata.Annotations[v1alpha1.IAMRoleAnnotation]; ok {
+		roles = append(roles, role)
+	}
+	for _, env := range src.Spec.Template.Spec.Env {
+		if env.Name == "KCL_IAM_ROLE_ARN" {
+			roles = append(roles, env.Value)
+		}
+	}
+	return roles
+}
+
+// credentialMode returns how the receive adapter of a source gets its AWS credentials, as
+// decided by resources.MakeReceiveAdapter.
+func credentialMode(src *v1alpha1.KinesisSource) string {
+	if len(src.Spec.AwsCredsSecret.Name) > 0 && len(src.Spec.AwsCredsSecret.Key) > 0 {
+		return credentialModeSecret
+	}
+	return credentialModeKIAM
+}
+
+// streamARN returns the ARN of the stream of a source, and whether its account is known. The
+// account is the one of the IAM role assumed with KIAM, and * when the credentials come from a
+// secret, whose account is unknown.
+func streamARN(src *v1alpha1.KinesisSource) (string, bool) {
+	account := "*"
+	if credentialMode(src) == credentialModeKIAM {
+		// arn:partition:iam::account:role/name
+		if parts := strings.SplitN(src.Spec.KIAMOptions.KCLIAMRoleARN, ":", 6); len(parts) == 6 && parts[4] != "" {
+			account = parts[4]
+		}
+	}
+	return fmt.Sprintf("arn:%s:kinesis:%s:%s:stream/%s", partition(src.Spec.Region), src.Spec.Region, account, src.Spec.StreamName), account != "*"
+}
+
+// anyAccountARNs returns the given ARN patterns with * as their account.
+func anyAccountARNs(patterns []string) []string {
+	if patterns == nil {
+		return nil
+	}
+	res := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		// arn:partition:service:region:account:resource
+		if parts := strings.SplitN(pattern, ":", 6); len(parts) == 6 {
+			parts[4] = "*"
+			pattern = strings.Join(parts, ":")
+		}
+		res = append(res, pattern)
+	}
+	return res
+}
+
+// partition returns the AWS partition of a region.
+func partition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	}
+	return "aws"
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// policyWatcher watches the config-kinesis-source-policy ConfigMap. When given an events channel,
+// every source is sent to the controller as a GenericEvent whenever the policy changes. An invalid
+// ConfigMap is ignored, and the previous policy is kept.
+type policyWatcher struct {
+	kube      kubernetes.Interface
+	namespace string
+	events    chan<- event.GenericEvent
+	logger    *zap.SugaredLogger
+
+	// client lists the sources to reconcile again.
+	client client.Client
+
+	mu     sync.RWMutex
+	policy policy
+}
+
+func newPolicyWatcher(kube kubernetes.Interface, namespace string, events chan<- event.GenericEvent, logger *zap.SugaredLogger) *policyWatcher {
+	return &policyWatcher{
+		kube:      kube,
+		namespace: namespace,
+		events:    events,
+		logger:    logger,
+	}
+}
+
+// InjectClient is called by the Manager to provide the client listing the sources.
+func (w *policyWatcher) InjectClient(c client.Client) error {
+	w.client = c
+	return nil
+}
+
+// Policy returns the current policy.
+func (w *policyWatcher) Policy() policy {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.policy
+}
+
+// load reads the current policy. Unlike an update, it fails on an invalid ConfigMap rather than
+// leaving the sources unrestricted.
+func (w *policyWatcher) load() error {
+	cm, err := w.kube.CoreV1().ConfigMaps(w.namespace).Get(policyConfigName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p, err := newPolicy(cm.Data)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", policyConfigName, err)
+	}
+	w.mu.Lock()
+	w.policy = p
+	w.mu.Unlock()
+	return nil
+}
+
+// Start watches the ConfigMap until the stop channel is closed. It implements manager.Runnable.
+func (w *policyWatcher) Start(stopCh <-chan struct{}) error {
+	watchConfigMap(w.kube, w.namespace, policyConfigName, w.update, stopCh)
+	return nil
+}
+
+// update replaces the policy with the one of the given ConfigMap data, and reconciles every source
+// again.
+func (w *policyWatcher) update(data map[string]string) {
+	p, err := newPolicy(data)
+	if err != nil {
+		w.logger.Errorw("Ignoring invalid "+policyConfigName, zap.Error(err))
+		return
+	}
+
+	w.mu.Lock()
+	w.policy = p
+	w.mu.Unlock()
+	w.logger.Infow("Updated the source policy", zap.Int("namespaces", len(p)))
+
+	if w.events != nil {
+		enqueueSources(w.client, w.events, w.logger)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"testing"
+
+	sourcesv1alpha1 "github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNewPolicy(t *testing.T) {
+	testCases := map[string]struct {
+		data    map[string]string
+		wantErr bool
+	}{
+		"empty": {},
+		"valid": {
+			data: map[string]string{
+				testNS:           "streamArns: [\"arn:aws:kinesis:*:123456789012:stream/team-a-*\"]\ncredentialModes: [kiam]",
+				defaultPolicyKey: "credentialModes: [secret]",
+			},
+		},
+		"invalid yaml": {
+			data:    map[string]string{testNS: "streamArns: {"},
+			wantErr: true,
+		},
+		"unknown credential mode": {
+			data:    map[string]string{testNS: "credentialModes: [irsa]"},
+			wantErr: true,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			_, err := newPolicy(tc.data)
+			if tc.wantErr != (err != nil) {
+				t.Errorf("expected error %v, but got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	kiamSource := func(assigned, assumed string) *sourcesv1alpha1.KinesisSource {
+		src := getSource()
+		src.Spec.AwsCredsSecret.Name = ""
+		src.Spec.KIAMOptions.AssignedIAMRole = assigned
+		src.Spec.KIAMOptions.KCLIAMRoleARN = assumed
+		return src
+	}
+	templateRole := func(src *sourcesv1alpha1.KinesisSource, role string) *sourcesv1alpha1.KinesisSource {
+		src.Spec.Template = &sourcesv1alpha1.ReceiveAdapterTemplate{
+			Metadata: sourcesv1alpha1.ReceiveAdapterMetadata{
+				Annotations: map[string]string{sourcesv1alpha1.IAMRoleAnnotation: role},
+			},
+			Spec: sourcesv1alpha1.ReceiveAdapterPodSpec{
+				Env: []corev1.EnvVar{{Name: "KCL_IAM_ROLE_ARN", Value: role}},
+			},
+		}
+		return src
+	}
+	teamA := "streamArns: [\"arn:aws:kinesis:us-west-2:123456789012:stream/kinesis-*\"]\n" +
+		"iamRoles: [\"arn:aws:iam::123456789012:role/team-a-*\"]\n" +
+		"credentialModes: [kiam]"
+
+	testCases := map[string]struct {
+		data    map[string]string
+		src     *sourcesv1alpha1.KinesisSource
+		wantErr string
+	}{
+		"no policy": {
+			src: getSource(),
+		},
+		"namespace without policy": {
+			data:    map[string]string{"other": "{}"},
+			src:     getSource(),
+			wantErr: `no policy allows sources in namespace "testnamespace"`,
+		},
+		"default policy": {
+			data: map[string]string{"other": "{}", defaultPolicyKey: "credentialModes: [secret]"},
+			src:  getSource(),
+		},
+		"allowed": {
+			data: map[string]string{testNS: teamA},
+			src:  kiamSource("arn:aws:iam::123456789012:role/team-a-node", "arn:aws:iam::123456789012:role/team-a-kinesis"),
+		},
+		"credential mode not allowed": {
+			data:    map[string]string{testNS: teamA},
+			src:     getSource(),
+			wantErr: `credential mode "secret" is not allowed`,
+		},
+		"stream of another account": {
+			data:    map[string]string{testNS: teamA},
+			src:     kiamSource("arn:aws:iam::123456789012:role/team-a-node", "arn:aws:iam::210987654321:role/team-a-kinesis"),
+			wantErr: `stream "arn:aws:kinesis:us-west-2:210987654321:stream/kinesis-name" is not allowed`,
+		},
+		"assigned role not allowed": {
+			data:    map[string]string{testNS: teamA},
+			src:     kiamSource("arn:aws:iam::123456789012:role/admin", "arn:aws:iam::123456789012:role/team-a-kinesis"),
+			wantErr: `IAM role "arn:aws:iam::123456789012:role/admin" is not allowed`,
+		},
+		"template role with a secret": {
+			data:    map[string]string{testNS: "iamRoles: [\"arn:aws:iam::123456789012:role/team-a-*\"]"},
+			src:     templateRole(getSource(), "arn:aws:iam::123456789012:role/admin"),
+			wantErr: `IAM role "arn:aws:iam::123456789012:role/admin" is not allowed`,
+		},
+		"template role with KIAM": {
+			data:    map[string]string{testNS: teamA},
+			src:     templateRole(kiamSource("arn:aws:iam::123456789012:role/team-a-node", "arn:aws:iam::123456789012:role/team-a-kinesis"), "arn:aws:iam::123456789012:role/admin"),
+			wantErr: `IAM role "arn:aws:iam::123456789012:role/admin" is not allowed`,
+		},
+		"secret with unknown account": {
+			data: map[string]string{testNS: "streamArns: [\"arn:aws:kinesis:us-west-2:*:stream/kinesis-name\"]"},
+			src:  getSource(),
+		},
+		"secret with an account pattern": {
+			data: map[string]string{testNS: "streamArns: [\"arn:aws:kinesis:us-west-2:123456789012:stream/kinesis-*\"]"},
+			src:  getSource(),
+		},
+		"secret with a stream not allowed": {
+			data:    map[string]string{testNS: "streamArns: [\"arn:aws:kinesis:us-west-2:123456789012:stream/other\"]"},
+			src:     getSource(),
+			wantErr: `stream "arn:aws:kinesis:us-west-2:*:stream/kinesis-name" is not allowed`,
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			p, err := newPolicy(tc.data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = p.check(tc.src)
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr) {
+				t.Errorf("expected error %q, but got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
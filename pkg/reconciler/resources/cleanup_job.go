@@ -0,0 +1,73 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// cleanupBackoffLimit is the number of retries of a failing cleanup.
+	cleanupBackoffLimit = 3
+
+	// cleanupDeadlineSeconds bounds the duration of a cleanup, including its retries.
+	cleanupDeadlineSeconds = 300
+)
+
+// CleanupJobName returns the name of the Job deleting the AWS resources of a deleted Kinesis
+// Source.
+func CleanupJobName(src *v1alpha1.KinesisSource) string {
+	return boundedName(fmt.Sprintf("kinesis-%s-cleanup", src.Name), src.Name)
+}
+
+// MakeCleanupJob generates (but does not insert into K8s) the Job deleting the AWS resources of a
+// deleted Kinesis Source. It runs the Receive Adapter image in cleanup mode, with the same AWS
+// credentials as the Receive Adapter.
+func MakeCleanupJob(args *ReceiveAdapterArgs) *batchv1.Job {
+	template := makeDeploymentSpec(args).Template
+
+	// A proxy would keep the pod running once the cleanup is done.
+	for k, v := range meshFor(ResolveMesh(args.Defaults, args.Source)).jobAnnotations() {
+		template.Annotations[k] = v
+	}
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	template.Spec.Containers[0].Env = append(template.Spec.Containers[0].Env, corev1.EnvVar{
+		Name:  "CLEANUP",
+		Value: "true",
+	})
+
+	backoffLimit := int32(cleanupBackoffLimit)
+	deadline := int64(cleanupDeadlineSeconds)
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: args.Source.Namespace,
+			Name:      CleanupJobName(args.Source),
+			Labels:    args.Labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &deadline,
+			Template:              template,
+		},
+	}
+}
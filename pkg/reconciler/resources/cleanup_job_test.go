@@ -0,0 +1,83 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMakeCleanupJob(t *testing.T) {
+	src := &v1alpha1.KinesisSource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "source-name",
+			Namespace: "source-namespace",
+		},
+		Spec: v1alpha1.KinesisSourceSpec{
+			ServiceAccountName: "source-svc-acct",
+			StreamName:         "kinesis-name",
+			Region:             "us-west-2",
+			KIAMOptions: v1alpha1.KiamOptions{
+				AssignedIAMRole: "assigned-role",
+				KCLIAMRoleARN:   "kcl-role",
+			},
+			DeletionPolicy: v1alpha1.DeletionPolicyDelete,
+		},
+	}
+
+	got := MakeCleanupJob(&ReceiveAdapterArgs{
+		Defaults: &Defaults{Image: "test-image", Mesh: v1alpha1.MeshIstio},
+		Source:   src,
+		Labels:   map[string]string{"test-key1": "test-value1"},
+		SinkURI:  "sink-uri",
+	})
+
+	if got.Name != "kinesis-source-name-cleanup" || got.Namespace != "source-namespace" {
+		t.Errorf("unexpected job %s/%s", got.Namespace, got.Name)
+	}
+	template := got.Spec.Template
+	if template.Spec.RestartPolicy != corev1.RestartPolicyNever {
+		t.Errorf("expected restart policy %q, but got %q", corev1.RestartPolicyNever, template.Spec.RestartPolicy)
+	}
+	if template.Spec.ServiceAccountName != "source-svc-acct" {
+		t.Errorf("expected service account %q, but got %q", "source-svc-acct", template.Spec.ServiceAccountName)
+	}
+	wantAnnotations := map[string]string{
+		"iam.amazonaws.com/role":  "assigned-role",
+		"sidecar.istio.io/inject": "false",
+	}
+	if diff := cmp.Diff(wantAnnotations, template.Annotations); diff != "" {
+		t.Errorf("unexpected annotations (-want, +got) = %v", diff)
+	}
+	wantEnv := []corev1.EnvVar{
+		{Name: "STREAM_NAME", Value: "kinesis-name"},
+		{Name: "REGION", Value: "us-west-2"},
+		{Name: "SINK_URI", Value: "sink-uri"},
+		{Name: "CONSUMER_NAME", Value: "source-name"},
+		{Name: "SOURCE_NAMESPACE", Value: "source-namespace"},
+		{Name: "SOURCE_NAME", Value: "source-name"},
+		{Name: "KCL_IAM_ROLE_ARN", Value: "kcl-role"},
+		{Name: "CLEANUP", Value: "true"},
+	}
+	if diff := cmp.Diff(wantEnv, template.Spec.Containers[0].Env); diff != "" {
+		t.Errorf("unexpected env (-want, +got) = %v", diff)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"fmt"
+
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ServiceEntryGVK is the kind of the Istio ServiceEntry allowing the Receive Adapters to reach the
+// AWS APIs of a region.
+var ServiceEntryGVK = schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1alpha3", Kind: "ServiceEntry"}
+
+// meshIntegration holds the settings specific to a service mesh.
+type meshIntegration interface {
+	// podAnnotations returns the annotations of the Receive Adapter pods, which the template of
+	// the source may override.
+	podAnnotations() map[string]string
+
+	// jobAnnotations returns the annotations of the cleanup Job pods. The pods of a Job must not
+	// keep a proxy running once their container is done.
+	jobAnnotations() map[string]string
+}
+
+type noMesh struct{}
+
+func (noMesh) podAnnotations() map[string]string { return nil }
+func (noMesh) jobAnnotations() map[string]string { return nil }
+
+type istioMesh struct{}
+
+func (istioMesh) podAnnotations() map[string]string {
+	return map[string]string{"sidecar.istio.io/inject": "true"}
+}
+
+func (istioMesh) jobAnnotations() map[string]string {
+	return map[string]string{"sidecar.istio.io/inject": "false"}
+}
+
+type linkerdMesh struct{}
+
+func (linkerdMesh) podAnnotations() map[string]string {
+	return map[string]string{"linkerd.io/inject": "enabled"}
+}
+
+func (linkerdMesh) jobAnnotations() map[string]string {
+	return map[string]string{"linkerd.io/inject": "disabled"}
+}
+
+// ResolveMesh returns the mesh of the Receive Adapter of a source: the one of its spec, or else
+// the default one.
+func ResolveMesh(defaults *Defaults, src *v1alpha1.KinesisSource) v1alpha1.Mesh {
+	if src.Spec.Mesh != "" {
+		return src.Spec.Mesh
+	}
+	return defaults.Mesh
+}
+
+func meshFor(mesh v1alpha1.Mesh) meshIntegration {
+	switch mesh {
+	case v1alpha1.MeshIstio:
+		return istioMesh{}
+	case v1alpha1.MeshLinkerd:
+		return linkerdMesh{}
+	}
+	return noMesh{}
+}
+
+// EgressName returns the name of the ServiceEntry allowing the Receive Adapters to reach the AWS
+// APIs of a region. It is shared by the sources of a namespace consuming streams of that region.
+func EgressName(region string) string {
+	return fmt.Sprintf("kinesis-aws-egress-%s", region)
+}
+
+// MakeEgressServiceEntry generates (but does not insert into K8s) the Istio ServiceEntry allowing
+// the Receive Adapters of a namespace to reach the AWS APIs used to consume streams of a region:
+// Kinesis, DynamoDB for the leases, CloudWatch for the metrics and STS for the assumed roles.
+func MakeEgressServiceEntry(namespace, region string, labels map[string]string) *unstructured.Unstructured {
+	hosts := []interface{}{
+		fmt.Sprintf("kinesis.%s.amazonaws.com", region),
+		fmt.Sprintf("dynamodb.%s.amazonaws.com", region),
+		fmt.Sprintf("monitoring.%s.amazonaws.com", region),
+		fmt.Sprintf("sts.%s.amazonaws.com", region),
+		"sts.amazonaws.com",
+	}
+
+	se := &unstructured.Unstructured{}
+	se.SetGroupVersionKind(ServiceEntryGVK)
+	se.SetNamespace(namespace)
+	se.SetName(EgressName(region))
+	se.SetLabels(labels)
+	se.Object["spec"] = map[string]interface{}{
+		"hosts": hosts,
+		"ports": []interface{}{
+			map[string]interface{}{
+				"number":   int64(443),
+				"name":     "https",
+				"protocol": "HTTPS",
+			},
+		},
+		"resolution": "DNS",
+		"location":   "MESH_EXTERNAL",
+	}
+	return se
+}
+
+// SetEgressOwner adds a source to the owners of an egress ServiceEntry, so that the ServiceEntry
+// is garbage collected along with the last source using it. It reports whether the owners changed.
+func SetEgressOwner(se *unstructured.Unstructured, src *v1alpha1.KinesisSource) bool {
+	owners := se.GetOwnerReferences()
+	for _, owner := range owners {
+		if owner.UID == src.UID {
+			return false
+		}
+	}
+	se.SetOwnerReferences(append(owners, metav1.OwnerReference{
+		APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		Kind:       "KinesisSource",
+		Name:       src.Name,
+		UID:        src.UID,
+	}))
+	return true
+}
+
+// RemoveEgressOwner removes a source from the owners of an egress ServiceEntry. It reports whether
+// the owners changed.
+func RemoveEgressOwner(se *unstructured.Unstructured, src *v1alpha1.KinesisSource) bool {
+	owners := se.GetOwnerReferences()
+	kept := owners[:0]
+	for _, owner := range owners {
+		if owner.UID != src.UID {
+			kept = append(kept, owner)
+		}
+	}
+	if len(kept) == len(owners) {
+		return false
+	}
+	se.SetOwnerReferences(kept)
+	return true
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestMeshAnnotations(t *testing.T) {
+	src := &v1alpha1.KinesisSource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "source-name",
+			Namespace: "source-namespace",
+		},
+		Spec: v1alpha1.KinesisSourceSpec{
+			StreamName: "kinesis-name",
+			Region:     "us-west-2",
+			KIAMOptions: v1alpha1.KiamOptions{
+				AssignedIAMRole: "assigned-role",
+				KCLIAMRoleARN:   "kcl-role",
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		defaultMesh v1alpha1.Mesh
+		sourceMesh  v1alpha1.Mesh
+		wantPod     map[string]string
+		wantJob     map[string]string
+	}{
+		"none": {
+			defaultMesh: v1alpha1.MeshNone,
+			wantPod:     map[string]string{},
+			wantJob:     map[string]string{},
+		},
+		"istio": {
+			defaultMesh: v1alpha1.MeshIstio,
+			wantPod:     map[string]string{"sidecar.istio.io/inject": "true"},
+			wantJob:     map[string]string{"sidecar.istio.io/inject": "false"},
+		},
+		"linkerd from the spec": {
+			defaultMesh: v1alpha1.MeshIstio,
+			sourceMesh:  v1alpha1.MeshLinkerd,
+			wantPod:     map[string]string{"linkerd.io/inject": "enabled"},
+			wantJob:     map[string]string{"linkerd.io/inject": "disabled"},
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			src := src.DeepCopy()
+			src.Spec.Mesh = tc.sourceMesh
+			args := &ReceiveAdapterArgs{
+				Defaults: &Defaults{Image: "test-image", Mesh: tc.defaultMesh},
+				Source:   src,
+				Labels:   map[string]string{"test-key": "test-value"},
+				SinkURI:  "sink-uri",
+			}
+
+			// The KIAM role annotation does not depend on the mesh.
+			pod := MakeReceiveAdapter(args).Spec.Template.Annotations
+			delete(pod, "iam.amazonaws.com/role")
+			if diff := cmp.Diff(tc.wantPod, pod); diff != "" {
+				t.Errorf("unexpected pod annotations (-want, +got) = %v", diff)
+			}
+			job := MakeCleanupJob(args).Spec.Template.Annotations
+			delete(job, "iam.amazonaws.com/role")
+			if diff := cmp.Diff(tc.wantJob, job); diff != "" {
+				t.Errorf("unexpected job annotations (-want, +got) = %v", diff)
+			}
+		})
+	}
+}
+
+func TestMakeEgressServiceEntry(t *testing.T) {
+	se := MakeEgressServiceEntry("source-namespace", "eu-west-1", map[string]string{"test-key": "test-value"})
+
+	if se.GetName() != "kinesis-aws-egress-eu-west-1" || se.GetNamespace() != "source-namespace" {
+		t.Errorf("unexpected ServiceEntry %s/%s", se.GetNamespace(), se.GetName())
+	}
+	hosts, _, _ := unstructured.NestedStringSlice(se.Object, "spec", "hosts")
+	want := []string{
+		"kinesis.eu-west-1.amazonaws.com",
+		"dynamodb.eu-west-1.amazonaws.com",
+		"monitoring.eu-west-1.amazonaws.com",
+		"sts.eu-west-1.amazonaws.com",
+		"sts.amazonaws.com",
+	}
+	if diff := cmp.Diff(want, hosts); diff != "" {
+		t.Errorf("unexpected hosts (-want, +got) = %v", diff)
+	}
+
+	src := &v1alpha1.KinesisSource{ObjectMeta: metav1.ObjectMeta{Name: "source-name", UID: "1234"}}
+	if !SetEgressOwner(se, src) || SetEgressOwner(se, src) {
+		t.Error("expected the owner to be added once")
+	}
+	if !RemoveEgressOwner(se, src) || RemoveEgressOwner(se, src) {
+		t.Error("expected the owner to be removed once")
+	}
+	if len(se.GetOwnerReferences()) != 0 {
+		t.Errorf("unexpected owners %v", se.GetOwnerReferences())
+	}
+}
@@ -17,150 +17,414 @@ limitations under the License.
 package resources
 
 import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
 	"k8s.io/api/apps/v1"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// SpecHashAnnotation is the annotation on the Receive Adapter Deployment that holds the hash of
+// its desired pod template. The Deployment is updated whenever the hash differs.
+const SpecHashAnnotation = "sources.eventing.knative.dev/spec-hash"
+
+// ReplayTokenAnnotation is the annotation on the Receive Adapter Deployment that holds the token
+// of the replay its pod template carries out.
+const ReplayTokenAnnotation = "sources.eventing.knative.dev/replay-token"
+
+const (
+	// schemaVolume is the volume holding the schemas the data of the records is decoded with.
+	schemaVolume = "schemas"
+
+	// schemaMountPath is where the schemas are mounted in the Receive Adapter container.
+	schemaMountPath = "/etc/kinesis-schemas"
 )
 
 // ReceiveAdapterArgs are the arguments needed to create an AWS Kinesis Source Receive Adapter.
 // Every field is required.
 type ReceiveAdapterArgs struct {
-	Image   string
-	Source  *v1alpha1.KinesisSource
-	Labels  map[string]string
-	SinkURI string
+	Defaults *Defaults
+	Source   *v1alpha1.KinesisSource
+	Labels   map[string]string
+	SinkURI  string
+}
+
+// Defaults are the cluster-wide defaults of the Receive Adapters, which the spec of a Kinesis
+// Source overrides. The unset KCL, metrics and retry settings are left to the Receive Adapter.
+type Defaults struct {
+	// Image is the image of the Receive Adapter.
+	Image string
+
+	// Mesh is the service mesh the Receive Adapter pods join.
+	Mesh v1alpha1.Mesh
+
+	KCL            v1alpha1.KCLSpec
+	MetricsBackend v1alpha1.MetricsBackend
+	Retry          v1alpha1.RetryPolicy
+}
+
+// ReceiveAdapterName returns the name of the Receive Adapter Deployment for a Kinesis Source.
+// It is derived from the source name, and hashed to keep it a valid DNS label when the source
+// name is too long.
+func ReceiveAdapterName(src *v1alpha1.KinesisSource) string {
+	return boundedName(fmt.Sprintf("kinesis-%s", src.Name), src.Name)
+}
+
+// boundedName returns name when it is a valid DNS label length, or else a truncation of it
+// suffixed with the hash of key.
+func boundedName(name, key string) string {
+	if len(name) <= validation.DNS1123LabelMaxLength {
+		return name
+	}
+	hash := fmt.Sprintf("%x", md5.Sum([]byte(key)))
+	return name[:validation.DNS1123LabelMaxLength-len(hash)] + hash
 }
 
 // MakeReceiveAdapter generates (but does not insert into K8s) the Receive Adapter Deployment for
 // Kinesis Sources.
 func MakeReceiveAdapter(args *ReceiveAdapterArgs) *v1.Deployment {
+	spec := makeDeploymentSpec(args)
+	annotations := map[string]string{
+		SpecHashAnnotation: SpecHash(&spec.Template),
+	}
+	if replay := args.Source.Spec.Replay; replay != nil {
+		annotations[ReplayTokenAnnotation] = replay.Token
+	}
 	return &v1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace:    args.Source.Namespace,
-			GenerateName: fmt.Sprintf("kinesis-%s-", args.Source.Name),
-			Labels:       args.Labels,
+			Namespace:   args.Source.Namespace,
+			Name:        ReceiveAdapterName(args.Source),
+			Labels:      args.Labels,
+			Annotations: annotations,
 		},
-		Spec: makeDeploymentSpec(args),
+		Spec: spec,
 	}
 }
 
+// SpecHash returns the hash of a pod template, covering its labels, annotations and spec.
+func SpecHash(template *corev1.PodTemplateSpec) string {
+	// Marshaling a PodTemplateSpec does not fail, and map keys are sorted, so the
+	// result is stable.
+	b, _ := json.Marshal(template)
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
+
 func makeDeploymentSpec(args *ReceiveAdapterArgs) v1.DeploymentSpec {
 	replicas := int32(1)
-	if len(args.Source.Spec.AwsCredsSecret.Name) > 0 && len(args.Source.Spec.AwsCredsSecret.Key) > 0 {
+	spec := args.Source.Spec
+	if spec.Suspend {
+		replicas = 0
+	}
+
+	annotations := map[string]string{}
+	container := corev1.Container{
+		Name:  "receive-adapter",
+		Image: args.Defaults.Image,
+		Env: []corev1.EnvVar{
+			{
+				Name:  "STREAM_NAME",
+				Value: spec.StreamName,
+			},
+			{
+				Name:  "REGION",
+				Value: spec.Region,
+			},
+			{
+				Name:  "SINK_URI",
+				Value: args.SinkURI,
+			},
+			{
+				Name:  "CONSUMER_NAME",
+				Value: args.Source.Name,
+			},
+			{
+				Name:  "SOURCE_NAMESPACE",
+				Value: args.Source.Namespace,
+			},
+			{
+				Name:  "SOURCE_NAME",
+				Value: args.Source.Name,
+			},
+		},
+	}
+	podSpec := corev1.PodSpec{
+		ServiceAccountName: spec.ServiceAccountName,
+	}
+
+	if len(spec.AwsCredsSecret.Name) > 0 && len(spec.AwsCredsSecret.Key) > 0 {
 		credsVolume := "aws-credentials"
 		credsMountPath := "/var/secrets/aws"
-		credsFile := fmt.Sprintf("%s/%s", credsMountPath, args.Source.Spec.AwsCredsSecret.Key)
-		return v1.DeploymentSpec{
-			Selector: &metav1.LabelSelector{
-				MatchLabels: args.Labels,
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "AWS_APPLICATION_CREDENTIALS",
+			Value: fmt.Sprintf("%s/%s", credsMountPath, spec.AwsCredsSecret.Key),
+		})
+		container.VolumeMounts = []corev1.VolumeMount{
+			{
+				Name:      credsVolume,
+				MountPath: credsMountPath,
 			},
-			Replicas: &replicas,
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Annotations: map[string]string{
-						"sidecar.istio.io/inject": "true",
-					},
-					Labels: args.Labels,
-				},
-				Spec: corev1.PodSpec{
-					ServiceAccountName: args.Source.Spec.ServiceAccountName,
-					Containers: []corev1.Container{
-						{
-							Name:  "receive-adapter",
-							Image: args.Image,
-							Env: []corev1.EnvVar{
-								{
-									Name:  "AWS_APPLICATION_CREDENTIALS",
-									Value: credsFile,
-								},
-								{
-									Name:  "STREAM_NAME",
-									Value: args.Source.Spec.StreamName,
-								},
-								{
-									Name:  "REGION",
-									Value: args.Source.Spec.Region,
-								},
-								{
-									Name:  "SINK_URI",
-									Value: args.SinkURI,
-								},
-								{
-									Name:  "CONSUMER_NAME",
-									Value: args.Source.Name,
-								},
-							},
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      credsVolume,
-									MountPath: credsMountPath,
-								},
-							},
-						},
-					},
-					Volumes: []corev1.Volume{
-						{
-							Name: credsVolume,
-							VolumeSource: corev1.VolumeSource{
-								Secret: &corev1.SecretVolumeSource{
-									SecretName: args.Source.Spec.AwsCredsSecret.Name,
-								},
-							},
-						},
+		}
+		podSpec.Volumes = []corev1.Volume{
+			{
+				Name: credsVolume,
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: spec.AwsCredsSecret.Name,
 					},
 				},
 			},
 		}
 	} else {
-		return v1.DeploymentSpec{
-			Selector: &metav1.LabelSelector{
-				MatchLabels: args.Labels,
-			},
-			Replicas: &replicas,
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Annotations: map[string]string{
-						"sidecar.istio.io/inject": "true",
-						"iam.amazonaws.com/role":  args.Source.Spec.KIAMOptions.AssignedIAMRole,
-					},
-					Labels: args.Labels,
-				},
-				Spec: corev1.PodSpec{
-					ServiceAccountName: args.Source.Spec.ServiceAccountName,
-					Containers: []corev1.Container{
-						{
-							Name:  "receive-adapter",
-							Image: args.Image,
-							Env: []corev1.EnvVar{
-								{
-									Name:  "STREAM_NAME",
-									Value: args.Source.Spec.StreamName,
-								},
-								{
-									Name:  "KCL_IAM_ROLE_ARN",
-									Value: args.Source.Spec.KIAMOptions.KCLIAMRoleARN,
-								},
-								{
-									Name:  "REGION",
-									Value: args.Source.Spec.Region,
-								},
-								{
-									Name:  "SINK_URI",
-									Value: args.SinkURI,
-								},
-								{
-									Name:  "CONSUMER_NAME",
-									Value: args.Source.Name,
-								},
-							},
-						},
-					},
-				},
+		annotations[v1alpha1.IAMRoleAnnotation] = spec.KIAMOptions.AssignedIAMRole
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "KCL_IAM_ROLE_ARN",
+			Value: spec.KIAMOptions.KCLIAMRoleARN,
+		})
+	}
+
+	container.Env = append(container.Env, tuningEnv(args.Defaults, &spec)...)
+	if spec.PayloadFormat != "" {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "PAYLOAD_FORMAT",
+			Value: string(spec.PayloadFormat),
+		})
+	}
+	if spec.DynamoDBChanges != nil && spec.DynamoDBChanges.PlainJSON {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "DYNAMODB_PLAIN_JSON",
+			Value: "true",
+		})
+	}
+	if spec.DataContentType != "" {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "DATA_CONTENT_TYPE",
+			Value: string(spec.DataContentType),
+		})
+	}
+	if spec.Compression != "" {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "COMPRESSION",
+			Value: string(spec.Compression),
+		})
+	}
+	if spec.Schema != nil {
+		addSchema(&podSpec, &container, args.Source)
+	}
+	if spec.DeadLetterSinkURI != "" {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "DEAD_LETTER_SINK_URI",
+			Value: spec.DeadLetterSinkURI,
+		})
+	}
+	if spec.Filter != nil {
+		// The filter is passed as JSON, marshaling it does not fail.
+		filter, _ := json.Marshal(spec.Filter)
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "FILTER",
+			Value: string(filter),
+		})
+	}
+	if spec.CEOverrides != nil {
+		// The overrides are passed as JSON, marshaling them does not fail.
+		overrides, _ := json.Marshal(spec.CEOverrides)
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "CE_OVERRIDES",
+			Value: string(overrides),
+		})
+	}
+	if len(spec.Transform) > 0 {
+		// The transform is passed as JSON, marshaling it does not fail.
+		transform, _ := json.Marshal(spec.Transform)
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "TRANSFORM",
+			Value: string(transform),
+		})
+	}
+
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: annotations,
+			Labels:      args.Labels,
+		},
+		Spec: podSpec,
+	}
+	if spec.Replay != nil {
+		// The replay is passed as JSON, marshaling it does not fail.
+		replay, _ := json.Marshal(spec.Replay)
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "REPLAY",
+			Value: string(replay),
+		})
+	}
+
+	if spec.Template != nil {
+		applyTemplate(&template, &container, spec.Template)
+	}
+	// The mesh annotations are defaults, which the template may override.
+	for k, v := range meshFor(ResolveMesh(args.Defaults, args.Source)).podAnnotations() {
+		if _, ok := template.Annotations[k]; !ok {
+			template.Annotations[k] = v
+		}
+	}
+	template.Spec.Containers = []corev1.Container{container}
+
+	return v1.DeploymentSpec{
+		Selector: &metav1.LabelSelector{
+			MatchLabels: args.Labels,
+		},
+		Replicas: &replicas,
+		Template: template,
+	}
+}
+
+// applyTemplate merges the user provided template over the generated pod template and receive
+// adapter container. Labels, annotations and environment variables set by the controller are
+// kept when the template sets them too. The KIAM annotation and the credential environment
+// variables of the template are dropped, the credentials only come from the spec.
+func applyTemplate(template *corev1.PodTemplateSpec, container *corev1.Container, overlay *v1alpha1.ReceiveAdapterTemplate) {
+	template.Labels = mergeMaps(overlay.Metadata.Labels, template.Labels)
+	annotations := mergeMaps(overlay.Metadata.Annotations, nil)
+	delete(annotations, v1alpha1.IAMRoleAnnotation)
+	template.Annotations = mergeMaps(annotations, template.Annotations)
+
+	if overlay.Spec.Image != "" {
+		container.Image = overlay.Spec.Image
+	}
+	container.Resources = overlay.Spec.Resources
+	for _, env := range overlay.Spec.Env {
+		if !hasEnv(container.Env, env.Name) && !isCredentialEnv(env.Name) {
+			container.Env = append(container.Env, env)
+		}
+	}
+
+	template.Spec.NodeSelector = overlay.Spec.NodeSelector
+	template.Spec.Tolerations = overlay.Spec.Tolerations
+	template.Spec.Affinity = overlay.Spec.Affinity
+	template.Spec.PriorityClassName = overlay.Spec.PriorityClassName
+	template.Spec.SecurityContext = overlay.Spec.SecurityContext
+	template.Spec.ImagePullSecrets = overlay.Spec.ImagePullSecrets
+}
+
+// addSchema mounts the ConfigMap holding the schemas of the source in the Receive Adapter pod.
+// The schemas are identified by the API path of the ConfigMap.
+func addSchema(podSpec *corev1.PodSpec, container *corev1.Container, src *v1alpha1.KinesisSource) {
+	schema := src.Spec.Schema
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "SCHEMA_TYPE", Value: string(schema.Type)},
+		corev1.EnvVar{Name: "SCHEMA_DIR", Value: schemaMountPath},
+		corev1.EnvVar{Name: "SCHEMA_URL", Value: fmt.Sprintf("/api/v1/namespaces/%s/configmaps/%s", src.Namespace, schema.ConfigMapName)},
+	)
+	if schema.MessageType != "" {
+		container.Env = append(container.Env, corev1.EnvVar{Name: "SCHEMA_MESSAGE_TYPE", Value: schema.MessageType})
+	}
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      schemaVolume,
+		MountPath: schemaMountPath,
+		ReadOnly:  true,
+	})
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: schemaVolume,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: schema.ConfigMapName},
 			},
+		},
+	})
+}
+
+// tuningEnv returns the environment variables passing the KCL, metrics and retry settings of the
+// spec, or else of the defaults, to the Receive Adapter. Settings unset in both are omitted.
+func tuningEnv(defaults *Defaults, spec *v1alpha1.KinesisSourceSpec) []corev1.EnvVar {
+	kcl := defaults.KCL
+	if spec.KCL != nil {
+		if spec.KCL.MaxRecords != nil {
+			kcl.MaxRecords = spec.KCL.MaxRecords
+		}
+		if spec.KCL.MaxLeasesForWorker != nil {
+			kcl.MaxLeasesForWorker = spec.KCL.MaxLeasesForWorker
+		}
+		if spec.KCL.ShardSyncInterval != nil {
+			kcl.ShardSyncInterval = spec.KCL.ShardSyncInterval
+		}
+		if spec.KCL.FailoverTime != nil {
+			kcl.FailoverTime = spec.KCL.FailoverTime
+		}
+	}
+	retry := defaults.Retry
+	if spec.Retry != nil {
+		if spec.Retry.Attempts != nil {
+			retry.Attempts = spec.Retry.Attempts
+		}
+		if spec.Retry.Backoff != nil {
+			retry.Backoff = spec.Retry.Backoff
+		}
+		if spec.Retry.MaxBackoff != nil {
+			retry.MaxBackoff = spec.Retry.MaxBackoff
+		}
+	}
+	metricsBackend := defaults.MetricsBackend
+	if spec.MetricsBackend != "" {
+		metricsBackend = spec.MetricsBackend
+	}
+
+	var env []corev1.EnvVar
+	addInt := func(name string, value *int32) {
+		if value != nil {
+			env = append(env, corev1.EnvVar{Name: name, Value: strconv.Itoa(int(*value))})
+		}
+	}
+	addDuration := func(name string, value *metav1.Duration) {
+		if value != nil {
+			env = append(env, corev1.EnvVar{Name: name, Value: value.Duration.String()})
+		}
+	}
+	addInt("KCL_MAX_RECORDS", kcl.MaxRecords)
+	addInt("KCL_MAX_LEASES_FOR_WORKER", kcl.MaxLeasesForWorker)
+	addDuration("KCL_SHARD_SYNC_INTERVAL", kcl.ShardSyncInterval)
+	addDuration("KCL_FAILOVER_TIME", kcl.FailoverTime)
+	if metricsBackend != "" {
+		env = append(env, corev1.EnvVar{Name: "METRICS_BACKEND", Value: string(metricsBackend)})
+	}
+	addInt("RETRY_ATTEMPTS", retry.Attempts)
+	addDuration("RETRY_BACKOFF", retry.Backoff)
+	addDuration("RETRY_MAX_BACKOFF", retry.MaxBackoff)
+	return env
+}
+
+// mergeMaps returns a new map holding the entries of base, overridden by the entries of
+// overrides.
+func mergeMaps(base, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+func isCredentialEnv(name string) bool {
+	for _, n := range v1alpha1.CredentialEnvVars {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEnv(env []corev1.EnvVar, name string) bool {
+	for _, e := range env {
+		if e.Name == name {
+			return true
 		}
 	}
+	return false
 }
@@ -17,13 +17,20 @@ limitations under the License.
 package resources
 
 import (
+	"crypto/md5"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
 	v1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 func TestMakeReceiveAdapterCredential(t *testing.T) {
@@ -50,8 +57,8 @@ func TestMakeReceiveAdapterCredential(t *testing.T) {
 	}
 
 	receiveAdapterArgs := ReceiveAdapterArgs{
-		Image:  "test-image",
-		Source: src,
+		Defaults: &Defaults{Image: "test-image", Mesh: v1alpha1.MeshIstio},
+		Source:   src,
 		Labels: map[string]string{
 			"test-key1": "test-value1",
 			"test-key2": "test-value2",
@@ -64,12 +71,13 @@ func TestMakeReceiveAdapterCredential(t *testing.T) {
 	one := int32(1)
 	want := &v1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace:    "source-namespace",
-			GenerateName: "kinesis-source-name-",
+			Namespace: "source-namespace",
+			Name:      "kinesis-source-name",
 			Labels: map[string]string{
 				"test-key1": "test-value1",
 				"test-key2": "test-value2",
 			},
+			Annotations: map[string]string{},
 		},
 		Spec: v1.DeploymentSpec{
 			Selector: &metav1.LabelSelector{
@@ -96,10 +104,6 @@ func TestMakeReceiveAdapterCredential(t *testing.T) {
 							Name:  "receive-adapter",
 							Image: "test-image",
 							Env: []corev1.EnvVar{
-								{
-									Name:  "AWS_APPLICATION_CREDENTIALS",
-									Value: "/var/secrets/aws/aws-secret-key",
-								},
 								{
 									Name:  "STREAM_NAME",
 									Value: "kinesis-name",
@@ -116,6 +120,18 @@ func TestMakeReceiveAdapterCredential(t *testing.T) {
 									Name:  "CONSUMER_NAME",
 									Value: "source-name",
 								},
+								{
+									Name:  "SOURCE_NAMESPACE",
+									Value: "source-namespace",
+								},
+								{
+									Name:  "SOURCE_NAME",
+									Value: "source-name",
+								},
+								{
+									Name:  "AWS_APPLICATION_CREDENTIALS",
+									Value: "/var/secrets/aws/aws-secret-key",
+								},
 							},
 							VolumeMounts: []corev1.VolumeMount{
 								{
@@ -139,6 +155,7 @@ func TestMakeReceiveAdapterCredential(t *testing.T) {
 			},
 		},
 	}
+	want.Annotations[SpecHashAnnotation] = SpecHash(&want.Spec.Template)
 
 	if diff := cmp.Diff(want, got); diff != "" {
 		t.Errorf("unexpected deploy (-want, +got) = %v", diff)
@@ -163,8 +180,8 @@ func TestMakeReceiveAdapterKiam(t *testing.T) {
 	}
 
 	got := MakeReceiveAdapter(&ReceiveAdapterArgs{
-		Image:  "test-image",
-		Source: src,
+		Defaults: &Defaults{Image: "test-image", Mesh: v1alpha1.MeshIstio},
+		Source:   src,
 		Labels: map[string]string{
 			"test-key1": "test-value1",
 			"test-key2": "test-value2",
@@ -175,12 +192,13 @@ func TestMakeReceiveAdapterKiam(t *testing.T) {
 	one := int32(1)
 	want := &v1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Namespace:    "source-namespace",
-			GenerateName: "kinesis-source-name-",
+			Namespace: "source-namespace",
+			Name:      "kinesis-source-name",
 			Labels: map[string]string{
 				"test-key1": "test-value1",
 				"test-key2": "test-value2",
 			},
+			Annotations: map[string]string{},
 		},
 		Spec: v1.DeploymentSpec{
 			Selector: &metav1.LabelSelector{
@@ -212,10 +230,6 @@ func TestMakeReceiveAdapterKiam(t *testing.T) {
 									Name:  "STREAM_NAME",
 									Value: "kinesis-name",
 								},
-								{
-									Name:  "KCL_IAM_ROLE_ARN",
-									Value: "kcl-role",
-								},
 								{
 									Name:  "REGION",
 									Value: "us-west-2",
@@ -228,6 +242,18 @@ func TestMakeReceiveAdapterKiam(t *testing.T) {
 									Name:  "CONSUMER_NAME",
 									Value: "source-name",
 								},
+								{
+									Name:  "SOURCE_NAMESPACE",
+									Value: "source-namespace",
+								},
+								{
+									Name:  "SOURCE_NAME",
+									Value: "source-name",
+								},
+								{
+									Name:  "KCL_IAM_ROLE_ARN",
+									Value: "kcl-role",
+								},
 							},
 						},
 					},
@@ -235,8 +261,494 @@ func TestMakeReceiveAdapterKiam(t *testing.T) {
 			},
 		},
 	}
+	want.Annotations[SpecHashAnnotation] = SpecHash(&want.Spec.Template)
 
 	if diff := cmp.Diff(want, got); diff != "" {
 		t.Errorf("unexpected deploy (-want, +got) = %v", diff)
 	}
 }
+
+func TestReceiveAdapterName(t *testing.T) {
+	tests := []struct {
+		name       string
+		sourceName string
+		want       string
+	}{{
+		name:       "short name",
+		sourceName: "source-name",
+		want:       "kinesis-source-name",
+	}, {
+		name:       "longest unhashed name",
+		sourceName: strings.Repeat("a", 55),
+		want:       "kinesis-" + strings.Repeat("a", 55),
+	}, {
+		name:       "hashed name",
+		sourceName: strings.Repeat("a", 56),
+		want:       "kinesis-" + strings.Repeat("a", 23) + fmt.Sprintf("%x", md5.Sum([]byte(strings.Repeat("a", 56)))),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ReceiveAdapterName(&v1alpha1.KinesisSource{
+				ObjectMeta: metav1.ObjectMeta{Name: test.sourceName},
+			})
+			if got != test.want {
+				t.Errorf("expected name %q, but got %q", test.want, got)
+			}
+			if len(got) > 63 {
+				t.Errorf("expected name of at most 63 characters, but got %d", len(got))
+			}
+		})
+	}
+}
+
+func TestSpecHashChangesWithTemplate(t *testing.T) {
+	src := &v1alpha1.KinesisSource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "source-name",
+			Namespace: "source-namespace",
+		},
+		Spec: v1alpha1.KinesisSourceSpec{
+			StreamName: "kinesis-name",
+			Region:     "us-west-2",
+			KIAMOptions: v1alpha1.KiamOptions{
+				AssignedIAMRole: "assigned-role",
+				KCLIAMRoleARN:   "kcl-role",
+			},
+		},
+	}
+	args := &ReceiveAdapterArgs{
+		Defaults: &Defaults{Image: "test-image", Mesh: v1alpha1.MeshIstio},
+		Source:   src,
+		Labels:   map[string]string{"test-key": "test-value"},
+		SinkURI:  "sink-uri",
+	}
+	hash := MakeReceiveAdapter(args).Annotations[SpecHashAnnotation]
+
+	if got := MakeReceiveAdapter(args).Annotations[SpecHashAnnotation]; got != hash {
+		t.Errorf("expected stable hash %q, but got %q", hash, got)
+	}
+
+	// Changing only the KIAM role changes only a pod template annotation.
+	src.Spec.KIAMOptions.AssignedIAMRole = "other-role"
+	if got := MakeReceiveAdapter(args).Annotations[SpecHashAnnotation]; got == hash {
+		t.Errorf("expected hash to change with the pod annotations, but got %q", got)
+	}
+}
+
+func TestMakeReceiveAdapterTemplateCredentials(t *testing.T) {
+	// The template of a source using a secret tries to get the pod a KIAM role and credentials.
+	src := &v1alpha1.KinesisSource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "source-name",
+			Namespace: "source-namespace",
+		},
+		Spec: v1alpha1.KinesisSourceSpec{
+			StreamName: "kinesis-name",
+			Region:     "us-west-2",
+			AwsCredsSecret: corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "secret-name"},
+				Key:                  "secret-key",
+			},
+			Template: &v1alpha1.ReceiveAdapterTemplate{
+				Metadata: v1alpha1.ReceiveAdapterMetadata{
+					Annotations: map[string]string{v1alpha1.IAMRoleAnnotation: "admin"},
+				},
+				Spec: v1alpha1.ReceiveAdapterPodSpec{
+					Env: []corev1.EnvVar{
+						{Name: "KCL_IAM_ROLE_ARN", Value: "arn:aws:iam::123456789012:role/admin"},
+						{Name: "AWS_ACCESS_KEY_ID", Value: "AKIA"},
+						{Name: "EXTRA", Value: "extra"},
+					},
+				},
+			},
+		},
+	}
+
+	got := MakeReceiveAdapter(&ReceiveAdapterArgs{
+		Defaults: &Defaults{Image: "test-image"},
+		Source:   src,
+		Labels:   map[string]string{"test-key1": "test-value1"},
+		SinkURI:  "sink-uri",
+	})
+
+	template := got.Spec.Template
+	if role, ok := template.Annotations[v1alpha1.IAMRoleAnnotation]; ok {
+		t.Errorf("expected no KIAM role, but got %q", role)
+	}
+	env := template.Spec.Containers[0].Env
+	for _, name := range []string{"KCL_IAM_ROLE_ARN", "AWS_ACCESS_KEY_ID"} {
+		if hasEnv(env, name) {
+			t.Errorf("expected no %s from the template, but got %v", name, env)
+		}
+	}
+	if !hasEnv(env, "EXTRA") {
+		t.Errorf("expected the other variables of the template, but got %v", env)
+	}
+}
+
+func TestMakeReceiveAdapterTemplate(t *testing.T) {
+	src := &v1alpha1.KinesisSource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "source-name",
+			Namespace: "source-namespace",
+		},
+		Spec: v1alpha1.KinesisSourceSpec{
+			StreamName: "kinesis-name",
+			Region:     "us-west-2",
+			KIAMOptions: v1alpha1.KiamOptions{
+				AssignedIAMRole: "assigned-role",
+				KCLIAMRoleARN:   "kcl-role",
+			},
+			Template: &v1alpha1.ReceiveAdapterTemplate{
+				Metadata: v1alpha1.ReceiveAdapterMetadata{
+					Labels: map[string]string{
+						"team":      "data",
+						"test-key1": "overridden",
+					},
+					Annotations: map[string]string{
+						"example.com/owner":      "data",
+						"iam.amazonaws.com/role": "overridden",
+					},
+				},
+				Spec: v1alpha1.ReceiveAdapterPodSpec{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU: resource.MustParse("100m"),
+						},
+					},
+					Env: []corev1.EnvVar{
+						{Name: "EXTRA", Value: "extra"},
+						{Name: "STREAM_NAME", Value: "overridden"},
+					},
+					NodeSelector:      map[string]string{"pool": "kinesis"},
+					PriorityClassName: "high",
+					ImagePullSecrets:  []corev1.LocalObjectReference{{Name: "registry"}},
+				},
+			},
+		},
+	}
+
+	got := MakeReceiveAdapter(&ReceiveAdapterArgs{
+		Defaults: &Defaults{Image: "test-image", Mesh: v1alpha1.MeshIstio},
+		Source:   src,
+		Labels:   map[string]string{"test-key1": "test-value1"},
+		SinkURI:  "sink-uri",
+	})
+
+	template := got.Spec.Template
+	if diff := cmp.Diff(map[string]string{"team": "data", "test-key1": "test-value1"}, template.Labels); diff != "" {
+		t.Errorf("unexpected labels (-want, +got) = %v", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"test-key1": "test-value1"}, got.Spec.Selector.MatchLabels); diff != "" {
+		t.Errorf("unexpected selector (-want, +got) = %v", diff)
+	}
+	wantAnnotations := map[string]string{
+		"example.com/owner":       "data",
+		"iam.amazonaws.com/role":  "assigned-role",
+		"sidecar.istio.io/inject": "true",
+	}
+	if diff := cmp.Diff(wantAnnotations, template.Annotations); diff != "" {
+		t.Errorf("unexpected annotations (-want, +got) = %v", diff)
+	}
+
+	container := template.Spec.Containers[0]
+	if !equality.Semantic.DeepEqual(src.Spec.Template.Spec.Resources, container.Resources) {
+		t.Errorf("expected resources %v, but got %v", src.Spec.Template.Spec.Resources, container.Resources)
+	}
+	wantEnv := []corev1.EnvVar{
+		{Name: "STREAM_NAME", Value: "kinesis-name"},
+		{Name: "REGION", Value: "us-west-2"},
+		{Name: "SINK_URI", Value: "sink-uri"},
+		{Name: "CONSUMER_NAME", Value: "source-name"},
+		{Name: "SOURCE_NAMESPACE", Value: "source-namespace"},
+		{Name: "SOURCE_NAME", Value: "source-name"},
+		{Name: "KCL_IAM_ROLE_ARN", Value: "kcl-role"},
+		{Name: "EXTRA", Value: "extra"},
+	}
+	if diff := cmp.Diff(wantEnv, container.Env); diff != "" {
+		t.Errorf("unexpected env (-want, +got) = %v", diff)
+	}
+
+	if diff := cmp.Diff(map[string]string{"pool": "kinesis"}, template.Spec.NodeSelector); diff != "" {
+		t.Errorf("unexpected node selector (-want, +got) = %v", diff)
+	}
+	if template.Spec.PriorityClassName != "high" {
+		t.Errorf("expected priority class %q, but got %q", "high", template.Spec.PriorityClassName)
+	}
+	if diff := cmp.Diff([]corev1.LocalObjectReference{{Name: "registry"}}, template.Spec.ImagePullSecrets); diff != "" {
+		t.Errorf("unexpected image pull secrets (-want, +got) = %v", diff)
+	}
+}
+
+// testSource returns a KIAM source with mutate applied to its spec.
+func testSource(mutate func(*v1alpha1.KinesisSourceSpec)) *v1alpha1.KinesisSource {
+	src := &v1alpha1.KinesisSource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "source-name",
+			Namespace: "source-namespace",
+		},
+		Spec: v1alpha1.KinesisSourceSpec{
+			StreamName: "kinesis-name",
+			Region:     "us-west-2",
+			KIAMOptions: v1alpha1.KiamOptions{
+				AssignedIAMRole: "assigned-role",
+				KCLIAMRoleARN:   "kcl-role",
+			},
+		},
+	}
+	if mutate != nil {
+		mutate(&src.Spec)
+	}
+	return src
+}
+
+// envVar looks up the environment variable called name.
+func envVar(env []corev1.EnvVar, name string) (corev1.EnvVar, bool) {
+	for _, e := range env {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return corev1.EnvVar{}, false
+}
+
+func TestMakeReceiveAdapterEnv(t *testing.T) {
+	prefix := "orders-"
+	testCases := map[string]struct {
+		mutate func(*v1alpha1.KinesisSourceSpec)
+		want   []corev1.EnvVar
+		absent []string
+	}{
+		"no options": {
+			absent: []string{"REPLAY", "FILTER", "CE_OVERRIDES", "TRANSFORM", "SCHEMA_TYPE", "DEAD_LETTER_SINK_URI"},
+		},
+		"replay": {
+			mutate: func(spec *v1alpha1.KinesisSourceSpec) {
+				spec.Replay = &v1alpha1.ReplaySpec{Token: "rewind-1", TrimHorizon: true}
+			},
+			want: []corev1.EnvVar{{Name: "REPLAY", Value: `{"token":"rewind-1","trimHorizon":true}`}},
+		},
+		"filter": {
+			mutate: func(spec *v1alpha1.KinesisSourceSpec) {
+				spec.Filter = &v1alpha1.FilterSpec{
+					PartitionKey: &v1alpha1.StringMatch{Prefix: &prefix},
+					Fields:       []v1alpha1.FieldMatch{{Path: "$.type", StringMatch: v1alpha1.StringMatch{Prefix: &prefix}}},
+				}
+			},
+			want: []corev1.EnvVar{{Name: "FILTER", Value: `{"partitionKey":{"prefix":"orders-"},"fields":[{"path":"$.type","prefix":"orders-"}]}`}},
+		},
+		"ce overrides": {
+			mutate: func(spec *v1alpha1.KinesisSourceSpec) {
+				spec.PayloadFormat = v1alpha1.PayloadFormatRecord
+				spec.CEOverrides = &v1alpha1.CEOverrides{
+					Type:       "com.acme.${$.type}",
+					Extensions: map[string]string{"shard": "${shard}"},
+				}
+			},
+			want: []corev1.EnvVar{{Name: "CE_OVERRIDES", Value: `{"type":"com.acme.${$.type}","extensions":{"shard":"${shard}"}}`}},
+		},
+		"transform": {
+			mutate: func(spec *v1alpha1.KinesisSourceSpec) {
+				spec.PayloadFormat = v1alpha1.PayloadFormatRecord
+				spec.DataContentType = v1alpha1.DataContentTypeJSON
+				spec.Transform = []v1alpha1.TransformStep{
+					{Drop: []string{"$.ssn"}},
+					{Add: []v1alpha1.FieldValue{{Path: "$.origin", Value: runtime.RawExtension{Raw: []byte(`"eu"`)}}}},
+				}
+			},
+			want: []corev1.EnvVar{
+				{Name: "DATA_CONTENT_TYPE", Value: "application/json"},
+				{Name: "TRANSFORM", Value: `[{"drop":["$.ssn"]},{"add":[{"path":"$.origin","value":"eu"}]}]`},
+			},
+		},
+		"payload format": {
+			mutate: func(spec *v1alpha1.KinesisSourceSpec) {
+				spec.PayloadFormat = v1alpha1.PayloadFormatDynamoDBChanges
+				spec.DynamoDBChanges = &v1alpha1.DynamoDBChangesOptions{PlainJSON: true}
+				spec.Compression = v1alpha1.CompressionGzip
+			},
+			want: []corev1.EnvVar{
+				{Name: "PAYLOAD_FORMAT", Value: "dynamodbChanges"},
+				{Name: "DYNAMODB_PLAIN_JSON", Value: "true"},
+				{Name: "COMPRESSION", Value: "gzip"},
+			},
+		},
+		"schema": {
+			mutate: func(spec *v1alpha1.KinesisSourceSpec) {
+				spec.PayloadFormat = v1alpha1.PayloadFormatRecord
+				spec.Schema = &v1alpha1.SchemaSpec{
+					Type:          v1alpha1.SchemaTypeProtobuf,
+					ConfigMapName: "order-schemas",
+					MessageType:   "acme.Order",
+				}
+				spec.DeadLetterSinkURI = "http://dead-letters/"
+			},
+			want: []corev1.EnvVar{
+				{Name: "PAYLOAD_FORMAT", Value: "record"},
+				{Name: "SCHEMA_TYPE", Value: "protobuf"},
+				{Name: "SCHEMA_DIR", Value: "/etc/kinesis-schemas"},
+				{Name: "SCHEMA_URL", Value: "/api/v1/namespaces/source-namespace/configmaps/order-schemas"},
+				{Name: "SCHEMA_MESSAGE_TYPE", Value: "acme.Order"},
+				{Name: "DEAD_LETTER_SINK_URI", Value: "http://dead-letters/"},
+			},
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			got := MakeReceiveAdapter(&ReceiveAdapterArgs{
+				Defaults: &Defaults{Image: "test-image"},
+				Source:   testSource(tc.mutate),
+				Labels:   map[string]string{"test-key1": "test-value1"},
+				SinkURI:  "sink-uri",
+			})
+			env := got.Spec.Template.Spec.Containers[0].Env
+			for _, want := range tc.want {
+				e, ok := envVar(env, want.Name)
+				if !ok {
+					t.Errorf("expected env %s, but it was not set", want.Name)
+					continue
+				}
+				if diff := cmp.Diff(want, e); diff != "" {
+					t.Errorf("unexpected env %s (-want, +got) = %v", want.Name, diff)
+				}
+			}
+			for _, name := range tc.absent {
+				if e, ok := envVar(env, name); ok {
+					t.Errorf("expected no env %s, but got %q", name, e.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestMakeReceiveAdapterReplayAnnotation(t *testing.T) {
+	got := MakeReceiveAdapter(&ReceiveAdapterArgs{
+		Defaults: &Defaults{Image: "test-image"},
+		Source: testSource(func(spec *v1alpha1.KinesisSourceSpec) {
+			spec.Replay = &v1alpha1.ReplaySpec{Token: "rewind-1"}
+		}),
+		Labels:  map[string]string{"test-key1": "test-value1"},
+		SinkURI: "sink-uri",
+	})
+
+	if token := got.Annotations[ReplayTokenAnnotation]; token != "rewind-1" {
+		t.Errorf("expected replay token %q, but got %q", "rewind-1", token)
+	}
+}
+
+func TestMakeReceiveAdapterSchemaVolume(t *testing.T) {
+	got := MakeReceiveAdapter(&ReceiveAdapterArgs{
+		Defaults: &Defaults{Image: "test-image"},
+		Source: testSource(func(spec *v1alpha1.KinesisSourceSpec) {
+			spec.PayloadFormat = v1alpha1.PayloadFormatRecord
+			spec.Schema = &v1alpha1.SchemaSpec{
+				Type:          v1alpha1.SchemaTypeProtobuf,
+				ConfigMapName: "order-schemas",
+				MessageType:   "acme.Order",
+			}
+		}),
+		Labels:  map[string]string{"test-key1": "test-value1"},
+		SinkURI: "sink-uri",
+	})
+
+	podSpec := got.Spec.Template.Spec
+	wantMounts := []corev1.VolumeMount{{Name: "schemas", MountPath: "/etc/kinesis-schemas", ReadOnly: true}}
+	if diff := cmp.Diff(wantMounts, podSpec.Containers[0].VolumeMounts); diff != "" {
+		t.Errorf("unexpected volume mounts (-want, +got) = %v", diff)
+	}
+	wantVolumes := []corev1.Volume{{
+		Name: "schemas",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "order-schemas"}},
+		},
+	}}
+	if diff := cmp.Diff(wantVolumes, podSpec.Volumes); diff != "" {
+		t.Errorf("unexpected volumes (-want, +got) = %v", diff)
+	}
+}
+
+func TestMakeReceiveAdapterWithDefaults(t *testing.T) {
+	maxRecords := int32(10)
+	specMaxRecords := int32(100)
+	attempts := int32(3)
+	src := &v1alpha1.KinesisSource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "source-name",
+			Namespace: "source-namespace",
+		},
+		Spec: v1alpha1.KinesisSourceSpec{
+			StreamName: "kinesis-name",
+			Region:     "us-west-2",
+			KIAMOptions: v1alpha1.KiamOptions{
+				AssignedIAMRole: "assigned-role",
+				KCLIAMRoleARN:   "kcl-role",
+			},
+			KCL:            &v1alpha1.KCLSpec{MaxRecords: &specMaxRecords},
+			MetricsBackend: v1alpha1.MetricsBackendNone,
+			Template: &v1alpha1.ReceiveAdapterTemplate{
+				Metadata: v1alpha1.ReceiveAdapterMetadata{
+					Annotations: map[string]string{"sidecar.istio.io/inject": "true"},
+				},
+				Spec: v1alpha1.ReceiveAdapterPodSpec{
+					Image: "source-image",
+				},
+			},
+		},
+	}
+	defaults := &Defaults{
+		Image: "test-image",
+		Mesh:  v1alpha1.MeshLinkerd,
+		KCL: v1alpha1.KCLSpec{
+			MaxRecords:   &maxRecords,
+			FailoverTime: &metav1.Duration{Duration: time.Minute},
+		},
+		MetricsBackend: v1alpha1.MetricsBackendPrometheus,
+		Retry: v1alpha1.RetryPolicy{
+			Attempts: &attempts,
+			Backoff:  &metav1.Duration{Duration: 500 * time.Millisecond},
+		},
+	}
+
+	template := MakeReceiveAdapter(&ReceiveAdapterArgs{
+		Defaults: defaults,
+		Source:   src,
+		Labels:   map[string]string{"test-key": "test-value"},
+		SinkURI:  "sink-uri",
+	}).Spec.Template
+
+	if got := template.Spec.Containers[0].Image; got != "source-image" {
+		t.Errorf("expected image %q, but got %q", "source-image", got)
+	}
+	if got := template.Annotations["sidecar.istio.io/inject"]; got != "true" {
+		t.Errorf("expected the template to override the istio annotation, but got %q", got)
+	}
+	want := []corev1.EnvVar{
+		{Name: "KCL_MAX_RECORDS", Value: "100"},
+		{Name: "KCL_FAILOVER_TIME", Value: "1m0s"},
+		{Name: "METRICS_BACKEND", Value: "none"},
+		{Name: "RETRY_ATTEMPTS", Value: "3"},
+		{Name: "RETRY_BACKOFF", Value: "500ms"},
+	}
+	env := template.Spec.Containers[0].Env
+	for _, w := range want {
+		if e, _ := envVar(env, w.Name); !cmp.Equal(w, e) {
+			t.Errorf("unexpected tuning env (-want, +got) = %v", cmp.Diff(w, e))
+		}
+	}
+
+	// Without a template, the defaults apply.
+	src.Spec.Template = nil
+	template = MakeReceiveAdapter(&ReceiveAdapterArgs{
+		Defaults: defaults,
+		Source:   src,
+		Labels:   map[string]string{"test-key": "test-value"},
+		SinkURI:  "sink-uri",
+	}).Spec.Template
+	if got := template.Spec.Containers[0].Image; got != "test-image" {
+		t.Errorf("expected image %q, but got %q", "test-image", got)
+	}
+	if got := template.Annotations["linkerd.io/inject"]; got != "enabled" {
+		t.Errorf("expected the default linkerd annotation, but got %q", got)
+	}
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// tracker keeps track of the objects a KinesisSource references, so that the
+// source can be reconciled again when one of them changes.
+type tracker interface {
+	// Track replaces the set of objects tracked on behalf of the given source.
+	Track(src *v1alpha1.KinesisSource, refs ...corev1.ObjectReference) error
+
+	// Untrack stops tracking all objects on behalf of the given source.
+	Untrack(src *v1alpha1.KinesisSource)
+}
+
+// trackedKey identifies a tracked object.
+type trackedKey struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+	name      string
+}
+
+// sinkTracker is a tracker backed by dynamic informers. An informer is
+// started lazily for every resource type referenced as a sink, and stopped
+// once no source references that type anymore. Any change to a referenced
+// object is sent to the controller as a GenericEvent for each source
+// referencing it. The informers watch a single namespace when the controller
+// is restricted to one.
+//
+// The controller must be allowed to list and watch every resource type
+// referenced as a sink, the ClusterRole only grants it channels, brokers,
+// services and routes.
+type sinkTracker struct {
+	client    dynamic.Interface
+	mapper    meta.RESTMapper
+	namespace string
+	events    chan<- event.GenericEvent
+	stopCh    <-chan struct{}
+
+	mu        sync.Mutex
+	informers map[schema.GroupVersionResource]*sinkInformer
+	// sources maps a tracked object to the sources referencing it.
+	sources map[trackedKey]map[types.NamespacedName]struct{}
+	// refs maps a source to the objects it references.
+	refs map[types.NamespacedName][]trackedKey
+}
+
+// sinkInformer is a running informer, along with the channel stopping it.
+type sinkInformer struct {
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+}
+
+var _ tracker = (*sinkTracker)(nil)
+
+func newSinkTracker(client dynamic.Interface, mapper meta.RESTMapper, namespace string, events chan<- event.GenericEvent) *sinkTracker {
+	return &sinkTracker{
+		client:    client,
+		mapper:    mapper,
+		namespace: namespace,
+		events:    events,
+		informers: make(map[schema.GroupVersionResource]*sinkInformer),
+		sources:   make(map[trackedKey]map[types.NamespacedName]struct{}),
+		refs:      make(map[types.NamespacedName][]trackedKey),
+	}
+}
+
+// InjectStopChannel is called by the Manager to stop the informers on shutdown.
+func (t *sinkTracker) InjectStopChannel(stopCh <-chan struct{}) error {
+	t.stopCh = stopCh
+	return nil
+}
+
+// Track implements tracker.
+func (t *sinkTracker) Track(src *v1alpha1.KinesisSource, refs ...corev1.ObjectReference) error {
+	keys := make([]trackedKey, 0, len(refs))
+	for _, ref := range refs {
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = src.Namespace
+		}
+		if t.namespace != metav1.NamespaceAll && namespace != t.namespace {
+			return fmt.Errorf("sink %s/%s is out of the watched namespace %q", namespace, ref.Name, t.namespace)
+		}
+		gvk := ref.GroupVersionKind()
+		mapping, err := t.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, trackedKey{gvr: mapping.Resource, namespace: namespace, name: ref.Name})
+	}
+
+	srcKey := types.NamespacedName{Namespace: src.Namespace, Name: src.Name}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.untrackLocked(srcKey)
+	for _, key := range keys {
+		t.ensureInformerLocked(key.gvr)
+		if t.sources[key] == nil {
+			t.sources[key] = make(map[types.NamespacedName]struct{})
+		}
+		t.sources[key][srcKey] = struct{}{}
+	}
+	t.refs[srcKey] = keys
+	t.stopUnusedInformersLocked()
+	return nil
+}
+
+// Untrack implements tracker.
+func (t *sinkTracker) Untrack(src *v1alpha1.KinesisSource) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.untrackLocked(types.NamespacedName{Namespace: src.Namespace, Name: src.Name})
+	t.stopUnusedInformersLocked()
+}
+
+func (t *sinkTracker) untrackLocked(srcKey types.NamespacedName) {
+	for _, key := range t.refs[srcKey] {
+		delete(t.sources[key], srcKey)
+		if len(t.sources[key]) == 0 {
+			delete(t.sources, key)
+		}
+	}
+	delete(t.refs, srcKey)
+}
+
+func (t *sinkTracker) ensureInformerLocked(gvr schema.GroupVersionResource) {
+	if _, ok := t.informers[gvr]; ok {
+		return
+	}
+
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				return t.client.Resource(gvr).Namespace(t.namespace).List(opts)
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				return t.client.Resource(gvr).Namespace(t.namespace).Watch(opts)
+			},
+		},
+		&unstructured.Unstructured{},
+		0,
+		cache.Indexers{},
+	)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { t.notify(gvr, obj) },
+		UpdateFunc: func(_, obj interface{}) { t.notify(gvr, obj) },
+		DeleteFunc: func(obj interface{}) { t.notify(gvr, obj) },
+	})
+	stopCh := make(chan struct{})
+	t.informers[gvr] = &sinkInformer{informer: informer, stopCh: stopCh}
+
+	// The informer stops along with the Manager, or once its resource type is no longer tracked.
+	runCh := make(chan struct{})
+	go func() {
+		select {
+		case <-t.stopCh:
+		case <-stopCh:
+		}
+		close(runCh)
+	}()
+	go informer.Run(runCh)
+}
+
+// stopUnusedInformersLocked stops the informers of the resource types no source references.
+func (t *sinkTracker) stopUnusedInformersLocked() {
+	used := make(map[schema.GroupVersionResource]bool, len(t.informers))
+	for key := range t.sources {
+		used[key.gvr] = true
+	}
+	for gvr, informer := range t.informers {
+		if !used[gvr] {
+			close(informer.stopCh)
+			delete(t.informers, gvr)
+		}
+	}
+}
+
+// notify enqueues every source referencing the given object.
+// As in enqueueSources, the events are sent from another goroutine, so that the informer
+// calling it is not blocked until the controller received them.
+func (t *sinkTracker) notify(gvr schema.GroupVersionResource, obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+
+	key := trackedKey{gvr: gvr, namespace: accessor.GetNamespace(), name: accessor.GetName()}
+
+	t.mu.Lock()
+	srcKeys := make([]types.NamespacedName, 0, len(t.sources[key]))
+	for srcKey := range t.sources[key] {
+		srcKeys = append(srcKeys, srcKey)
+	}
+	t.mu.Unlock()
+
+	if len(srcKeys) == 0 {
+		return
+	}
+	go func() {
+		for _, srcKey := range srcKeys {
+			src := &v1alpha1.KinesisSource{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: srcKey.Namespace,
+					Name:      srcKey.Name,
+				},
+			}
+			t.events <- event.GenericEvent{Meta: src, Object: src}
+		}
+	}()
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestSinkTracker(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "duck.knative.dev", Version: "v1alpha1", Kind: addressableKind}
+	gvr := schema.GroupVersionResource{Group: "duck.knative.dev", Version: "v1alpha1", Resource: "sinks"}
+
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{gvk.GroupVersion()})
+	mapper.Add(gvk, meta.RESTScopeNamespace)
+
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), getAddressable())
+	events := make(chan event.GenericEvent, 10)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	st := newSinkTracker(client, mapper, metav1.NamespaceAll, events)
+	st.InjectStopChannel(stopCh)
+
+	src := getSource()
+	if err := st.Track(src, *src.Spec.Sink); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The initial list of the informer notifies the source.
+	expectEnqueued(t, events, testNS, sourceName)
+
+	updateAddressable(t, client, gvr, "new.sink.svc.cluster.local")
+	expectEnqueued(t, events, testNS, sourceName)
+
+	st.Untrack(src)
+	if len(st.informers) != 0 {
+		t.Errorf("expected the informer of %v to be stopped, but got %v", gvr, st.informers)
+	}
+	updateAddressable(t, client, gvr, "newer.sink.svc.cluster.local")
+	select {
+	case evt := <-events:
+		t.Errorf("unexpected event after untrack: %v", evt.Meta)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func updateAddressable(t *testing.T, client *dynamicfake.FakeDynamicClient, gvr schema.GroupVersionResource, hostname string) {
+	u := getAddressable()
+	if err := unstructured.SetNestedField(u.Object, hostname, "status", "address", "hostname"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.Resource(gvr).Namespace(testNS).Update(u, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func expectEnqueued(t *testing.T, events <-chan event.GenericEvent, namespace, name string) {
+	t.Helper()
+	select {
+	case evt := <-events:
+		if evt.Meta.GetNamespace() != namespace || evt.Meta.GetName() != name {
+			t.Errorf("expected %s/%s to be enqueued, got %s/%s", namespace, name, evt.Meta.GetNamespace(), evt.Meta.GetName())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s/%s to be enqueued", namespace, name)
+	}
+}
+
+func TestSinkTrackerNamespaced(t *testing.T) {
+	st := newSinkTracker(nil, nil, testNS, make(chan event.GenericEvent, 10))
+
+	src := getSource()
+	ref := *src.Spec.Sink
+	ref.Namespace = "other"
+	if err := st.Track(src, ref); err == nil {
+		t.Error("expected an error tracking a sink out of the watched namespace")
+	}
+}
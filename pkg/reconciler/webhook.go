@@ -0,0 +1,108 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+
+	"github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+
+	"go.uber.org/zap"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	atypes "sigs.k8s.io/controller-runtime/pkg/webhook/admission/types"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/types"
+)
+
+// webhookPath is the path the validating admission webhook of the sources is served on.
+const webhookPath = "/validate-kinesissources"
+
+// ServeWebhook serves the validating admission webhook of the sources over TLS on the given
+// address, with the tls.crt and tls.key certificate of certDir, until the stop channel is closed.
+// It rejects the sources with an invalid spec, or violating the policy of their namespace. Unlike
+// the controller, it is served by every replica, leader or not.
+func ServeWebhook(cfg *rest.Config, logger *zap.SugaredLogger, addr, certDir string, stopCh <-chan struct{}) error {
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	pw := newPolicyWatcher(kubeClient, getSystemNamespace(), nil, logger)
+	if err := pw.load(); err != nil {
+		return err
+	}
+	go pw.Start(stopCh)
+
+	mux := http.NewServeMux()
+	mux.Handle(webhookPath, &admission.Webhook{
+		Name:     "validation.kinesissources.sources.eventing.knative.dev",
+		Type:     types.WebhookTypeValidating,
+		Path:     webhookPath,
+		Handlers: []admission.Handler{&sourceValidator{policy: pw}},
+	})
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-stopCh
+		server.Close()
+	}()
+
+	err = server.ListenAndServeTLS(filepath.Join(certDir, "tls.crt"), filepath.Join(certDir, "tls.key"))
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// sourceValidator is an admission handler validating the sources.
+type sourceValidator struct {
+	policy *policyWatcher
+}
+
+// Handle implements admission.Handler. Updates leaving the spec unchanged are always allowed, so
+// that the finalizer of a source created before a stricter policy can still be removed.
+func (v *sourceValidator) Handle(ctx context.Context, req atypes.Request) atypes.Response {
+	src := &v1alpha1.KinesisSource{}
+	if err := json.Unmarshal(req.AdmissionRequest.Object.Raw, src); err != nil {
+		return admission.ErrorResponse(http.StatusBadRequest, err)
+	}
+	if src.Namespace == "" {
+		src.Namespace = req.AdmissionRequest.Namespace
+	}
+
+	if req.AdmissionRequest.Operation == admissionv1beta1.Update {
+		old := &v1alpha1.KinesisSource{}
+		if err := json.Unmarshal(req.AdmissionRequest.OldObject.Raw, old); err != nil {
+			return admission.ErrorResponse(http.StatusBadRequest, err)
+		}
+		if equality.Semantic.DeepEqual(old.Spec, src.Spec) {
+			return admission.ValidationResponse(true, "")
+		}
+	}
+
+	if fe := src.Validate(ctx); fe != nil {
+		return admission.ErrorResponse(http.StatusUnprocessableEntity, fe)
+	}
+	if err := v.policy.Policy().check(src); err != nil {
+		return admission.ErrorResponse(http.StatusForbidden, err)
+	}
+	return admission.ValidationResponse(true, "")
+}
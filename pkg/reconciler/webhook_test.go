@@ -0,0 +1,111 @@
+/*
+Copyright 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinesis
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	sourcesv1alpha1 "github.com/whynowy/knative-source-kinesis/pkg/apis/sources/v1alpha1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	atypes "sigs.k8s.io/controller-runtime/pkg/webhook/admission/types"
+)
+
+func TestSourceValidator(t *testing.T) {
+	v := &sourceValidator{policy: &policyWatcher{
+		policy: policy{testNS: {CredentialModes: []string{credentialModeKIAM}}},
+	}}
+	kiamSource := getSource()
+	kiamSource.Spec.AwsCredsSecret.Name = ""
+	invalidSource := getSourceWithSinkURI(nil, "")
+	invalidSource.Spec.AwsCredsSecret.Name = ""
+	templateCredsSource := kiamSource.DeepCopy()
+	templateCredsSource.Spec.Template = &sourcesv1alpha1.ReceiveAdapterTemplate{
+		Spec: sourcesv1alpha1.ReceiveAdapterPodSpec{
+			Env: []corev1.EnvVar{{Name: "AWS_ACCESS_KEY_ID", Value: "AKIA"}},
+		},
+	}
+
+	testCases := map[string]struct {
+		operation admissionv1beta1.Operation
+		old       *sourcesv1alpha1.KinesisSource
+		src       *sourcesv1alpha1.KinesisSource
+		wantCode  int32
+	}{
+		"allowed": {
+			operation: admissionv1beta1.Create,
+			src:       kiamSource,
+		},
+		"invalid spec": {
+			operation: admissionv1beta1.Create,
+			src:       invalidSource,
+			wantCode:  http.StatusUnprocessableEntity,
+		},
+		"credentials in the template": {
+			operation: admissionv1beta1.Create,
+			src:       templateCredsSource,
+			wantCode:  http.StatusUnprocessableEntity,
+		},
+		"policy violation": {
+			operation: admissionv1beta1.Create,
+			src:       getSource(),
+			wantCode:  http.StatusForbidden,
+		},
+		"policy violation introduced by an update": {
+			operation: admissionv1beta1.Update,
+			old:       kiamSource,
+			src:       getSource(),
+			wantCode:  http.StatusForbidden,
+		},
+		"update leaving a violating spec unchanged": {
+			operation: admissionv1beta1.Update,
+			old:       getSource(),
+			src:       getSourceWithFinalizer(),
+		},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			req := &admissionv1beta1.AdmissionRequest{
+				Operation: tc.operation,
+				Namespace: testNS,
+				Object:    rawExtension(t, tc.src),
+			}
+			if tc.old != nil {
+				req.OldObject = rawExtension(t, tc.old)
+			}
+			resp := v.Handle(context.TODO(), atypes.Request{AdmissionRequest: req})
+			if allowed := tc.wantCode == 0; resp.Response.Allowed != allowed {
+				t.Fatalf("expected allowed %v, but got %v: %v", allowed, resp.Response.Allowed, resp.Response.Result)
+			}
+			if tc.wantCode != 0 && resp.Response.Result.Code != tc.wantCode {
+				t.Errorf("expected code %d, but got %d: %s", tc.wantCode, resp.Response.Result.Code, resp.Response.Result.Message)
+			}
+		})
+	}
+}
+
+func rawExtension(t *testing.T, src *sourcesv1alpha1.KinesisSource) runtime.RawExtension {
+	raw, err := json.Marshal(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return runtime.RawExtension{Raw: raw}
+}